@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/leonvogt/lunar/internal"
+	"github.com/spf13/cobra"
+)
+
+var (
+	describeCmd = &cobra.Command{
+		Use:   "describe [snapshot] [description]",
+		Short: "Describes a snapshot",
+		Long:  "Stores a description of the snapshot, shown by `lunar list` and `lunar info`. The description is kept when the snapshot is replaced or renamed, an empty description (\"\") removes it.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return describeSnapshot(cmd.Context(), args)
+		},
+	}
+)
+
+func describeSnapshot(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("please provide the snapshot and its description. Like `lunar describe staging \"before the migration\"`")
+	}
+	snapshotName, description := args[0], args[1]
+
+	return withSnapshotManager(ctx, func(ctx context.Context, manager *internal.Manager, config *internal.Config) error {
+		if err := manager.SetSnapshotDescription(ctx, snapshotName, description); err != nil {
+			return fmt.Errorf("error describing snapshot: %v", err)
+		}
+
+		if description == "" {
+			fmt.Printf("Description of snapshot %s removed\n", snapshotName)
+		} else {
+			fmt.Printf("Snapshot %s described\n", snapshotName)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/leonvogt/lunar/internal"
+	"github.com/leonvogt/lunar/internal/provider"
+	"github.com/spf13/cobra"
+)
+
+var (
+	doctorCmd = &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the setup and print how to fix problems",
+		Long:  "Checks the configuration, the connection to the database, the required privileges, the snapshot storage and the hook commands, and prints how to fix the problems found.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDoctor(cmd.Context())
+		},
+	}
+)
+
+func runDoctor(ctx context.Context) error {
+	if !internal.DoesConfigExist() {
+		return fmt.Errorf("there seems to be no configuration file. Please run 'lunar init' first")
+	}
+
+	config, err := internal.ReadConfig()
+	if err != nil {
+		printCheck(provider.Check{Name: "Configuration", Status: provider.CheckFailed, Message: err.Error(), Fix: "Fix the syntax of lunar.yml"})
+		return fmt.Errorf("lunar.yml can't be read")
+	}
+
+	checks := internal.Diagnose(ctx, config)
+	if config.BeforeSnapshotCommand != "" {
+		checks = append(checks, checkHookCommand("before_snapshot_command", config.BeforeSnapshotCommand, config.ConfigDir()))
+	}
+	if config.AfterRestoreCommand != "" {
+		checks = append(checks, checkHookCommand("after_restore_command", config.AfterRestoreCommand, config.ConfigDir()))
+	}
+
+	failed, warnings := 0, 0
+	for _, check := range checks {
+		printCheck(check)
+		switch check.Status {
+		case provider.CheckFailed:
+			failed++
+		case provider.CheckWarning:
+			warnings++
+		}
+	}
+
+	fmt.Println()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	if warnings > 0 {
+		fmt.Printf("No problems found, but %d warning(s)\n", warnings)
+		return nil
+	}
+	fmt.Println("No problems found")
+	return nil
+}
+
+func printCheck(check provider.Check) {
+	fmt.Printf("%-10s %s: %s\n", "["+string(check.Status)+"]", check.Name, check.Message)
+	if check.Fix != "" {
+		fmt.Printf("%-10s Fix: %s\n", "", check.Fix)
+	}
+}
+
+// Hooks run through `sh -c` in the directory of lunar.yml, see runHookCommand
+func checkHookCommand(hookName, command, dir string) provider.Check {
+	check := provider.Check{Name: hookName, Status: provider.CheckPassed, Message: command}
+
+	if _, err := exec.LookPath("sh"); err != nil {
+		check.Status = provider.CheckFailed
+		check.Message = "hooks are run with sh, which was not found"
+		check.Fix = "Install a POSIX shell or remove the hook from lunar.yml"
+		return check
+	}
+
+	program := hookProgram(command)
+	if program == "" {
+		return check
+	}
+
+	// `command -v` also finds shell builtins and relative paths
+	lookup := exec.Command("sh", "-c", `command -v "$1"`, "sh", program)
+	lookup.Dir = dir
+	if err := lookup.Run(); err != nil {
+		check.Status = provider.CheckFailed
+		check.Message = fmt.Sprintf("%s was not found", program)
+		check.Fix = fmt.Sprintf("Install %s, make it executable or fix %s in lunar.yml", program, hookName)
+	}
+	return check
+}
+
+// Returns the program the command starts with, skipping variable assignments like `RAILS_ENV=test`
+func hookProgram(command string) string {
+	for _, word := range strings.Fields(command) {
+		if strings.Contains(word, "=") && !strings.HasPrefix(word, "=") {
+			continue
+		}
+		return word
+	}
+	return ""
+}
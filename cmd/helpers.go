@@ -1,17 +1,23 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/erikgeiser/promptkit/selection"
 	"github.com/leonvogt/lunar/internal"
+	"github.com/leonvogt/lunar/internal/jobs"
+	"github.com/leonvogt/lunar/internal/ui"
 )
 
 // Handles the common pattern of checking config, creating a manager,
 // and ensuring cleanup. It calls the provided function with the manager and config.
-func withSnapshotManager(operation func(manager *internal.Manager, config *internal.Config) error) error {
+// The context passed to the function is cancelled on Ctrl-C or when --timeout is reached.
+func withSnapshotManager(ctx context.Context, operation func(ctx context.Context, manager *internal.Manager, config *internal.Config) error) error {
 	if !internal.DoesConfigExist() {
 		return fmt.Errorf("there seems to be no configuration file. Please run 'lunar init' first")
 	}
@@ -27,11 +33,68 @@ func withSnapshotManager(operation func(manager *internal.Manager, config *inter
 	}
 	defer snapshotManager.Close()
 
-	return operation(snapshotManager, config)
+	if timeoutFlag > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeoutFlag)
+		defer cancel()
+	}
+
+	err = operation(ctx, snapshotManager, config)
+	if err != nil {
+		switch ctx.Err() {
+		case context.Canceled:
+			return fmt.Errorf("operation cancelled: %v", err)
+		case context.DeadlineExceeded:
+			return fmt.Errorf("operation timed out after %s: %v", timeoutFlag, err)
+		}
+	}
+	return err
+}
+
+// Waits for other Lunar processes working on the same database, for at most --lock-timeout.
+// The message tells the user what happens once the other operation completed.
+func waitForOngoingOperations(ctx context.Context, manager *internal.Manager, message string) error {
+	if !manager.IsWaitingForOperation(ctx) {
+		return nil
+	}
+
+	if lockTimeoutFlag > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lockTimeoutFlag)
+		defer cancel()
+	}
+
+	stopWaitSpinner := ui.StartSpinner(describeOngoingOperation(ctx, manager) + " " + message)
+	defer stopWaitSpinner()
+
+	if err := manager.WaitForOngoingOperations(ctx); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("gave up waiting for ongoing operation after %s", lockTimeoutFlag)
+		}
+		return fmt.Errorf("failed to wait for ongoing operation: %v", err)
+	}
+	return nil
 }
 
-func selectSnapshot(manager *internal.Manager, promptMessage string) (string, error) {
-	snapshots, err := manager.ListSnapshots()
+func describeOngoingOperation(ctx context.Context, manager *internal.Manager) string {
+	holders, _ := manager.LockHolders(ctx)
+	for _, holder := range holders {
+		if holder.Lock != "operation" || holder.PID == 0 {
+			continue
+		}
+
+		description := fmt.Sprintf("Currently %s is running.", holder)
+		if holder.IsDead() {
+			description += " The process seems to be gone, run `lunar unlock` to release its lock."
+		}
+		return description
+	}
+
+	return "Currently there is a Lunar background operation running."
+}
+
+func selectSnapshot(ctx context.Context, manager *internal.Manager, promptMessage string) (string, error) {
+	snapshots, err := manager.ListSnapshots(ctx)
 	if err != nil {
 		return "", fmt.Errorf("error listing snapshots: %v", err)
 	}
@@ -45,8 +108,13 @@ func selectSnapshot(manager *internal.Manager, promptMessage string) (string, er
 		snapshotNames[i] = snapshot.Name
 	}
 
+	if err := ui.CheckPromptable(); err != nil {
+		return "", fmt.Errorf("no snapshot given and can't ask for one (%v). Pass the snapshot name, one of: %s", err, strings.Join(snapshotNames, ", "))
+	}
+
 	prompt := selection.New(promptMessage, snapshotNames)
 	prompt.PageSize = 50
+	prompt.ColorProfile = ui.PromptColorProfile()
 
 	selectedSnapshot, err := prompt.RunPrompt()
 	if err != nil {
@@ -58,22 +126,22 @@ func selectSnapshot(manager *internal.Manager, promptMessage string) (string, er
 
 // Returns the snapshot name from args if provided,
 // otherwise prompts the user to select one.
-func getSnapshotNameFromArgsOrPrompt(args []string, manager *internal.Manager, promptMessage string) (string, error) {
+func getSnapshotNameFromArgsOrPrompt(ctx context.Context, args []string, manager *internal.Manager, promptMessage string) (string, error) {
 	if len(args) >= 1 {
 		snapshotName := args[0]
-		if err := manager.CheckIfSnapshotExists(snapshotName); err != nil {
+		if err := manager.CheckIfSnapshotExists(ctx, snapshotName); err != nil {
 			return "", err
 		}
 		return snapshotName, nil
 	}
 
-	return selectSnapshot(manager, promptMessage)
+	return selectSnapshot(ctx, manager, promptMessage)
 }
 
-func runHookCommand(hookName, command, dir string) error {
+func runHookCommand(ctx context.Context, hookName, command, dir string) error {
 	fmt.Printf("Running %s: %s\n", hookName, command)
 
-	hookCommand := exec.Command("sh", "-c", command)
+	hookCommand := exec.CommandContext(ctx, "sh", "-c", command)
 	hookCommand.Dir = dir
 	hookCommand.Stdout = os.Stdout
 	hookCommand.Stderr = os.Stderr
@@ -86,22 +154,86 @@ func runHookCommand(hookName, command, dir string) error {
 	return nil
 }
 
-// spawnBackgroundCommand starts a background process with the given arguments.
+// spawnBackgroundJob starts `lunar <args...> <snapshotName>` as a tracked background job.
 // The process runs independently and survives after the parent exits.
-func spawnBackgroundCommand(args ...string) error {
+// Its output is written to the log file of the job, see `lunar jobs`.
+func spawnBackgroundJob(config *internal.Config, snapshotName string, args ...string) error {
+	store, err := openJobStore(config)
+	if err != nil {
+		return err
+	}
+
+	kind := args[len(args)-1]
+	_, err = startJob(config, store, kind, snapshotName, append(args, snapshotName))
+	return err
+}
+
+func startJob(config *internal.Config, store *jobs.Store, kind, snapshotName string, args []string) (*jobs.Job, error) {
 	executable, err := os.Executable()
 	if err != nil {
-		return fmt.Errorf("could not find executable: %v", err)
+		return nil, fmt.Errorf("could not find executable: %v", err)
 	}
 
+	// Checked before the job is created, a job that is never started would stay running
+	stateDir, err := config.StateDir()
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := store.Create(kind, snapshotName, args)
+	if err != nil {
+		return nil, err
+	}
+
+	logFile, err := os.Create(job.LogFile)
+	if err != nil {
+		store.Finish(job.ID, err)
+		return nil, fmt.Errorf("could not create job log file: %v", err)
+	}
+	defer logFile.Close()
+
 	command := exec.Command(executable, args...)
-	command.Stdout = nil
-	command.Stderr = nil
+	command.Stdout = logFile
+	command.Stderr = logFile
 	command.Stdin = nil
+	detachProcess(command)
+	command.Env = append(os.Environ(),
+		jobs.JOB_ID_ENV+"="+job.ID,
+		internal.STATE_DIR_ENV+"="+stateDir,
+	)
 
 	if err := command.Start(); err != nil {
-		return fmt.Errorf("could not start background process: %v", err)
+		store.Finish(job.ID, err)
+		return nil, fmt.Errorf("could not start background process: %v", err)
 	}
 
-	return nil
+	if err := store.SetPID(job.ID, command.Process.Pid); err != nil {
+		return nil, err
+	}
+	command.Process.Release()
+
+	return job, nil
+}
+
+// Runs the operation of a background job. Errors end up in the log file of the job
+// and are reported by the next command, see reportFailedJobs.
+func runBackgroundJob(operation func() error) {
+	err := operation()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	// The state directory is passed by the parent, the job has to be recorded
+	// even if the config can no longer be read
+	jobID := os.Getenv(jobs.JOB_ID_ENV)
+	stateDir := os.Getenv(internal.STATE_DIR_ENV)
+	if jobID != "" && stateDir != "" {
+		if store, storeErr := jobs.NewStore(filepath.Join(stateDir, "jobs")); storeErr == nil {
+			store.Finish(jobID, err)
+		}
+	}
+
+	if err != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/leonvogt/lunar/internal"
+	"github.com/leonvogt/lunar/internal/disk"
+	"github.com/leonvogt/lunar/internal/provider"
+	"github.com/leonvogt/lunar/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	infoCmd = &cobra.Command{
+		Use:   "info [snapshot]",
+		Short: "Show information about the database or a snapshot",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return showInfo(cmd.Context(), args)
+		},
+	}
+)
+
+func showInfo(ctx context.Context, args []string) error {
+	return withSnapshotManager(ctx, func(ctx context.Context, manager *internal.Manager, config *internal.Config) error {
+		if len(args) >= 1 {
+			return showSnapshotInfo(ctx, manager, args[0])
+		}
+
+		details := []provider.Detail{
+			{Label: "Provider", Value: string(config.GetProviderType())},
+			{Label: "Database", Value: manager.GetDatabaseIdentifier()},
+		}
+
+		if size, err := manager.GetDatabaseSize(ctx); err == nil {
+			details = append(details, provider.Detail{Label: "Database size", Value: disk.FormatBytes(size)})
+		}
+
+		providerDetails, err := manager.GetDetails(ctx)
+		if err != nil {
+			return fmt.Errorf("error getting details: %v", err)
+		}
+		details = append(details, providerDetails...)
+
+		snapshots, err := manager.ListSnapshots(ctx)
+		if err != nil {
+			return fmt.Errorf("error listing snapshots: %v", err)
+		}
+		details = append(details, provider.Detail{Label: "Snapshots", Value: fmt.Sprintf("%d", len(snapshots))})
+
+		printDetails(details)
+		return nil
+	})
+}
+
+func showSnapshotInfo(ctx context.Context, manager *internal.Manager, snapshotName string) error {
+	details, err := snapshotInfoDetails(ctx, manager, snapshotName)
+	if err != nil {
+		return err
+	}
+
+	printDetails(details)
+	return nil
+}
+
+func snapshotInfoDetails(ctx context.Context, manager *internal.Manager, snapshotName string) ([]provider.Detail, error) {
+	snapshotDetails, err := manager.GetSnapshotDetails(ctx, snapshotName)
+	if err != nil {
+		return nil, err
+	}
+
+	details := []provider.Detail{
+		{Label: "Snapshot", Value: snapshotName},
+	}
+
+	snapshots, err := manager.ListSnapshots(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing snapshots: %v", err)
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Name == snapshotName {
+			details = append(details,
+				provider.Detail{Label: "Created", Value: ui.FormatAge(snapshot.Age)},
+				provider.Detail{Label: "Size", Value: disk.FormatBytes(snapshot.Size)},
+				provider.Detail{Label: "Size on disk", Value: disk.FormatBytes(snapshot.DiskSize)},
+			)
+			if snapshot.Description != "" {
+				details = append(details, provider.Detail{Label: "Description", Value: snapshot.Description})
+			}
+		}
+	}
+
+	return append(details, snapshotDetails...), nil
+}
+
+func printDetails(details []provider.Detail) {
+	for _, line := range formatDetails(details) {
+		fmt.Println(line)
+	}
+}
+
+// Formats the details as aligned `Label: value` lines
+func formatDetails(details []provider.Detail) []string {
+	width := 0
+	for _, detail := range details {
+		if len(detail.Label) > width {
+			width = len(detail.Label)
+		}
+	}
+
+	lines := make([]string, 0, len(details))
+	for _, detail := range details {
+		lines = append(lines, fmt.Sprintf("%-*s  %s", width+1, detail.Label+":", detail.Value))
+	}
+	return lines
+}
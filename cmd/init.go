@@ -11,6 +11,7 @@ import (
 	"github.com/leonvogt/lunar/internal"
 	"github.com/leonvogt/lunar/internal/provider"
 	"github.com/leonvogt/lunar/internal/provider/postgres"
+	"github.com/leonvogt/lunar/internal/ui"
 	"github.com/spf13/cobra"
 )
 
@@ -43,6 +44,7 @@ func initializeProject() {
 			os.Exit(1)
 		}
 	} else {
+		requirePrompt("--provider")
 		fmt.Println("Welcome to Lunar! Let's get started.")
 		fmt.Println("")
 		providerType = askForProviderType()
@@ -67,6 +69,7 @@ func askForProviderType() provider.ProviderType {
 
 	prompt := selection.New("What type of database do you want to snapshot?", choices)
 	prompt.PageSize = 10
+	prompt.ColorProfile = ui.PromptColorProfile()
 
 	choice, err := prompt.RunPrompt()
 	if err != nil {
@@ -131,7 +134,10 @@ func initializeSQLite(config *internal.Config) {
 }
 
 func askForDatabaseUrl() string {
+	requirePrompt("--database-url")
+
 	input := textinput.New("PostgreSQL URL")
+	input.ColorProfile = ui.PromptColorProfile()
 	input.InitialValue = "postgres://localhost:5432/"
 	input.Placeholder = "PostgreSQL URL cannot be empty"
 
@@ -145,6 +151,7 @@ func askForDatabaseUrl() string {
 }
 
 func askForDatabaseName(databaseUrl string) string {
+	requirePrompt("--database-name")
 	fmt.Println("")
 
 	database, err := postgres.ConnectToMaintenanceDatabaseWithURL(databaseUrl)
@@ -173,6 +180,7 @@ func askForDatabaseName(databaseUrl string) string {
 
 	prompt := selection.New("Please select the database you want to snapshot", filteredDatabaseNames)
 	prompt.PageSize = 50
+	prompt.ColorProfile = ui.PromptColorProfile()
 
 	databaseName, err := prompt.RunPrompt()
 	if err != nil {
@@ -184,10 +192,13 @@ func askForDatabaseName(databaseUrl string) string {
 }
 
 func askForDatabasePath() string {
+	requirePrompt("--database-path")
+
 	// Try to find .db files in current directory as suggestions
 	currentDir, _ := os.Getwd()
 
 	input := textinput.New("Path to SQLite database file (relative to this directory)")
+	input.ColorProfile = ui.PromptColorProfile()
 	input.Placeholder = "e.g., ./myapp.db or data/database.sqlite"
 
 	// Look for existing SQLite files in current directory and common folders
@@ -241,7 +252,14 @@ func askForSnapshotDirectory(databasePath string) string {
 		defaultDir = "./" + defaultDir
 	}
 
+	// The directory has a sensible default, so there's no need to fail without a terminal
+	if ui.CheckPromptable() != nil {
+		fmt.Printf("Storing snapshots in %s (pass --snapshot-directory to change it)\n", defaultDir)
+		return defaultDir
+	}
+
 	input := textinput.New("Directory to store snapshots (relative to this directory)")
+	input.ColorProfile = ui.PromptColorProfile()
 	input.InitialValue = defaultDir
 	input.Placeholder = "Directory path for snapshots"
 
@@ -254,3 +272,12 @@ func askForSnapshotDirectory(databasePath string) string {
 	// Keep as relative path - will be resolved at runtime
 	return snapshotDir
 }
+
+// Exits with a hint about the flag to pass instead if the user can't be prompted,
+// rather than waiting for input that never comes.
+func requirePrompt(flag string) {
+	if err := ui.CheckPromptable(); err != nil {
+		fmt.Printf("Can't ask for the missing settings (%v). Pass %s instead.\n", err, flag)
+		os.Exit(1)
+	}
+}
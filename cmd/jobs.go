@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/leonvogt/lunar/internal"
+	"github.com/leonvogt/lunar/internal/jobs"
+	"github.com/leonvogt/lunar/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var tailLinesFlag int
+var tailFollowFlag bool
+
+var (
+	jobsCmd = &cobra.Command{
+		Use:   "jobs",
+		Short: "List the background jobs Lunar started",
+		Long:  "After creating or restoring a snapshot, Lunar prepares the snapshot for the next restore in the background.\nUse this command to see how these background jobs went.",
+		RunE: func(_ *cobra.Command, args []string) error {
+			return listJobs()
+		},
+	}
+
+	jobsTailCmd = &cobra.Command{
+		Use:   "tail [job]",
+		Short: "Show the log of a background job",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return tailJob(args[0])
+		},
+	}
+
+	jobsRetryCmd = &cobra.Command{
+		Use:   "retry [job]",
+		Short: "Run a background job again",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return retryJob(args[0])
+		},
+	}
+)
+
+func init() {
+	jobsCmd.AddCommand(jobsTailCmd)
+	jobsTailCmd.Flags().IntVarP(&tailLinesFlag, "lines", "n", 20, "Number of lines to show.")
+	jobsTailCmd.Flags().BoolVarP(&tailFollowFlag, "follow", "f", false, "Keep printing new output until the job finished.")
+
+	jobsCmd.AddCommand(jobsRetryCmd)
+}
+
+func withJobStore(operation func(store *jobs.Store, config *internal.Config) error) error {
+	if !internal.DoesConfigExist() {
+		return fmt.Errorf("there seems to be no configuration file. Please run 'lunar init' first")
+	}
+
+	config, err := internal.ReadConfig()
+	if err != nil {
+		return fmt.Errorf("error reading config: %v", err)
+	}
+
+	store, err := openJobStore(config)
+	if err != nil {
+		return err
+	}
+
+	return operation(store, config)
+}
+
+func openJobStore(config *internal.Config) (*jobs.Store, error) {
+	stateDir, err := config.StateDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs.NewStore(filepath.Join(stateDir, "jobs"))
+}
+
+func listJobs() error {
+	return withJobStore(func(store *jobs.Store, config *internal.Config) error {
+		allJobs, err := store.List()
+		if err != nil {
+			return fmt.Errorf("error listing jobs: %v", err)
+		}
+
+		if len(allJobs) == 0 {
+			fmt.Println("No background jobs found.")
+			return nil
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "ID\tKIND\tSNAPSHOT\tSTATUS\tSTARTED\tDURATION")
+		for _, job := range allJobs {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				job.ID, job.Kind, job.Snapshot, job.Status,
+				ui.FormatAge(time.Since(job.StartedAt)), ui.FormatDuration(job.Duration()))
+		}
+		return writer.Flush()
+	})
+}
+
+func tailJob(id string) error {
+	return withJobStore(func(store *jobs.Store, config *internal.Config) error {
+		job, err := store.Get(id)
+		if err != nil {
+			return err
+		}
+
+		logFile, err := os.Open(job.LogFile)
+		if err != nil {
+			return fmt.Errorf("error opening job log: %v", err)
+		}
+		defer logFile.Close()
+
+		if err := printLastLines(logFile, tailLinesFlag); err != nil {
+			return fmt.Errorf("error reading job log: %v", err)
+		}
+
+		for tailFollowFlag && job.Status == jobs.StatusRunning {
+			time.Sleep(500 * time.Millisecond)
+			if _, err := io.Copy(os.Stdout, logFile); err != nil {
+				return fmt.Errorf("error reading job log: %v", err)
+			}
+			if job, err = store.Get(job.ID); err != nil {
+				return err
+			}
+		}
+		// Output written between the last read and the end of the job
+		io.Copy(os.Stdout, logFile)
+
+		if job.Status == jobs.StatusFailed {
+			fmt.Printf("Job failed: %s\n", job.Error)
+		}
+		return nil
+	})
+}
+
+// Prints the last lines of the reader and leaves it positioned at its end
+func printLastLines(reader io.Reader, count int) error {
+	lines := make([]string, 0, count)
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if len(lines) == count {
+			lines = lines[1:]
+		}
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	return nil
+}
+
+func retryJob(id string) error {
+	return withJobStore(func(store *jobs.Store, config *internal.Config) error {
+		job, err := store.Get(id)
+		if err != nil {
+			return err
+		}
+		if job.Status == jobs.StatusRunning {
+			return fmt.Errorf("job %s is still running", job.ID)
+		}
+
+		retried, err := startJob(config, store, job.Kind, job.Snapshot, job.Args)
+		if err != nil {
+			return fmt.Errorf("error retrying job: %v", err)
+		}
+
+		fmt.Printf("Started job %s. Run `lunar jobs tail %s` to follow it.\n", retried.ID, retried.ID)
+		return nil
+	})
+}
+
+// Warns about background jobs that failed since the last command,
+// as nobody would notice otherwise
+func reportFailedJobs(cmd *cobra.Command) {
+	if cmd.Hidden || cmd == jobsCmd || cmd.Parent() == jobsCmd || !internal.DoesConfigExist() {
+		return
+	}
+
+	config, err := internal.ReadConfig()
+	if err != nil {
+		return
+	}
+
+	store, err := openJobStore(config)
+	if err != nil {
+		return
+	}
+
+	failures, err := store.TakeUnreportedFailures()
+	if err != nil {
+		return
+	}
+
+	for _, job := range failures {
+		fmt.Printf("Warning: Background job %s (%s for snapshot %s) failed: %s\n", job.ID, job.Kind, job.Snapshot, job.Error)
+		fmt.Printf("Run `lunar jobs tail %s` for details or `lunar jobs retry %s` to run it again.\n", job.ID, job.ID)
+	}
+}
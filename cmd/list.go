@@ -1,28 +1,79 @@
 package cmd
 
 import (
+	"cmp"
+	"context"
 	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/leonvogt/lunar/internal"
+	"github.com/leonvogt/lunar/internal/disk"
+	"github.com/leonvogt/lunar/internal/provider"
 	"github.com/leonvogt/lunar/internal/ui"
 	"github.com/spf13/cobra"
 )
 
+var listSortFlag string
+var listReverseFlag bool
+var listFilterFlag string
+var listLimitFlag int
+var listAllDatabasesFlag bool
+var listProtectedFlag bool
+
 var (
 	listCmd = &cobra.Command{
 		Use:   "list",
 		Short: "List all snapshots",
-		Run: func(_ *cobra.Command, args []string) {
-			if err := listSnapshots(); err != nil {
-				fmt.Println(err)
-			}
+		Long:  "Lists the snapshots as a table with their age, creation time, size, whether a copy for a fast restore is ready and, with PostgreSQL, whether they are protected, and their description (see `lunar describe`).",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listSnapshots(cmd.Context(), cmd.Flags().Changed("protected"))
 		},
 	}
 )
 
-func listSnapshots() error {
-	return withSnapshotManager(func(manager *internal.Manager, config *internal.Config) error {
-		snapshots, err := manager.ListSnapshots()
+func init() {
+	listCmd.Flags().StringVar(&listSortFlag, "sort", "name", "Sort by name, age (newest first) or size (largest first).")
+	listCmd.Flags().BoolVar(&listReverseFlag, "reverse", false, "Reverse the order.")
+	listCmd.Flags().StringVar(&listFilterFlag, "filter", "", "Only list snapshots matching a glob (e.g. 'feature-*') or a regular expression in slashes (e.g. '/^v[0-9]+$/').")
+	listCmd.Flags().IntVar(&listLimitFlag, "limit", 0, "List at most this many snapshots. Default: no limit.")
+	listCmd.Flags().BoolVar(&listAllDatabasesFlag, "all-databases", false, "List the snapshots of every database on the PostgreSQL server.")
+	listCmd.Flags().BoolVar(&listProtectedFlag, "protected", false, "Only list protected snapshots, or unprotected ones with --protected=false (PostgreSQL only).")
+}
+
+// filterProtected is set if --protected was given, either way
+func listSnapshots(ctx context.Context, filterProtected bool) error {
+	compare, err := snapshotOrder(listSortFlag)
+	if err != nil {
+		return err
+	}
+	matches, err := snapshotFilter(listFilterFlag)
+	if err != nil {
+		return err
+	}
+	if listLimitFlag < 0 {
+		return fmt.Errorf("--limit must not be negative")
+	}
+
+	return withSnapshotManager(ctx, func(ctx context.Context, manager *internal.Manager, config *internal.Config) error {
+		withProtection := config.GetProviderType() == provider.ProviderTypePostgres
+		if filterProtected && !withProtection {
+			return fmt.Errorf("--protected is only supported for PostgreSQL, SQLite snapshots aren't protected")
+		}
+
+		var snapshots []provider.SnapshotInfo
+		var err error
+		if listAllDatabasesFlag {
+			snapshots, err = manager.ListAllSnapshots(ctx)
+		} else {
+			snapshots, err = manager.ListSnapshots(ctx)
+			defer printLegacySnapshots(ctx, manager)
+		}
 		if err != nil {
 			return fmt.Errorf("error listing snapshots: %v", err)
 		}
@@ -32,15 +83,134 @@ func listSnapshots() error {
 			return nil
 		}
 
-		for _, snapshot := range snapshots {
-			ageStr := ui.FormatAge(snapshot.Age)
-			if snapshot.Age == 0 {
-				fmt.Println(snapshot.Name)
-			} else {
-				fmt.Printf("%s (%s)\n", snapshot.Name, ageStr)
-			}
+		snapshots = slices.DeleteFunc(snapshots, func(snapshot provider.SnapshotInfo) bool {
+			return !matches(snapshot.Name) || (filterProtected && snapshot.Protected != listProtectedFlag)
+		})
+		if len(snapshots) == 0 {
+			fmt.Println("No snapshots match the filter.")
+			return nil
 		}
 
-		return nil
+		slices.SortStableFunc(snapshots, compare)
+		if listReverseFlag {
+			slices.Reverse(snapshots)
+		}
+		if listLimitFlag > 0 && len(snapshots) > listLimitFlag {
+			snapshots = snapshots[:listLimitFlag]
+		}
+
+		return printSnapshotTable(snapshots, listAllDatabasesFlag, withProtection)
 	})
 }
+
+// Snapshots of earlier versions of Lunar are only listed, moving them is up to `lunar migrate`
+func printLegacySnapshots(ctx context.Context, manager *internal.Manager) {
+	legacy, err := manager.LegacySnapshots(ctx)
+	if err != nil || len(legacy) == 0 {
+		return
+	}
+	fmt.Printf("\nSnapshots taken by an earlier version of Lunar: %s\nRun `lunar migrate` to move them into your namespace.\n", strings.Join(legacy, ", "))
+}
+
+// Returns how snapshots are ordered for --sort. Snapshots of the same database are kept together.
+func snapshotOrder(sortBy string) (func(a, b provider.SnapshotInfo) int, error) {
+	var compare func(a, b provider.SnapshotInfo) int
+	switch sortBy {
+	case "name":
+		compare = func(a, b provider.SnapshotInfo) int {
+			return strings.Compare(a.Name, b.Name)
+		}
+	case "age":
+		// Snapshots of unknown age (0) go last
+		compare = func(a, b provider.SnapshotInfo) int {
+			if (a.Age == 0) != (b.Age == 0) {
+				if a.Age == 0 {
+					return 1
+				}
+				return -1
+			}
+			return cmp.Compare(a.Age, b.Age)
+		}
+	case "size":
+		compare = func(a, b provider.SnapshotInfo) int {
+			return cmp.Compare(b.Size, a.Size)
+		}
+	default:
+		return nil, fmt.Errorf("unknown sort order %q, must be name, age or size", sortBy)
+	}
+
+	return func(a, b provider.SnapshotInfo) int {
+		return cmp.Or(strings.Compare(a.Database, b.Database), compare(a, b))
+	}, nil
+}
+
+// Returns the matcher for --filter: a regular expression if the filter is enclosed in slashes, a glob otherwise
+func snapshotFilter(filter string) (func(name string) bool, error) {
+	if filter == "" {
+		return func(string) bool { return true }, nil
+	}
+
+	if len(filter) >= 2 && strings.HasPrefix(filter, "/") && strings.HasSuffix(filter, "/") {
+		pattern, err := regexp.Compile(filter[1 : len(filter)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid --filter: %v", err)
+		}
+		return pattern.MatchString, nil
+	}
+
+	if _, err := path.Match(filter, ""); err != nil {
+		return nil, fmt.Errorf("invalid --filter: %v", err)
+	}
+	return func(name string) bool {
+		matched, _ := path.Match(filter, name)
+		return matched
+	}, nil
+}
+
+func printSnapshotTable(snapshots []provider.SnapshotInfo, withDatabase, withProtection bool) error {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "NAME\tAGE\tCREATED\tSIZE\tCOPY READY"
+	if withProtection {
+		header += "\tPROTECTED"
+	}
+	header += "\tDESCRIPTION"
+	if withDatabase {
+		header = "DATABASE\t" + header
+	}
+	fmt.Fprintln(writer, header)
+
+	for _, snapshot := range snapshots {
+		created := "unknown"
+		if snapshot.Age != 0 {
+			created = time.Now().Add(-snapshot.Age).Format("2006-01-02 15:04")
+		}
+
+		size := "unknown"
+		if snapshot.Size > 0 {
+			size = disk.FormatBytes(snapshot.Size)
+			if snapshot.DiskSize != snapshot.Size {
+				size += fmt.Sprintf(" (%s on disk)", disk.FormatBytes(snapshot.DiskSize))
+			}
+		}
+
+		copyReady := yesNo(snapshot.ReadyCopies > 0)
+
+		row := fmt.Sprintf("%s\t%s\t%s\t%s\t%s", snapshot.Name, ui.FormatAge(snapshot.Age), created, size, copyReady)
+		if withProtection {
+			row += "\t" + yesNo(snapshot.Protected)
+		}
+		row += "\t" + snapshot.Description
+		if withDatabase {
+			row = snapshot.Database + "\t" + row
+		}
+		fmt.Fprintln(writer, row)
+	}
+	return writer.Flush()
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
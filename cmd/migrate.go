@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/leonvogt/lunar/internal"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Move snapshots taken by earlier versions of Lunar into your namespace",
+		Long:  "Earlier versions of Lunar named PostgreSQL snapshots without a namespace. This command renames the snapshots of the configured database, and their copies, into your namespace, so that this version finds them. On a shared server the snapshots of every developer were named alike, so only run it if they are yours.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return migrateLegacySnapshots(cmd.Context())
+		},
+	}
+)
+
+func migrateLegacySnapshots(ctx context.Context) error {
+	return withSnapshotManager(ctx, func(ctx context.Context, manager *internal.Manager, config *internal.Config) error {
+		migrated, err := manager.MigrateLegacySnapshots(ctx)
+		for _, warning := range manager.TakeWarnings() {
+			fmt.Printf("Warning: %s\n", warning)
+		}
+		if err != nil {
+			return fmt.Errorf("error moving snapshots: %v", err)
+		}
+
+		if len(migrated) == 0 {
+			fmt.Println("No snapshots of earlier versions of Lunar were moved.")
+			return nil
+		}
+		for _, snapshotName := range migrated {
+			fmt.Printf("Moved snapshot %s into your namespace\n", snapshotName)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/leonvogt/lunar/internal"
+	"github.com/spf13/cobra"
+)
+
+var (
+	protectCmd = &cobra.Command{
+		Use:   "protect [snapshot]",
+		Short: "Protects a snapshot against connections and modifications",
+		Long:  "Marks the snapshot database as a template nobody can connect to. New snapshots are protected already, this protects snapshots taken by earlier versions of Lunar or unprotected with `lunar unprotect`. PostgreSQL only.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return setSnapshotProtection(cmd.Context(), args, true)
+		},
+	}
+
+	unprotectCmd = &cobra.Command{
+		Use:   "unprotect [snapshot]",
+		Short: "Allows connections to a snapshot, e.g. to inspect it",
+		Long:  "Lifts the protection of the snapshot database until `lunar protect` protects it again. Modifications of the snapshot end up in every restore, and copies can't be created while a client is connected. PostgreSQL only.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return setSnapshotProtection(cmd.Context(), args, false)
+		},
+	}
+)
+
+func setSnapshotProtection(ctx context.Context, args []string, protected bool) error {
+	action := "protect"
+	if !protected {
+		action = "unprotect"
+	}
+
+	return withSnapshotManager(ctx, func(ctx context.Context, manager *internal.Manager, config *internal.Config) error {
+		snapshotName, err := getSnapshotNameFromArgsOrPrompt(ctx, args, manager, fmt.Sprintf("Please select a snapshot to %s:", action))
+		if err != nil {
+			return err
+		}
+
+		if err := manager.SetSnapshotProtection(ctx, snapshotName, protected); err != nil {
+			return fmt.Errorf("error changing the protection of snapshot %s: %v", snapshotName, err)
+		}
+
+		fmt.Printf("Snapshot %s %sed\n", snapshotName, action)
+		return nil
+	})
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/leonvogt/lunar/internal"
@@ -12,29 +13,27 @@ var (
 		Use:     "remove [snapshot]",
 		Aliases: []string{"drop", "delete"},
 		Short:   "Removes a snapshot",
-		Run: func(_ *cobra.Command, args []string) {
-			if err := removeSnapshot(args); err != nil {
-				fmt.Println(err)
-			}
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return removeSnapshot(cmd.Context(), args)
 		},
 	}
 )
 
-func removeSnapshot(args []string) error {
-	return withSnapshotManager(func(manager *internal.Manager, config *internal.Config) error {
-		snapshotName, err := getSnapshotNameFromArgsOrPrompt(args, manager, "Please select a snapshot to remove:")
+func removeSnapshot(ctx context.Context, args []string) error {
+	return withSnapshotManager(ctx, func(ctx context.Context, manager *internal.Manager, config *internal.Config) error {
+		snapshotName, err := getSnapshotNameFromArgsOrPrompt(ctx, args, manager, "Please select a snapshot to remove:")
 		if err != nil {
 			return err
 		}
 
-		return removeSnapshotByName(manager, snapshotName)
+		return removeSnapshotByName(ctx, manager, snapshotName)
 	})
 }
 
-func removeSnapshotByName(manager *internal.Manager, snapshotName string) error {
+func removeSnapshotByName(ctx context.Context, manager *internal.Manager, snapshotName string) error {
 	fmt.Printf("Removing snapshot %s...\n", snapshotName)
 
-	if err := manager.RemoveSnapshot(snapshotName); err != nil {
+	if err := manager.RemoveSnapshot(ctx, snapshotName); err != nil {
 		return fmt.Errorf("error removing snapshot: %v", err)
 	}
 
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/leonvogt/lunar/internal"
+	"github.com/spf13/cobra"
+)
+
+var (
+	renameCmd = &cobra.Command{
+		Use:     "rename [snapshot] [new name]",
+		Aliases: []string{"mv"},
+		Short:   "Renames a snapshot",
+		Long:    "Renames the snapshot together with its copies for fast restores. The new name must not be taken by another snapshot.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return renameSnapshot(cmd.Context(), args)
+		},
+	}
+)
+
+func renameSnapshot(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("please provide the snapshot and its new name. Like `lunar rename staging staging-old`")
+	}
+	snapshotName, newName := args[0], args[1]
+
+	return withSnapshotManager(ctx, func(ctx context.Context, manager *internal.Manager, config *internal.Config) error {
+		if err := manager.RenameSnapshot(ctx, snapshotName, newName); err != nil {
+			return fmt.Errorf("error renaming snapshot: %v", err)
+		}
+
+		// `lunar status` refers to the snapshot the database was restored from by name
+		if state, err := config.ReadDatabaseState(manager.GetDatabaseIdentifier()); err == nil && state != nil && state.Snapshot == snapshotName {
+			state.Snapshot = newName
+			if err := config.WriteDatabaseState(manager.GetDatabaseIdentifier(), *state); err != nil {
+				fmt.Printf("Warning: Could not remember the new name for lunar status: %v\n", err)
+			}
+		}
+
+		fmt.Printf("Snapshot %s renamed to %s\n", snapshotName, newName)
+		return nil
+	})
+}
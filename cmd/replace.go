@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/leonvogt/lunar/internal"
+	"github.com/leonvogt/lunar/internal/provider"
 	"github.com/leonvogt/lunar/internal/ui"
 	"github.com/spf13/cobra"
 )
@@ -12,46 +14,40 @@ var (
 	replaceCmd = &cobra.Command{
 		Use:   "replace [snapshot]",
 		Short: "Replaces a snapshot (Delete previously existing snapshot and create a new one with the same name)",
-		Run: func(_ *cobra.Command, args []string) {
-			if err := replaceSnapshot(args); err != nil {
-				fmt.Println(err)
-			}
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return replaceSnapshot(cmd.Context(), args)
 		},
 	}
 )
 
-func replaceSnapshot(args []string) error {
-	return withSnapshotManager(func(manager *internal.Manager, config *internal.Config) error {
-		snapshotName, err := getSnapshotNameFromArgsOrPrompt(args, manager, "Please select a snapshot to replace:")
+func replaceSnapshot(ctx context.Context, args []string) error {
+	return withSnapshotManager(ctx, func(ctx context.Context, manager *internal.Manager, config *internal.Config) error {
+		snapshotName, err := getSnapshotNameFromArgsOrPrompt(ctx, args, manager, "Please select a snapshot to replace:")
 		if err != nil {
 			return err
 		}
 
-		if manager.IsWaitingForOperation() {
-			stopWaitSpinner := ui.StartSpinner("Currently there is a Lunar background operation running. Waiting for it to complete before replacing the snapshot...")
-			if err := manager.WaitForOngoingOperations(); err != nil {
-				stopWaitSpinner()
-				return fmt.Errorf("failed to wait for ongoing operation: %v", err)
-			}
-			stopWaitSpinner()
+		// Check and wait for any ongoing operations
+		if err := waitForOngoingOperations(ctx, manager, "Waiting for it to complete before replacing the snapshot..."); err != nil {
+			return err
 		}
 
 		message := fmt.Sprintf("Replacing snapshot %s for database %s", snapshotName, manager.GetDatabaseIdentifier())
-		setInfo, stopSpinner := ui.StartDynamicSpinner(message)
-
-		if size, err := manager.GetDatabaseSize(); err == nil && size > 0 {
-			setInfo(ui.FormatBytes(size))
-		}
+		size, _ := manager.GetDatabaseSize(ctx)
+		expected := config.EstimateSnapshotDuration(manager.GetDatabaseIdentifier(), size)
+		addProgress, stopSpinner := ui.StartProgressSpinner(message, size, expected)
 
-		if err := manager.ReplaceSnapshot(snapshotName); err != nil {
+		if err := manager.ReplaceSnapshot(provider.WithProgress(ctx, addProgress), snapshotName); err != nil {
 			stopSpinner()
 			return fmt.Errorf("error replacing snapshot: %v", err)
 		}
 
 		elapsed := stopSpinner()
 		fmt.Printf("Snapshot replaced successfully in %s\n", ui.FormatDuration(elapsed))
+		config.RecordSnapshotDuration(manager.GetDatabaseIdentifier(), size, elapsed)
+		rememberDatabaseState(ctx, manager, config, "snapshot", snapshotName)
 
-		if err := spawnBackgroundCommand("snapshot", "create-copy", snapshotName); err != nil {
+		if err := spawnBackgroundJob(config, snapshotName, "snapshot", "create-copy"); err != nil {
 			fmt.Printf("Warning: Could not prepare snapshot for fast restore: %v\n", err)
 		}
 
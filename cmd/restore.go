@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/leonvogt/lunar/internal"
@@ -12,18 +13,18 @@ var (
 	restoreCmd = &cobra.Command{
 		Use:   "restore [snapshot]",
 		Short: "Restore a snapshot of your database",
-		Run: func(_ *cobra.Command, args []string) {
-			if err := restoreSnapshot(args); err != nil {
-				fmt.Println(err)
-			}
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return restoreSnapshot(cmd.Context(), args)
 		},
 	}
 
 	recreateCopyCmd = &cobra.Command{
 		Use:    "recreate-copy",
 		Hidden: true,
-		Run: func(_ *cobra.Command, args []string) {
-			recreateSnapshotCopy(args)
+		Run: func(cmd *cobra.Command, args []string) {
+			runBackgroundJob(func() error {
+				return recreateSnapshotCopy(cmd.Context(), args)
+			})
 		},
 	}
 )
@@ -32,40 +33,43 @@ func init() {
 	restoreCmd.AddCommand(recreateCopyCmd)
 }
 
-func restoreSnapshot(args []string) error {
-	return withSnapshotManager(func(manager *internal.Manager, config *internal.Config) error {
-		snapshotName, err := getSnapshotNameFromArgsOrPrompt(args, manager, "Please select a snapshot to restore:")
+func restoreSnapshot(ctx context.Context, args []string) error {
+	return withSnapshotManager(ctx, func(ctx context.Context, manager *internal.Manager, config *internal.Config) error {
+		snapshotName, err := getSnapshotNameFromArgsOrPrompt(ctx, args, manager, "Please select a snapshot to restore:")
 		if err != nil {
 			return err
 		}
 
 		// Check and wait for any ongoing operations
-		if manager.IsWaitingForOperation() {
-			stopWaitSpinner := ui.StartSpinner("Currently there is a Lunar background operation running. Waiting for it to complete before restoring the snapshot...")
-			if err := manager.WaitForOngoingOperations(); err != nil {
-				stopWaitSpinner()
-				return fmt.Errorf("failed to wait for ongoing operation: %v", err)
-			}
-			stopWaitSpinner()
+		if err := waitForOngoingOperations(ctx, manager, "Waiting for it to complete before restoring the snapshot..."); err != nil {
+			return err
+		}
+
+		if err := prepareSnapshotCopy(ctx, manager, snapshotName); err != nil {
+			return err
 		}
 
 		message := fmt.Sprintf("Restoring snapshot %s for database %s", snapshotName, manager.GetDatabaseIdentifier())
 		stopSpinner := ui.StartSpinner(message)
 
-		if err := manager.RestoreSnapshot(snapshotName); err != nil {
-			stopSpinner()
+		err = manager.RestoreSnapshot(ctx, snapshotName)
+		stopSpinner()
+		for _, warning := range manager.TakeWarnings() {
+			fmt.Printf("Warning: %s\n", warning)
+		}
+		if err != nil {
 			return fmt.Errorf("error restoring snapshot: %v", err)
 		}
 
-		stopSpinner()
 		fmt.Println("Snapshot restored successfully")
+		rememberDatabaseState(ctx, manager, config, "restore", snapshotName)
 
-		if err := spawnBackgroundCommand("restore", "recreate-copy", snapshotName); err != nil {
+		if err := spawnBackgroundJob(config, snapshotName, "restore", "recreate-copy"); err != nil {
 			fmt.Printf("Warning: Could not prepare snapshot for next restore: %v\n", err)
 		}
 
 		if config.AfterRestoreCommand != "" {
-			if err := runHookCommand("after_restore_command", config.AfterRestoreCommand, config.ConfigDir()); err != nil {
+			if err := runHookCommand(ctx, "after_restore_command", config.AfterRestoreCommand, config.ConfigDir()); err != nil {
 				return fmt.Errorf("snapshot was restored, but %v", err)
 			}
 		}
@@ -74,22 +78,40 @@ func restoreSnapshot(args []string) error {
 	})
 }
 
-func recreateSnapshotCopy(args []string) {
-	if len(args) != 1 {
-		return
+// Restoring swaps in a copy that is prepared in the background. If none is ready,
+// waits for the background process or builds the copy synchronously.
+func prepareSnapshotCopy(ctx context.Context, manager *internal.Manager, snapshotName string) error {
+	readyCopies, err := manager.ReadySnapshotCopies(ctx, snapshotName)
+	if err != nil {
+		return fmt.Errorf("error checking snapshot copies: %v", err)
+	}
+	if readyCopies > 0 {
+		return nil
 	}
 
-	snapshotName := args[0]
-	config, err := internal.ReadConfig()
-	if err != nil {
-		return
+	message := "The snapshot is not prepared for a fast restore yet. Preparing it now..."
+	if manager.IsSnapshotInProgress(ctx, snapshotName) {
+		message = "The snapshot is still being prepared for restoring. Waiting for it to complete..."
 	}
 
-	snapshotManager, err := internal.NewSnapshotManager(config)
-	if err != nil {
-		return
+	stopSpinner := ui.StartSpinner(message)
+	defer stopSpinner()
+
+	if err := manager.EnsureSnapshotCopy(ctx, snapshotName); err != nil {
+		return fmt.Errorf("failed to prepare snapshot for restoring: %v", err)
+	}
+	return nil
+}
+
+func recreateSnapshotCopy(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("please provide the name of the snapshot to copy")
 	}
-	defer snapshotManager.Close()
 
-	snapshotManager.CreateSnapshotCopy(snapshotName)
+	return withSnapshotManager(ctx, func(ctx context.Context, manager *internal.Manager, config *internal.Config) error {
+		if err := manager.CreateSnapshotCopy(ctx, args[0]); err != nil {
+			return fmt.Errorf("error recreating snapshot copy: %v", err)
+		}
+		return nil
+	})
 }
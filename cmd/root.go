@@ -1,8 +1,14 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/leonvogt/lunar/internal/ui"
 	"github.com/spf13/cobra"
 )
 
@@ -11,22 +17,78 @@ var databaseNameFlag string
 var databasePathFlag string
 var snapshotDirectoryFlag string
 var providerFlag string
+var timeoutFlag time.Duration
+var lockTimeoutFlag time.Duration
+var quietFlag bool
+var noInputFlag bool
 
 var rootCmd = &cobra.Command{
 	Use:     "lunar",
 	Version: "0.2.1",
 	Short:   "A database snapshot tool for PostgreSQL and SQLite databases.",
 	Long:    "Use Lunar to create and restore database snapshots for PostgreSQL and SQLite databases. \nRun 'lunar --help' for more information.",
+	// Execute prints the errors of commands, so that scripts can rely on the exit code
+	SilenceErrors: true,
+	PersistentPreRun: func(cmd *cobra.Command, _ []string) {
+		// The usage only helps with wrong arguments and flags, not with failed operations
+		cmd.SilenceUsage = true
+		ui.Configure(quietFlag, noInputFlag)
+		reportFailedJobs(cmd)
+	},
 }
 
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, cancel := interruptibleContext()
+	defer cancel()
+
+	err := rootCmd.ExecuteContext(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if ctx.Err() != nil {
+		os.Exit(130)
+	}
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// Returns a context that is cancelled on the first Ctrl-C (or SIGTERM), so that running
+// operations can stop and clean up after themselves. A second Ctrl-C exits immediately.
+func interruptibleContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	interrupt := func() {
+		if ctx.Err() != nil {
+			os.Exit(130)
+		}
+		fmt.Fprintln(os.Stderr, "\nInterrupted, cleaning up... (press Ctrl-C again to exit immediately)")
+		cancel()
+	}
+
+	ui.SetInterruptHandler(interrupt)
+
+	go func() {
+		for range signals {
+			interrupt()
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
 func init() {
+	rootCmd.PersistentFlags().DurationVar(&timeoutFlag, "timeout", 0, "Abort the command if it takes longer than this (e.g. 10m). Default: no limit.")
+	rootCmd.PersistentFlags().BoolVarP(&quietFlag, "quiet", "q", false, "Don't show spinners and progress, only results, warnings and errors.")
+	rootCmd.PersistentFlags().BoolVar(&noInputFlag, "no-input", false, "Never prompt; fail if a value is missing instead. Implied when not running in a terminal.")
+	rootCmd.PersistentFlags().DurationVar(&lockTimeoutFlag, "lock-timeout", 30*time.Minute, "How long to wait for other Lunar operations on the same database to complete.")
+
 	rootCmd.AddCommand(initCmd)
 	initCmd.Flags().StringVar(&providerFlag, "provider", "", "Database provider to use: 'postgres' or 'sqlite'.")
 	initCmd.Flags().StringVarP(&databaseUrlFlag, "database-url", "u", "", "The connection URL to your PostgreSQL database.")
@@ -39,4 +101,16 @@ func init() {
 	rootCmd.AddCommand(restoreCmd)
 	rootCmd.AddCommand(removeCmd)
 	rootCmd.AddCommand(replaceCmd)
+	rootCmd.AddCommand(renameCmd)
+	rootCmd.AddCommand(describeCmd)
+	rootCmd.AddCommand(infoCmd)
+	rootCmd.AddCommand(jobsCmd)
+	rootCmd.AddCommand(unlockCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(protectCmd)
+	rootCmd.AddCommand(unprotectCmd)
+	rootCmd.AddCommand(migrateCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(tuiCmd)
 }
@@ -1,82 +1,89 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/leonvogt/lunar/internal"
+	"github.com/leonvogt/lunar/internal/provider"
 	"github.com/leonvogt/lunar/internal/ui"
 	"github.com/spf13/cobra"
 )
 
+var snapshotDescriptionFlag string
+
 var (
 	snapshotCmd = &cobra.Command{
 		Use:     "snapshot",
 		Aliases: []string{"snap"},
 		Short:   "Create a snapshot of your database",
-		Run: func(_ *cobra.Command, args []string) {
-			if err := createSnapshot(args); err != nil {
-				fmt.Println(err)
-			}
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return createSnapshot(cmd.Context(), args)
 		},
 	}
 
 	createCopyCmd = &cobra.Command{
 		Use:    "create-copy",
 		Hidden: true,
-		Run: func(_ *cobra.Command, args []string) {
-			createSnapshotCopy(args)
+		Run: func(cmd *cobra.Command, args []string) {
+			runBackgroundJob(func() error {
+				return createSnapshotCopy(cmd.Context(), args)
+			})
 		},
 	}
 )
 
 func init() {
+	snapshotCmd.Flags().StringVar(&snapshotDescriptionFlag, "description", "", "Describe the snapshot, see `lunar describe`.")
 	snapshotCmd.AddCommand(createCopyCmd)
 }
 
-func createSnapshot(args []string) error {
+func createSnapshot(ctx context.Context, args []string) error {
 	if len(args) != 1 {
 		return fmt.Errorf("please provide a name for the snapshot. Like `lunar snapshot production` or `lunar snapshot staging`")
 	}
 
 	snapshotName := args[0]
 
-	return withSnapshotManager(func(manager *internal.Manager, config *internal.Config) error {
-		if err := manager.CheckIfSnapshotCanBeTaken(snapshotName); err != nil {
+	return withSnapshotManager(ctx, func(ctx context.Context, manager *internal.Manager, config *internal.Config) error {
+		if err := manager.CheckIfSnapshotCanBeTaken(ctx, snapshotName); err != nil {
 			return err
 		}
 
 		// Check and wait for any ongoing operations
-		if manager.IsWaitingForOperation() {
-			stopWaitSpinner := ui.StartSpinner("Currently there is a Lunar background operation running. Waiting for it to complete before creating the snapshot...")
-			if err := manager.WaitForOngoingOperations(); err != nil {
-				stopWaitSpinner()
-				return fmt.Errorf("failed to wait for ongoing operation: %v", err)
-			}
-			stopWaitSpinner()
+		if err := waitForOngoingOperations(ctx, manager, "Waiting for it to complete before creating the snapshot..."); err != nil {
+			return err
 		}
 
 		if config.BeforeSnapshotCommand != "" {
-			if err := runHookCommand("before_snapshot_command", config.BeforeSnapshotCommand, config.ConfigDir()); err != nil {
+			if err := runHookCommand(ctx, "before_snapshot_command", config.BeforeSnapshotCommand, config.ConfigDir()); err != nil {
 				return fmt.Errorf("snapshot aborted: %v", err)
 			}
 		}
 
 		message := fmt.Sprintf("Creating a snapshot for the database %s", manager.GetDatabaseIdentifier())
-		setInfo, stopSpinner := ui.StartDynamicSpinner(message)
+		size, _ := manager.GetDatabaseSize(ctx)
+		expected := config.EstimateSnapshotDuration(manager.GetDatabaseIdentifier(), size)
+		addProgress, stopSpinner := ui.StartProgressSpinner(message, size, expected)
 
-		if size, err := manager.GetDatabaseSize(); err == nil && size > 0 {
-			setInfo(ui.FormatBytes(size))
-		}
-
-		if err := manager.CreateMainSnapshot(snapshotName); err != nil {
+		if err := manager.CreateMainSnapshot(provider.WithProgress(ctx, addProgress), snapshotName); err != nil {
 			stopSpinner()
 			return fmt.Errorf("error creating snapshot: %v", err)
 		}
 
 		elapsed := stopSpinner()
 		fmt.Printf("Snapshot created successfully in %s\n", ui.FormatDuration(elapsed))
+		config.RecordSnapshotDuration(manager.GetDatabaseIdentifier(), size, elapsed)
+		rememberDatabaseState(ctx, manager, config, "snapshot", snapshotName)
+
+		// Before the background job starts, which holds the snapshot lock while it creates copies
+		if snapshotDescriptionFlag != "" {
+			if err := manager.SetSnapshotDescription(ctx, snapshotName, snapshotDescriptionFlag); err != nil {
+				fmt.Printf("Warning: Could not store the description: %v\n", err)
+			}
+		}
 
-		if err := spawnBackgroundCommand("snapshot", "create-copy", snapshotName); err != nil {
+		if err := spawnBackgroundJob(config, snapshotName, "snapshot", "create-copy"); err != nil {
 			fmt.Printf("Warning: Could not prepare snapshot for fast restore: %v\n", err)
 		}
 
@@ -84,22 +91,15 @@ func createSnapshot(args []string) error {
 	})
 }
 
-func createSnapshotCopy(args []string) {
+func createSnapshotCopy(ctx context.Context, args []string) error {
 	if len(args) != 1 {
-		return
+		return fmt.Errorf("please provide the name of the snapshot to copy")
 	}
 
-	snapshotName := args[0]
-	config, err := internal.ReadConfig()
-	if err != nil {
-		return
-	}
-
-	snapshotManager, err := internal.NewSnapshotManager(config)
-	if err != nil {
-		return
-	}
-	defer snapshotManager.Close()
-
-	snapshotManager.CreateSnapshotCopy(snapshotName)
+	return withSnapshotManager(ctx, func(ctx context.Context, manager *internal.Manager, config *internal.Config) error {
+		if err := manager.CreateSnapshotCopy(ctx, args[0]); err != nil {
+			return fmt.Errorf("error preparing snapshot copy: %v", err)
+		}
+		return nil
+	})
 }
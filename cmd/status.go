@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/leonvogt/lunar/internal"
+	"github.com/leonvogt/lunar/internal/disk"
+	"github.com/leonvogt/lunar/internal/jobs"
+	"github.com/leonvogt/lunar/internal/provider"
+	"github.com/leonvogt/lunar/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Show an overview of the database, its snapshots, jobs and locks",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return showStatus(cmd.Context())
+		},
+	}
+)
+
+// Unlike the other commands, status also reports what it can when the database is unreachable
+func showStatus(ctx context.Context) error {
+	if !internal.DoesConfigExist() {
+		return fmt.Errorf("there seems to be no configuration file. Please run 'lunar init' first")
+	}
+
+	config, err := internal.ReadConfig()
+	if err != nil {
+		return fmt.Errorf("error reading config: %v", err)
+	}
+
+	details := []provider.Detail{
+		{Label: "Config", Value: config.ConfigPath()},
+		{Label: "Provider", Value: string(config.GetProviderType())},
+		{Label: "Database", Value: config.GetDatabaseIdentifier()},
+	}
+
+	var snapshots []provider.SnapshotInfo
+	manager, err := internal.NewSnapshotManager(config)
+	if err != nil {
+		details = append(details, provider.Detail{Label: "Connection", Value: fmt.Sprintf("failed, %v", err)})
+	} else {
+		defer manager.Close()
+		details = append(details, provider.Detail{Label: "Connection", Value: "ok"})
+		details = append(details, databaseStatusDetails(ctx, manager, config)...)
+
+		snapshots, err = manager.ListSnapshots(ctx)
+		if err != nil {
+			details = append(details, provider.Detail{Label: "Snapshots", Value: fmt.Sprintf("unknown (%v)", err)})
+		} else {
+			details = append(details, provider.Detail{Label: "Snapshots", Value: describeSnapshots(snapshots)})
+		}
+	}
+
+	runningJobs, err := listRunningJobs(config)
+	if err != nil {
+		details = append(details, provider.Detail{Label: "Jobs", Value: fmt.Sprintf("unknown (%v)", err)})
+	} else {
+		details = append(details, provider.Detail{Label: "Jobs", Value: describeRunningJobs(runningJobs)})
+	}
+
+	if manager != nil {
+		details = append(details, provider.Detail{Label: "Locks", Value: describeLocks(ctx, manager)})
+	}
+
+	printDetails(details)
+
+	if len(snapshots) > 0 {
+		fmt.Println()
+		printSnapshotReadiness(snapshots, runningJobs, config.GetWarmCopies())
+	}
+	return nil
+}
+
+func databaseStatusDetails(ctx context.Context, manager *internal.Manager, config *internal.Config) []provider.Detail {
+	var details []provider.Detail
+	if size, err := manager.GetDatabaseSize(ctx); err == nil {
+		details = append(details, provider.Detail{Label: "Database size", Value: disk.FormatBytes(size)})
+	}
+	return append(details, provider.Detail{Label: "State", Value: describeDatabaseState(ctx, manager, config)})
+}
+
+func describeDatabaseState(ctx context.Context, manager *internal.Manager, config *internal.Config) string {
+	state, err := config.ReadDatabaseState(manager.GetDatabaseIdentifier())
+	if err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+	if state == nil {
+		return "unknown, no snapshot was taken or restored yet"
+	}
+
+	since := fmt.Sprintf("restore of %s", state.Snapshot)
+	if state.Action == "snapshot" {
+		since = fmt.Sprintf("snapshot %s was taken", state.Snapshot)
+	}
+	since += fmt.Sprintf(" (%s)", ui.FormatAge(time.Since(state.At)))
+
+	fingerprint, err := manager.DatabaseFingerprint(ctx)
+	if err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+	if fingerprint != state.Fingerprint {
+		return "modified since " + since
+	}
+	return "clean since " + since
+}
+
+func describeSnapshots(snapshots []provider.SnapshotInfo) string {
+	if len(snapshots) == 0 {
+		return "none"
+	}
+
+	var size, diskSize int64
+	for _, snapshot := range snapshots {
+		size += snapshot.Size
+		diskSize += snapshot.DiskSize
+	}
+	return fmt.Sprintf("%d (%s, %s on disk)", len(snapshots), disk.FormatBytes(size), disk.FormatBytes(diskSize))
+}
+
+func listRunningJobs(config *internal.Config) ([]*jobs.Job, error) {
+	store, err := openJobStore(config)
+	if err != nil {
+		return nil, err
+	}
+
+	allJobs, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var running []*jobs.Job
+	for _, job := range allJobs {
+		if job.Status == jobs.StatusRunning {
+			running = append(running, job)
+		}
+	}
+	return running, nil
+}
+
+func describeRunningJobs(runningJobs []*jobs.Job) string {
+	if len(runningJobs) == 0 {
+		return "none running"
+	}
+
+	descriptions := make([]string, 0, len(runningJobs))
+	for _, job := range runningJobs {
+		descriptions = append(descriptions, fmt.Sprintf("%s %s for %s (%s)", job.ID, job.Kind, job.Snapshot, ui.FormatDuration(job.Duration())))
+	}
+	return fmt.Sprintf("%d running: %s", len(runningJobs), strings.Join(descriptions, ", "))
+}
+
+func describeLocks(ctx context.Context, manager *internal.Manager) string {
+	holders, err := manager.LockHolders(ctx)
+	if err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+	if len(holders) == 0 {
+		return "none held"
+	}
+
+	descriptions := make([]string, 0, len(holders))
+	for _, holder := range holders {
+		description := fmt.Sprintf("%s by %s", holder.Lock, holder)
+		if holder.IsDead() {
+			description += ", which died (run `lunar unlock`)"
+		}
+		descriptions = append(descriptions, description)
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// Prints for every snapshot whether copies for fast restores are ready or being prepared
+func printSnapshotReadiness(snapshots []provider.SnapshotInfo, runningJobs []*jobs.Job, warmCopies int) {
+	preparing := make(map[string]bool)
+	for _, job := range runningJobs {
+		preparing[job.Snapshot] = true
+	}
+
+	details := make([]provider.Detail, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		details = append(details, provider.Detail{Label: "Snapshot " + snapshot.Name, Value: describeReadiness(snapshot, preparing[snapshot.Name], warmCopies)})
+	}
+	printDetails(details)
+}
+
+func describeReadiness(snapshot provider.SnapshotInfo, preparing bool, warmCopies int) string {
+	readiness := fmt.Sprintf("%d of %d copies ready", snapshot.ReadyCopies, warmCopies)
+	if preparing {
+		readiness += ", preparing"
+	} else if snapshot.ReadyCopies == 0 {
+		readiness += ", the next restore is slower"
+	}
+	return readiness
+}
+
+// Remembers that the database matches the snapshot after it was taken or restored, see `lunar status`
+func rememberDatabaseState(ctx context.Context, manager *internal.Manager, config *internal.Config, action, snapshotName string) {
+	fingerprint, err := manager.DatabaseFingerprint(ctx)
+	if err == nil {
+		err = config.WriteDatabaseState(manager.GetDatabaseIdentifier(), internal.DatabaseState{
+			Snapshot:    snapshotName,
+			Action:      action,
+			At:          time.Now(),
+			Fingerprint: fingerprint,
+		})
+	}
+	if err != nil {
+		fmt.Printf("Warning: Could not remember the state of the database: %v\n", err)
+	}
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/leonvogt/lunar/internal"
+	"github.com/leonvogt/lunar/internal/provider"
+	"github.com/leonvogt/lunar/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tuiCmd = &cobra.Command{
+		Use:   "tui",
+		Short: "Browse and manage snapshots in an interactive dashboard",
+		Long:  "Lists the snapshots with their age, size, fast restore copies and description, shows the details of the selected one and restores, replaces, verifies, renames, describes, protects, unprotects (PostgreSQL only) or removes it with a key press. The dashboard updates itself while background jobs run. Snapshots can't be diffed yet.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDashboard(cmd.Context())
+		},
+	}
+)
+
+func runDashboard(ctx context.Context) error {
+	if err := ui.CheckPromptable(); err != nil {
+		return fmt.Errorf("lunar tui needs a terminal (%v), use the other commands in scripts", err)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not find executable: %v", err)
+	}
+
+	return withSnapshotManager(ctx, func(ctx context.Context, manager *internal.Manager, config *internal.Config) error {
+		// Actions run as separate Lunar processes, so they take the same locks, run the same
+		// hooks and start the same background jobs as on the command line
+		lunarCommand := func(command string) func(snapshot, input string) *exec.Cmd {
+			return func(snapshot, input string) *exec.Cmd {
+				args := []string{command, "--no-input", "--", snapshot}
+				if input != "" {
+					args = append(args, input)
+				}
+				return exec.Command(executable, args...)
+			}
+		}
+
+		actions := []ui.DashboardAction{
+			{Key: "r", Name: "restore", Command: lunarCommand("restore")},
+			{Key: "R", Name: "replace", Confirm: true, Command: lunarCommand("replace")},
+			{Key: "v", Name: "verify", Command: lunarCommand("verify")},
+			{Key: "n", Name: "rename", Prompt: "New name", Command: lunarCommand("rename")},
+			{Key: "d", Name: "describe", Prompt: "Description", Command: lunarCommand("describe")},
+		}
+		if config.GetProviderType() == provider.ProviderTypePostgres {
+			actions = append(actions,
+				ui.DashboardAction{Key: "p", Name: "protect", Command: lunarCommand("protect")},
+				ui.DashboardAction{Key: "u", Name: "unprotect", Confirm: true, Command: lunarCommand("unprotect")},
+			)
+		}
+		actions = append(actions, ui.DashboardAction{Key: "x", Name: "remove", Confirm: true, Command: lunarCommand("remove")})
+
+		return ui.RunDashboard(ctx, ui.Dashboard{
+			Title: fmt.Sprintf("Lunar · %s (%s)", manager.GetDatabaseIdentifier(), config.GetProviderType()),
+			Load: func() ([]ui.DashboardSnapshot, []string, error) {
+				return loadDashboard(ctx, manager, config)
+			},
+			Details: func(snapshot string) ([]string, error) {
+				details, err := snapshotInfoDetails(ctx, manager, snapshot)
+				return formatDetails(details), err
+			},
+			Actions: actions,
+		})
+	})
+}
+
+func loadDashboard(ctx context.Context, manager *internal.Manager, config *internal.Config) ([]ui.DashboardSnapshot, []string, error) {
+	snapshots, err := manager.ListSnapshots(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing snapshots: %v", err)
+	}
+
+	status := databaseStatusDetails(ctx, manager, config)
+	runningJobs, err := listRunningJobs(config)
+	if err != nil {
+		status = append(status, provider.Detail{Label: "Jobs", Value: fmt.Sprintf("unknown (%v)", err)})
+	} else {
+		status = append(status, provider.Detail{Label: "Jobs", Value: describeRunningJobs(runningJobs)})
+	}
+
+	preparing := make(map[string]bool)
+	for _, job := range runningJobs {
+		preparing[job.Snapshot] = true
+	}
+
+	rows := make([]ui.DashboardSnapshot, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		rows = append(rows, ui.DashboardSnapshot{
+			Name:        snapshot.Name,
+			Age:         snapshot.Age,
+			Size:        snapshot.Size,
+			Copies:      describeReadiness(snapshot, preparing[snapshot.Name], config.GetWarmCopies()),
+			Description: snapshot.Description,
+		})
+	}
+	return rows, formatDetails(status), nil
+}
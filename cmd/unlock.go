@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/leonvogt/lunar/internal"
+	"github.com/spf13/cobra"
+)
+
+var (
+	unlockCmd = &cobra.Command{
+		Use:   "unlock",
+		Short: "Release locks of Lunar processes that died",
+		Long:  "Lunar locks the database while working on it. If a Lunar process dies without releasing its locks, other Lunar commands wait forever.\nThis command releases locks whose holder process is gone. Locks of running processes or of processes on other hosts are only listed, and a lock that is still taken is never released.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return unlock(cmd.Context())
+		},
+	}
+)
+
+func unlock(ctx context.Context) error {
+	return withSnapshotManager(ctx, func(ctx context.Context, manager *internal.Manager, config *internal.Config) error {
+		holders, err := manager.LockHolders(ctx)
+		if err != nil {
+			return fmt.Errorf("error looking up locks: %v", err)
+		}
+
+		if len(holders) == 0 {
+			fmt.Println("No locks are held.")
+			return nil
+		}
+
+		for _, holder := range holders {
+			if !holder.IsDead() {
+				fmt.Printf("The %s lock is held by %s, which is still running or can't be checked from this host.\n", holder.Lock, holder)
+				continue
+			}
+
+			if err := manager.BreakLock(ctx, holder); err != nil {
+				return fmt.Errorf("error releasing %s lock: %v", holder.Lock, err)
+			}
+			fmt.Printf("Released the %s lock held by %s.\n", holder.Lock, holder)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/leonvogt/lunar/internal"
+	"github.com/leonvogt/lunar/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var verifyAllFlag bool
+
+var (
+	verifyCmd = &cobra.Command{
+		Use:   "verify [snapshot]",
+		Short: "Check snapshots for modifications and damage",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return verifySnapshots(cmd.Context(), args)
+		},
+	}
+)
+
+func init() {
+	verifyCmd.Flags().BoolVar(&verifyAllFlag, "all", false, "Verify all snapshots")
+}
+
+func verifySnapshots(ctx context.Context, args []string) error {
+	return withSnapshotManager(ctx, func(ctx context.Context, manager *internal.Manager, config *internal.Config) error {
+		var snapshotNames []string
+		if verifyAllFlag {
+			snapshots, err := manager.ListSnapshots(ctx)
+			if err != nil {
+				return fmt.Errorf("error listing snapshots: %v", err)
+			}
+			for _, snapshot := range snapshots {
+				snapshotNames = append(snapshotNames, snapshot.Name)
+			}
+		} else {
+			snapshotName, err := getSnapshotNameFromArgsOrPrompt(ctx, args, manager, "Please select a snapshot to verify:")
+			if err != nil {
+				return err
+			}
+			snapshotNames = []string{snapshotName}
+		}
+
+		failed := 0
+		for _, snapshotName := range snapshotNames {
+			ok, err := verifySnapshot(ctx, manager, snapshotName)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d snapshots failed verification", failed, len(snapshotNames))
+		}
+		return nil
+	})
+}
+
+func verifySnapshot(ctx context.Context, manager *internal.Manager, snapshotName string) (bool, error) {
+	if err := manager.WaitForOngoingSnapshot(ctx, snapshotName); err != nil {
+		return false, err
+	}
+
+	stopSpinner := ui.StartSpinner(fmt.Sprintf("Verifying snapshot %s", snapshotName))
+	problems, err := manager.VerifySnapshot(ctx, snapshotName)
+	stopSpinner()
+	if err != nil {
+		return false, fmt.Errorf("error verifying snapshot %s: %v", snapshotName, err)
+	}
+
+	if len(problems) == 0 {
+		fmt.Printf("Snapshot %s is intact\n", snapshotName)
+		return true, nil
+	}
+
+	fmt.Printf("Snapshot %s:\n", snapshotName)
+	for _, problem := range problems {
+		fmt.Printf("  - %s\n", problem)
+	}
+	return false, nil
+}
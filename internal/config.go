@@ -1,9 +1,14 @@
 package internal
 
 import (
+	"fmt"
 	"os"
+	"os/user"
 	"path/filepath"
+	"regexp"
+	"strings"
 
+	"github.com/leonvogt/lunar/internal/disk"
 	"github.com/leonvogt/lunar/internal/provider"
 	"gopkg.in/yaml.v3"
 )
@@ -12,6 +17,8 @@ const (
 	CONFIG_PATH = "lunar.yml"
 )
 
+var invalidNamespaceCharacters = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
 type Config struct {
 	// Provider type: "postgres" (default) or "sqlite"
 	ProviderType provider.ProviderType `yaml:"provider,omitempty"`
@@ -20,10 +27,37 @@ type Config struct {
 	DatabaseUrl         string `yaml:"database_url,omitempty"`
 	DatabaseName        string `yaml:"database,omitempty"`
 	MaintenanceDatabase string `yaml:"maintenance_database,omitempty"`
+	// Keeps the snapshots of several users apart on a shared server (default: OS user)
+	Namespace string `yaml:"namespace,omitempty"`
+	// What happens to clients connected to a database Lunar copies, drops or renames:
+	// "terminate" (default), "drain" or "fail"
+	ConnectionStrategy string `yaml:"connection_strategy,omitempty"`
+	// Seconds the "drain" strategy waits for sessions to become idle (default: 30)
+	DrainTimeout int `yaml:"drain_timeout,omitempty"`
+	// How CREATE DATABASE copies the database: "auto" (default), "file_copy" or "wal_log"
+	CreateStrategy string `yaml:"create_strategy,omitempty"`
+	// Tablespace for snapshot databases, e.g. on a separate disk (default: the database's tablespace)
+	SnapshotTablespace string `yaml:"snapshot_tablespace,omitempty"`
+	// Store the roles used by the database with snapshots and recreate missing ones on restore (default: false)
+	IncludeRoles bool `yaml:"include_roles,omitempty"`
+	// Let recreated roles log in, if they could when the snapshot was taken (default: false, they are created NOLOGIN)
+	IncludeRolesLogin bool `yaml:"include_roles_login,omitempty"`
 
 	// SQLite configuration
 	DatabasePath      string `yaml:"database_path,omitempty"`
 	SnapshotDirectory string `yaml:"snapshot_directory,omitempty"`
+	// Compression for stored snapshots: "none" (default) or "zstd"
+	Compression string `yaml:"compression,omitempty"`
+	// How snapshots are stored: "file" (default) or "dedup" for content-addressed chunks
+	SnapshotStorage string `yaml:"snapshot_storage,omitempty"`
+
+	// Number of pre-warmed copies kept per snapshot, so repeated restores don't have to wait (default: 1)
+	WarmCopies int `yaml:"warm_copies,omitempty"`
+
+	// Space that has to remain free on the disk of the snapshots, e.g. "5GB" (default: 1GB, "0" to disable)
+	MinFreeDiskSpace string `yaml:"min_free_disk_space,omitempty"`
+	// Refuse snapshots beyond this total size of all snapshots, e.g. "50GB" (default: no limit)
+	MaxTotalSnapshotSize string `yaml:"max_total_snapshot_size,omitempty"`
 
 	// Hook commands
 	BeforeSnapshotCommand string `yaml:"before_snapshot_command,omitempty"`
@@ -51,6 +85,29 @@ func (c *Config) GetMaintenanceDatabase() string {
 	return ""
 }
 
+func (c *Config) GetNamespace() string {
+	if c.Namespace != "" {
+		return c.Namespace
+	}
+	return defaultNamespace()
+}
+
+// Derives the namespace from the OS user, replacing characters that aren't allowed in namespaces
+func defaultNamespace() string {
+	current, err := user.Current()
+	if err != nil {
+		return "default"
+	}
+
+	// Windows user names include the domain, e.g. `DOMAIN\user`
+	username := current.Username[strings.LastIndex(current.Username, "\\")+1:]
+	namespace := invalidNamespaceCharacters.ReplaceAllString(username, "-")
+	if namespace == "" {
+		return "default"
+	}
+	return namespace
+}
+
 func (c *Config) GetDatabaseIdentifier() string {
 	switch c.GetProviderType() {
 	case provider.ProviderTypeSQLite:
@@ -64,6 +121,40 @@ func (c *Config) ConfigDir() string {
 	return c.configDir
 }
 
+func (c *Config) ConfigPath() string {
+	return c.configPath
+}
+
+const defaultMinFreeDiskSpace = 1 << 30
+
+func (c *Config) GetSpaceLimits() (provider.SpaceLimits, error) {
+	limits := provider.SpaceLimits{MinFreeDiskSpace: defaultMinFreeDiskSpace}
+
+	if c.MinFreeDiskSpace != "" {
+		size, err := disk.ParseBytes(c.MinFreeDiskSpace)
+		if err != nil {
+			return limits, fmt.Errorf("min_free_disk_space: %v", err)
+		}
+		limits.MinFreeDiskSpace = size
+	}
+
+	if c.MaxTotalSnapshotSize != "" {
+		size, err := disk.ParseBytes(c.MaxTotalSnapshotSize)
+		if err != nil {
+			return limits, fmt.Errorf("max_total_snapshot_size: %v", err)
+		}
+		limits.MaxTotalSnapshotSize = size
+	}
+	return limits, nil
+}
+
+func (c *Config) GetWarmCopies() int {
+	if c.WarmCopies < 1 {
+		return 1
+	}
+	return c.WarmCopies
+}
+
 func (c *Config) GetResolvedDatabasePath() string {
 	return resolvePath(c.DatabasePath, c.configDir)
 }
@@ -0,0 +1,36 @@
+package disk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gofrs/flock"
+)
+
+// Returns an error if files can't be created in the directory
+func CheckWritable(directory string) error {
+	file, err := os.CreateTemp(directory, ".lunar_write_test_*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// Returns an error if the filesystem of the directory doesn't support file locks,
+// which Lunar uses to keep processes from working on the same files (e.g. on some network filesystems)
+func CheckLocking(directory string) error {
+	path := filepath.Join(directory, ".lunar_lock_test")
+	defer os.Remove(path)
+
+	lock := flock.New(path)
+	locked, err := lock.TryLock()
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return fmt.Errorf("the lock file is locked by another process")
+	}
+	return lock.Unlock()
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package disk
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// Returns the number of bytes available to the current user on the volume of the path
+func FreeSpace(path string) (uint64, error) {
+	pathPointer, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPointer, &available, &total, &free); err != nil {
+		return 0, err
+	}
+	return available, nil
+}
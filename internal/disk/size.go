@@ -0,0 +1,47 @@
+package disk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func FormatBytes(bytes int64) string {
+	if bytes < 1024 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	units := []string{"KB", "MB", "GB", "TB", "PB"}
+	value := float64(bytes)
+	for _, unit := range units {
+		value = value / 1024
+		if value < 1024 {
+			return fmt.Sprintf("%.1f %s", value, unit)
+		}
+	}
+
+	return fmt.Sprintf("%.1f PB", value)
+}
+
+// Parses sizes like `500MB`, `1.5 GB` or `1024` (bytes). Units are powers of 1024, like in FormatBytes.
+func ParseBytes(input string) (int64, error) {
+	size := strings.ToUpper(strings.TrimSpace(input))
+
+	multiplier := int64(1)
+	for i, unit := range []string{"KB", "MB", "GB", "TB", "PB"} {
+		if strings.HasSuffix(size, unit) {
+			multiplier = int64(1) << (10 * (i + 1))
+			size = strings.TrimSuffix(size, unit)
+			break
+		}
+	}
+	if multiplier == 1 {
+		size = strings.TrimSuffix(size, "B")
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(size), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 500MB or 20GB", input)
+	}
+	return int64(value * float64(multiplier)), nil
+}
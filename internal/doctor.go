@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/leonvogt/lunar/internal/disk"
+	"github.com/leonvogt/lunar/internal/provider"
+	"github.com/leonvogt/lunar/internal/provider/postgres"
+	"github.com/leonvogt/lunar/internal/provider/sqlite"
+)
+
+// Runs the checks of `lunar doctor`, without requiring the database to be reachable
+func Diagnose(ctx context.Context, config *Config) []provider.Check {
+	var checks []provider.Check
+	limits, err := config.GetSpaceLimits()
+	if err != nil {
+		checks = append(checks, provider.Check{Name: "Configuration", Status: provider.CheckFailed, Message: err.Error(), Fix: "Fix lunar.yml"})
+	}
+
+	switch config.GetProviderType() {
+	case provider.ProviderTypePostgres:
+		checks = append(checks, postgres.Diagnose(ctx, postgresConfig(config, limits))...)
+	case provider.ProviderTypeSQLite:
+		checks = append(checks, sqlite.Diagnose(ctx, sqliteConfig(config, limits))...)
+	default:
+		checks = append(checks, provider.Check{
+			Name:    "Configuration",
+			Status:  provider.CheckFailed,
+			Message: fmt.Sprintf("unknown provider type: %s", config.GetProviderType()),
+			Fix:     "Set provider in lunar.yml to 'postgres' or 'sqlite'",
+		})
+	}
+
+	return append(checks, checkStateDir(config))
+}
+
+// Background jobs and the database state are kept in the state directory, guarded by file locks
+func checkStateDir(config *Config) provider.Check {
+	check := provider.Check{Name: "State directory", Status: provider.CheckPassed}
+
+	stateDir, err := config.StateDir()
+	if err == nil {
+		check.Message = stateDir + " is writable"
+		err = os.MkdirAll(stateDir, 0755)
+	}
+	if err == nil {
+		err = disk.CheckWritable(stateDir)
+	}
+	if err == nil {
+		err = disk.CheckLocking(stateDir)
+	}
+
+	if err != nil {
+		check.Status = provider.CheckFailed
+		check.Message = err.Error()
+		check.Fix = fmt.Sprintf("Make the directory writable for the current user or set %s to a local directory", STATE_DIR_ENV)
+	}
+	return check
+}
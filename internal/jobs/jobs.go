@@ -0,0 +1,315 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/leonvogt/lunar/internal/process"
+)
+
+const (
+	// Passed to background processes, so they can report their result
+	JOB_ID_ENV = "LUNAR_JOB_ID"
+
+	// Number of finished jobs that are kept, including their logs
+	maxFinishedJobs = 50
+
+	// Time between creating a job and recording the PID of its process. A job that has no PID
+	// after it belongs to a Lunar process that died before it started the job.
+	pidGracePeriod = 30 * time.Second
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Job is a background process started by Lunar, like preparing the copy of a snapshot.
+type Job struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind"`
+	Snapshot   string    `json:"snapshot"`
+	PID        int       `json:"pid,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Status     Status    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	LogFile    string    `json:"log_file"`
+	// Arguments of the lunar command that runs the job, used to retry it
+	Args []string `json:"args"`
+	// Whether the failure of the job has already been reported to the user
+	Reported bool `json:"reported,omitempty"`
+}
+
+func (j *Job) Duration() time.Duration {
+	if j.FinishedAt.IsZero() {
+		return time.Since(j.StartedAt)
+	}
+	return j.FinishedAt.Sub(j.StartedAt)
+}
+
+// Store keeps one JSON file and one log file per job in a directory.
+type Store struct {
+	directory string
+	lock      *flock.Flock
+}
+
+func NewStore(directory string) (*Store, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create jobs directory: %v", err)
+	}
+
+	return &Store{
+		directory: directory,
+		lock:      flock.New(filepath.Join(directory, ".lock")),
+	}, nil
+}
+
+// Records a new running job. The caller starts the process and reports its PID with SetPID.
+func (s *Store) Create(kind, snapshotName string, args []string) (*Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		ID:        id,
+		Kind:      kind,
+		Snapshot:  snapshotName,
+		StartedAt: time.Now(),
+		Status:    StatusRunning,
+		LogFile:   filepath.Join(s.directory, id+".log"),
+		Args:      args,
+	}
+
+	err = s.withLock(func() error {
+		s.prune()
+		return s.write(job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *Store) SetPID(id string, pid int) error {
+	return s.update(id, func(job *Job) {
+		job.PID = pid
+	})
+}
+
+// Records the result of a job. A nil error marks the job as succeeded.
+func (s *Store) Finish(id string, jobErr error) error {
+	return s.update(id, func(job *Job) {
+		job.FinishedAt = time.Now()
+		job.Status = StatusSucceeded
+		if jobErr != nil {
+			job.Status = StatusFailed
+			job.Error = jobErr.Error()
+		}
+	})
+}
+
+// Returns the job with the given ID. Unique prefixes of an ID are accepted as well.
+func (s *Store) Get(id string) (*Job, error) {
+	jobs, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*Job
+	for _, job := range jobs {
+		if job.ID == id {
+			return job, nil
+		}
+		if strings.HasPrefix(job.ID, id) {
+			matches = append(matches, job)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("job %s does not exist", id)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("job ID %s is ambiguous", id)
+	}
+}
+
+// Returns all jobs, most recent first. Jobs whose process is gone without
+// reporting a result, or was never started, are marked as failed.
+func (s *Store) List() ([]*Job, error) {
+	var jobs []*Job
+
+	err := s.withLock(func() error {
+		var err error
+		jobs, err = s.readAll()
+		if err != nil {
+			return err
+		}
+
+		for _, job := range jobs {
+			if job.Status != StatusRunning {
+				continue
+			}
+
+			switch {
+			case job.PID != 0 && !process.Exists(job.PID):
+				job.Error = "the process exited unexpectedly"
+			case job.PID == 0 && time.Since(job.StartedAt) > pidGracePeriod:
+				job.Error = "the process was never started"
+			default:
+				continue
+			}
+			job.Status = StatusFailed
+			job.FinishedAt = time.Now()
+			if err := s.write(job); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt.After(jobs[j].StartedAt)
+	})
+	return jobs, nil
+}
+
+// Returns failed jobs that haven't been reported to the user yet and marks them as reported.
+func (s *Store) TakeUnreportedFailures() ([]*Job, error) {
+	jobs, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var failures []*Job
+	for _, job := range jobs {
+		if job.Status != StatusFailed || job.Reported {
+			continue
+		}
+
+		failures = append(failures, job)
+		if err := s.update(job.ID, func(job *Job) { job.Reported = true }); err != nil {
+			return nil, err
+		}
+	}
+	return failures, nil
+}
+
+func (s *Store) update(id string, change func(job *Job)) error {
+	return s.withLock(func() error {
+		job, err := s.read(s.jobPath(id))
+		if err != nil {
+			return err
+		}
+		change(job)
+		return s.write(job)
+	})
+}
+
+// Removes the oldest finished jobs and their logs. Callers must hold the lock.
+func (s *Store) prune() {
+	jobs, err := s.readAll()
+	if err != nil {
+		return
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt.After(jobs[j].StartedAt)
+	})
+
+	finished := 0
+	for _, job := range jobs {
+		if job.Status == StatusRunning {
+			continue
+		}
+
+		finished++
+		if finished > maxFinishedJobs {
+			os.Remove(s.jobPath(job.ID))
+			os.Remove(job.LogFile)
+		}
+	}
+}
+
+func (s *Store) readAll() ([]*Job, error) {
+	paths, err := filepath.Glob(filepath.Join(s.directory, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(paths))
+	for _, path := range paths {
+		job, err := s.read(path)
+		if err != nil {
+			// Skip records that are being written or were damaged
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (s *Store) read(path string) (*Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job: %v", err)
+	}
+
+	job := &Job{}
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, fmt.Errorf("failed to parse job %s: %v", filepath.Base(path), err)
+	}
+	return job, nil
+}
+
+func (s *Store) write(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %v", err)
+	}
+
+	// Write to a temporary file first, so that readers never see a partial record
+	path := s.jobPath(job.ID)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write job: %v", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (s *Store) withLock(action func() error) error {
+	if err := s.lock.Lock(); err != nil {
+		return fmt.Errorf("failed to acquire jobs lock: %v", err)
+	}
+	defer s.lock.Unlock()
+
+	return action()
+}
+
+func (s *Store) jobPath(id string) string {
+	return filepath.Join(s.directory, id+".json")
+}
+
+func newJobID() (string, error) {
+	bytes := make([]byte, 4)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %v", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
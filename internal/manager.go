@@ -1,7 +1,9 @@
 package internal
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/leonvogt/lunar/internal/provider"
 	"github.com/leonvogt/lunar/internal/provider/postgres"
@@ -26,23 +28,49 @@ func NewSnapshotManager(config *Config) (*Manager, error) {
 }
 
 func createProvider(config *Config) (provider.Provider, error) {
+	limits, err := config.GetSpaceLimits()
+	if err != nil {
+		return nil, err
+	}
+
 	switch config.GetProviderType() {
 	case provider.ProviderTypePostgres:
-		return postgres.New(&postgres.Config{
-			DatabaseURL:         config.DatabaseUrl,
-			DatabaseName:        config.DatabaseName,
-			MaintenanceDatabase: config.MaintenanceDatabase,
-		})
+		return postgres.New(postgresConfig(config, limits))
 	case provider.ProviderTypeSQLite:
-		return sqlite.New(&sqlite.Config{
-			DatabasePath:      config.GetResolvedDatabasePath(),
-			SnapshotDirectory: config.GetResolvedSnapshotDirectory(),
-		})
+		return sqlite.New(sqliteConfig(config, limits))
 	default:
 		return nil, fmt.Errorf("unknown provider type: %s", config.GetProviderType())
 	}
 }
 
+func postgresConfig(config *Config, limits provider.SpaceLimits) *postgres.Config {
+	return &postgres.Config{
+		DatabaseURL:         config.DatabaseUrl,
+		DatabaseName:        config.DatabaseName,
+		MaintenanceDatabase: config.MaintenanceDatabase,
+		Namespace:           config.GetNamespace(),
+		ConnectionStrategy:  config.ConnectionStrategy,
+		DrainTimeout:        time.Duration(config.DrainTimeout) * time.Second,
+		CreateStrategy:      config.CreateStrategy,
+		SnapshotTablespace:  config.SnapshotTablespace,
+		IncludeRoles:        config.IncludeRoles,
+		IncludeRolesLogin:   config.IncludeRolesLogin,
+		WarmCopies:          config.WarmCopies,
+		SpaceLimits:         limits,
+	}
+}
+
+func sqliteConfig(config *Config, limits provider.SpaceLimits) *sqlite.Config {
+	return &sqlite.Config{
+		DatabasePath:      config.GetResolvedDatabasePath(),
+		SnapshotDirectory: config.GetResolvedSnapshotDirectory(),
+		Compression:       config.Compression,
+		Storage:           config.SnapshotStorage,
+		WarmCopies:        config.WarmCopies,
+		SpaceLimits:       limits,
+	}
+}
+
 func (m *Manager) Close() error {
 	return m.provider.Close()
 }
@@ -53,56 +81,116 @@ func (m *Manager) GetDatabaseIdentifier() string {
 
 // --- Snapshot operations
 
-func (m *Manager) CheckIfSnapshotCanBeTaken(snapshotName string) error {
-	return m.provider.CheckIfSnapshotCanBeTaken(snapshotName)
+func (m *Manager) CheckIfSnapshotCanBeTaken(ctx context.Context, snapshotName string) error {
+	return m.provider.CheckIfSnapshotCanBeTaken(ctx, snapshotName)
+}
+
+func (m *Manager) CheckIfSnapshotExists(ctx context.Context, snapshotName string) error {
+	return m.provider.CheckIfSnapshotExists(ctx, snapshotName)
+}
+
+func (m *Manager) CreateMainSnapshot(ctx context.Context, snapshotName string) error {
+	return m.provider.CreateSnapshot(ctx, snapshotName)
+}
+
+func (m *Manager) CreateSnapshotCopy(ctx context.Context, snapshotName string) error {
+	return m.provider.CreateSnapshotCopy(ctx, snapshotName)
+}
+
+func (m *Manager) EnsureSnapshotCopy(ctx context.Context, snapshotName string) error {
+	return m.provider.EnsureSnapshotCopy(ctx, snapshotName)
+}
+
+func (m *Manager) RestoreSnapshot(ctx context.Context, snapshotName string) error {
+	return m.provider.RestoreSnapshot(ctx, snapshotName)
 }
 
-func (m *Manager) CheckIfSnapshotExists(snapshotName string) error {
-	return m.provider.CheckIfSnapshotExists(snapshotName)
+func (m *Manager) RemoveSnapshot(ctx context.Context, snapshotName string) error {
+	return m.provider.RemoveSnapshot(ctx, snapshotName)
 }
 
-func (m *Manager) CreateMainSnapshot(snapshotName string) error {
-	return m.provider.CreateSnapshot(snapshotName)
+func (m *Manager) ReplaceSnapshot(ctx context.Context, snapshotName string) error {
+	return m.provider.ReplaceSnapshot(ctx, snapshotName)
 }
 
-func (m *Manager) CreateSnapshotCopy(snapshotName string) error {
-	return m.provider.CreateSnapshotCopy(snapshotName)
+func (m *Manager) RenameSnapshot(ctx context.Context, snapshotName, newName string) error {
+	return m.provider.RenameSnapshot(ctx, snapshotName, newName)
 }
 
-func (m *Manager) RestoreSnapshot(snapshotName string) error {
-	return m.provider.RestoreSnapshot(snapshotName)
+func (m *Manager) ListSnapshots(ctx context.Context) ([]provider.SnapshotInfo, error) {
+	return m.provider.ListSnapshots(ctx)
 }
 
-func (m *Manager) RemoveSnapshot(snapshotName string) error {
-	return m.provider.RemoveSnapshot(snapshotName)
+func (m *Manager) ListAllSnapshots(ctx context.Context) ([]provider.SnapshotInfo, error) {
+	return m.provider.ListAllSnapshots(ctx)
 }
 
-func (m *Manager) ReplaceSnapshot(snapshotName string) error {
-	return m.provider.ReplaceSnapshot(snapshotName)
+func (m *Manager) ReadySnapshotCopies(ctx context.Context, snapshotName string) (int, error) {
+	return m.provider.ReadySnapshotCopies(ctx, snapshotName)
 }
 
-func (m *Manager) ListSnapshots() ([]provider.SnapshotInfo, error) {
-	return m.provider.ListSnapshots()
+func (m *Manager) VerifySnapshot(ctx context.Context, snapshotName string) ([]string, error) {
+	return m.provider.VerifySnapshot(ctx, snapshotName)
+}
+
+func (m *Manager) SetSnapshotProtection(ctx context.Context, snapshotName string, protected bool) error {
+	return m.provider.SetSnapshotProtection(ctx, snapshotName, protected)
+}
+
+func (m *Manager) SetSnapshotDescription(ctx context.Context, snapshotName, description string) error {
+	return m.provider.SetSnapshotDescription(ctx, snapshotName, description)
+}
+
+func (m *Manager) LegacySnapshots(ctx context.Context) ([]string, error) {
+	return m.provider.LegacySnapshots(ctx)
+}
+
+func (m *Manager) MigrateLegacySnapshots(ctx context.Context) ([]string, error) {
+	return m.provider.MigrateLegacySnapshots(ctx)
 }
 
 // --- Locking/synchronization
 
-func (m *Manager) IsSnapshotInProgress(snapshotName string) bool {
-	return m.provider.IsSnapshotInProgress(snapshotName)
+func (m *Manager) IsSnapshotInProgress(ctx context.Context, snapshotName string) bool {
+	return m.provider.IsSnapshotInProgress(ctx, snapshotName)
+}
+
+func (m *Manager) IsWaitingForOperation(ctx context.Context) bool {
+	return m.provider.IsOperationInProgress(ctx)
+}
+
+func (m *Manager) WaitForOngoingSnapshot(ctx context.Context, snapshotName string) error {
+	return m.provider.WaitForOngoingSnapshot(ctx, snapshotName)
+}
+
+func (m *Manager) WaitForOngoingOperations(ctx context.Context) error {
+	return m.provider.WaitForOngoingOperations(ctx)
+}
+
+func (m *Manager) LockHolders(ctx context.Context) ([]provider.LockHolder, error) {
+	return m.provider.LockHolders(ctx)
+}
+
+func (m *Manager) BreakLock(ctx context.Context, holder provider.LockHolder) error {
+	return m.provider.BreakLock(ctx, holder)
+}
+
+func (m *Manager) TakeWarnings() []string {
+	return m.provider.TakeWarnings()
 }
 
-func (m *Manager) IsWaitingForOperation() bool {
-	return m.provider.IsOperationInProgress()
+func (m *Manager) GetDatabaseSize(ctx context.Context) (int64, error) {
+	return m.provider.GetDatabaseSize(ctx)
 }
 
-func (m *Manager) WaitForOngoingSnapshot(snapshotName string) error {
-	return m.provider.WaitForOngoingSnapshot(snapshotName)
+func (m *Manager) DatabaseFingerprint(ctx context.Context) (string, error) {
+	return m.provider.DatabaseFingerprint(ctx)
 }
 
-func (m *Manager) WaitForOngoingOperations() error {
-	return m.provider.WaitForOngoingOperations()
+func (m *Manager) GetDetails(ctx context.Context) ([]provider.Detail, error) {
+	return m.provider.GetDetails(ctx)
 }
 
-func (m *Manager) GetDatabaseSize() (int64, error) {
-	return m.provider.GetDatabaseSize()
+func (m *Manager) GetSnapshotDetails(ctx context.Context, snapshotName string) ([]provider.Detail, error) {
+	return m.provider.GetSnapshotDetails(ctx, snapshotName)
 }
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package process
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Reports whether a process with the given PID is running.
+// Signal 0 performs the existence and permission checks without signaling the process
+func Exists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package process
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// Exit code reported by GetExitCodeProcess while the process is still running
+const stillActive = 259
+
+// Reports whether a process with the given PID is running
+func Exists(pid int) bool {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(handle)
+
+	var exitCode uint32
+	if err := windows.GetExitCodeProcess(handle, &exitCode); err != nil {
+		return false
+	}
+	return exitCode == stillActive
+}
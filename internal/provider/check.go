@@ -0,0 +1,18 @@
+package provider
+
+// Check is the result of one of the checks run by `lunar doctor`
+type Check struct {
+	Name    string
+	Status  CheckStatus
+	Message string
+	// What to do about a failed check or a warning
+	Fix string
+}
+
+type CheckStatus string
+
+const (
+	CheckPassed  CheckStatus = "ok"
+	CheckWarning CheckStatus = "warning"
+	CheckFailed  CheckStatus = "failed"
+)
@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/leonvogt/lunar/internal/process"
+)
+
+// LockHolder describes the Lunar process holding one of the locks of a database
+type LockHolder struct {
+	// What the lock protects, e.g. "operation" or "snapshot production"
+	Lock      string    `json:"-"`
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	Command   string    `json:"command"`
+	StartedAt time.Time `json:"started_at"`
+	// Server process of the session holding the lock (PostgreSQL only)
+	BackendPID int `json:"-"`
+}
+
+// Returns the details that identify the running process as a lock holder
+func CurrentLockHolder() LockHolder {
+	host, _ := os.Hostname()
+
+	return LockHolder{
+		PID:       os.Getpid(),
+		Host:      host,
+		Command:   strings.TrimSpace("lunar " + strings.Join(os.Args[1:], " ")),
+		StartedAt: time.Now(),
+	}
+}
+
+// Whether the holding process is known to be gone. Processes on other hosts can't be checked.
+func (h LockHolder) IsDead() bool {
+	if h.PID == 0 {
+		return false
+	}
+
+	host, err := os.Hostname()
+	if err != nil || host != h.Host {
+		return false
+	}
+	return !process.Exists(h.PID)
+}
+
+func (h LockHolder) String() string {
+	if h.PID == 0 {
+		return "an unknown process"
+	}
+
+	description := fmt.Sprintf("`%s` (pid %d on %s", h.Command, h.PID, h.Host)
+	if !h.StartedAt.IsZero() {
+		description += fmt.Sprintf(", started %s", h.StartedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	return description + ")"
+}
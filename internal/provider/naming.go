@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxSnapshotNameLength = 128
+
+// Lunar separates the parts of snapshot database names with it
+const reservedSeparator = "____"
+
+// Lunar names the pre-warmed copies of a snapshot like this
+var reservedCopySuffix = regexp.MustCompile(`_copy[0-9]*$`)
+
+// Snapshot names that can be used in database and file names as they are
+var plainSnapshotName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func ValidateSnapshotName(snapshotName string) error {
+	switch {
+	case snapshotName == "":
+		return fmt.Errorf("snapshot name must not be empty")
+	case !utf8.ValidString(snapshotName):
+		return fmt.Errorf("snapshot name must be valid UTF-8")
+	case utf8.RuneCountInString(snapshotName) > maxSnapshotNameLength:
+		return fmt.Errorf("snapshot name must not be longer than %d characters", maxSnapshotNameLength)
+	case strings.TrimSpace(snapshotName) != snapshotName:
+		return fmt.Errorf("snapshot name must not start or end with whitespace")
+	case strings.ContainsAny(snapshotName, `/\`):
+		return fmt.Errorf("snapshot name must not contain `/` or `\\`")
+	case strings.Contains(snapshotName, reservedSeparator):
+		return fmt.Errorf("snapshot name must not contain `%s`, Lunar uses it to separate the parts of database names", reservedSeparator)
+	case reservedCopySuffix.MatchString(snapshotName):
+		return fmt.Errorf("snapshot name must not end with `_copy` or `_copyN`, Lunar uses them for copies of snapshots")
+	}
+
+	for _, r := range snapshotName {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("snapshot name must not contain control characters")
+		}
+	}
+	return nil
+}
+
+// Whether the snapshot name only contains characters that are safe in database and file names
+func IsPlainSnapshotName(snapshotName string) bool {
+	return plainSnapshotName.MatchString(snapshotName)
+}
+
+// Returns a short name derived from the given parts, for names that can't be used as they are
+func HashedName(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:12])
+}
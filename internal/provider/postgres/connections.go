@@ -0,0 +1,165 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// What happens to clients connected to a database Lunar copies, drops or renames
+const (
+	// Terminates all sessions right away
+	connectionStrategyTerminate = "terminate"
+	// Waits for sessions to become idle, cancels the ones still busy after the drain timeout
+	connectionStrategyDrain = "drain"
+	// Refuses the operation and lists the connected clients
+	connectionStrategyFail = "fail"
+)
+
+const (
+	defaultDrainTimeout = 30 * time.Second
+	drainPollInterval   = 250 * time.Millisecond
+)
+
+// A client session in pg_stat_activity
+type clientSession struct {
+	pid             int
+	applicationName string
+	clientAddress   string
+	state           string
+}
+
+func (s clientSession) String() string {
+	applicationName := s.applicationName
+	if applicationName == "" {
+		applicationName = "(no application name)"
+	}
+	return fmt.Sprintf("%s from %s, %s (pid %d)", applicationName, s.clientAddress, s.state, s.pid)
+}
+
+// Whether the session is in the middle of a statement or transaction
+func (s clientSession) isBusy() bool {
+	return s.state != "idle"
+}
+
+func validateConnectionStrategy(strategy string) error {
+	switch strategy {
+	case "", connectionStrategyTerminate, connectionStrategyDrain, connectionStrategyFail:
+		return nil
+	default:
+		return fmt.Errorf("unknown connection strategy %q for PostgreSQL provider. Must be 'terminate', 'drain' or 'fail'", strategy)
+	}
+}
+
+func (p *Provider) connectionStrategy() string {
+	if p.config.ConnectionStrategy == "" {
+		return connectionStrategyTerminate
+	}
+	return p.config.ConnectionStrategy
+}
+
+func (p *Provider) drainTimeout() time.Duration {
+	if p.config.DrainTimeout <= 0 {
+		return defaultDrainTimeout
+	}
+	return p.config.DrainTimeout
+}
+
+// Gets rid of the sessions connected to the database, according to the configured connection strategy
+func (p *Provider) clearConnections(ctx context.Context, databaseName string) error {
+	switch p.connectionStrategy() {
+	case connectionStrategyFail:
+		sessions, err := p.clientSessions(ctx, databaseName)
+		if err != nil {
+			return err
+		}
+		if len(sessions) > 0 {
+			return connectedClientsError(databaseName, sessions)
+		}
+		return nil
+	case connectionStrategyDrain:
+		if err := p.drainConnections(ctx, databaseName); err != nil {
+			return err
+		}
+	}
+
+	if err := p.terminateConnections(ctx, databaseName); err != nil {
+		return fmt.Errorf("failed to terminate connections to %s: %v", databaseName, err)
+	}
+	return nil
+}
+
+// Waits until no session is busy anymore and cancels the queries still running after the drain timeout.
+// The remaining idle sessions are terminated by the caller.
+func (p *Provider) drainConnections(ctx context.Context, databaseName string) error {
+	deadline := time.Now().Add(p.drainTimeout())
+
+	for {
+		sessions, err := p.clientSessions(ctx, databaseName)
+		if err != nil {
+			return err
+		}
+
+		var busy []clientSession
+		for _, session := range sessions {
+			if session.isBusy() {
+				busy = append(busy, session)
+			}
+		}
+		if len(busy) == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			for _, session := range busy {
+				if _, err := p.dbConnection.ExecContext(ctx, "SELECT pg_cancel_backend($1)", session.pid); err != nil {
+					return fmt.Errorf("failed to cancel the query of %s: %v", session, err)
+				}
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(drainPollInterval):
+		}
+	}
+}
+
+func (p *Provider) clientSessions(ctx context.Context, databaseName string) ([]clientSession, error) {
+	query := `
+		SELECT pid, COALESCE(application_name, ''), COALESCE(host(client_addr), 'local socket'), COALESCE(state, 'unknown')
+		FROM pg_stat_activity
+		WHERE datname = $1
+		AND pid <> pg_backend_pid()
+		ORDER BY backend_start`
+
+	rows, err := p.dbConnection.QueryContext(ctx, query, databaseName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the clients connected to %s: %v", databaseName, err)
+	}
+	defer rows.Close()
+
+	var sessions []clientSession
+	for rows.Next() {
+		var session clientSession
+		if err := rows.Scan(&session.pid, &session.applicationName, &session.clientAddress, &session.state); err != nil {
+			return nil, fmt.Errorf("failed to list the clients connected to %s: %v", databaseName, err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func connectedClientsError(databaseName string, sessions []clientSession) error {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%s has %d connected client(s), disconnect them or change `connection_strategy`:", pq.QuoteIdentifier(databaseName), len(sessions))
+	for _, session := range sessions {
+		builder.WriteString("\n  - " + session.String())
+	}
+	return fmt.Errorf("%s", builder.String())
+}
@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+)
+
+// Stores the description in the metadata comment of the snapshot database
+func (p *Provider) SetSnapshotDescription(ctx context.Context, snapshotName, description string) error {
+	if err := p.CheckIfSnapshotExists(ctx, snapshotName); err != nil {
+		return err
+	}
+
+	// The metadata is rewritten while snapshots are created, replaced and renamed
+	if err := p.markSnapshotStart(ctx, snapshotName); err != nil {
+		return fmt.Errorf("failed to mark snapshot start: %v", err)
+	}
+	defer p.markSnapshotFinish(ctx, snapshotName)
+
+	snapshotDBName := p.snapshotDatabaseName(snapshotName)
+	allMetadata, err := p.allSnapshotMetadata(ctx)
+	if err != nil {
+		return err
+	}
+	metadata, found := allMetadata[snapshotDBName]
+	if !found {
+		// Snapshots of earlier versions of Lunar have no metadata yet
+		metadata = snapshotMetadata{Namespace: p.config.Namespace, Database: p.config.DatabaseName, Snapshot: snapshotName}
+	}
+	metadata.Description = description
+
+	return p.commentSnapshotMetadata(ctx, snapshotDBName, metadata)
+}
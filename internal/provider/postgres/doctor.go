@@ -0,0 +1,237 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/leonvogt/lunar/internal/provider"
+	"github.com/lib/pq"
+)
+
+// Runs the checks of `lunar doctor`. Unlike New, it reports all problems instead of stopping at the first one.
+func Diagnose(ctx context.Context, config *Config) []provider.Check {
+	checks := []provider.Check{checkConfig(config)}
+	if config.DatabaseURL == "" {
+		return checks
+	}
+
+	db, connectionChecks := checkMaintenanceDatabases(ctx, config)
+	checks = append(checks, connectionChecks...)
+	if db == nil {
+		return checks
+	}
+	defer db.Close()
+
+	p := &Provider{config: config, dbConnection: db}
+	checks = append(checks, p.checkPrivileges(ctx), p.checkDatabase(ctx))
+
+	exists, err := p.doesDatabaseExist(ctx, config.DatabaseName)
+	if err != nil || !exists {
+		return checks
+	}
+
+	checks = append(checks, p.checkConnectedClients(ctx), p.checkStatFile(ctx))
+	if config.SnapshotTablespace != "" {
+		checks = append(checks, p.checkSnapshotTablespace(ctx))
+	}
+	return append(checks, p.checkDiskSpace(ctx))
+}
+
+func checkConfig(config *Config) provider.Check {
+	var problems []string
+	if config.DatabaseURL == "" {
+		problems = append(problems, "database_url is required for PostgreSQL provider")
+	}
+	if config.DatabaseName == "" {
+		problems = append(problems, "database is required for PostgreSQL provider")
+	}
+	for _, err := range []error{
+		validateNamespace(config.Namespace),
+		validateConnectionStrategy(config.ConnectionStrategy),
+		validateCreateStrategy(config.CreateStrategy),
+	} {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return provider.Check{Name: "Configuration", Status: provider.CheckFailed, Message: strings.Join(problems, "; "), Fix: "Fix lunar.yml"}
+	}
+	return provider.Check{Name: "Configuration", Status: provider.CheckPassed, Message: "valid"}
+}
+
+// Tries every maintenance database candidate and returns a connection to the first one that works.
+// Unreachable candidates are only a problem if none of them works.
+func checkMaintenanceDatabases(ctx context.Context, config *Config) (*sql.DB, []provider.Check) {
+	var candidates []string
+	if config.MaintenanceDatabase != "" {
+		candidates = append(candidates, config.MaintenanceDatabase)
+	}
+	candidates = append(candidates, defaultMaintenanceDatabases()...)
+
+	var connection *sql.DB
+	var checks []provider.Check
+	for _, candidate := range candidates {
+		check := provider.Check{Name: "Connection to " + candidate, Status: provider.CheckPassed, Message: "ok"}
+
+		db, err := openDatabaseConnection(config.DatabaseURL + candidate)
+		if err == nil {
+			if err = db.PingContext(ctx); err != nil {
+				db.Close()
+			}
+		}
+
+		switch {
+		case err != nil:
+			check.Status = provider.CheckFailed
+			check.Message = err.Error()
+		case connection == nil:
+			connection = db
+		default:
+			db.Close()
+		}
+		checks = append(checks, check)
+	}
+
+	for i := range checks {
+		if checks[i].Status != provider.CheckFailed {
+			continue
+		}
+		if connection != nil {
+			checks[i].Status = provider.CheckWarning
+			continue
+		}
+		checks[i].Fix = "Check database_url in lunar.yml and that the server is running, or set maintenance_database to a database the user can connect to"
+	}
+	return connection, checks
+}
+
+func (p *Provider) checkPrivileges(ctx context.Context) provider.Check {
+	check := provider.Check{Name: "Privileges", Status: provider.CheckPassed}
+
+	var user string
+	var superuser, createDB bool
+	query := "SELECT rolname, rolsuper, rolcreatedb FROM pg_roles WHERE rolname = current_user"
+	if err := p.dbConnection.QueryRowContext(ctx, query).Scan(&user, &superuser, &createDB); err != nil {
+		check.Status = provider.CheckWarning
+		check.Message = fmt.Sprintf("can't be checked: %v", err)
+		return check
+	}
+
+	switch {
+	case superuser:
+		check.Message = user + " is a superuser"
+	case createDB:
+		check.Message = user + " may create databases"
+	default:
+		check.Status = provider.CheckFailed
+		check.Message = user + " may not create databases, which snapshots are"
+		check.Fix = fmt.Sprintf("Run `ALTER ROLE %s CREATEDB` as a superuser", pq.QuoteIdentifier(user))
+	}
+	return check
+}
+
+// Restoring renames and drops the database, which only its owner may do
+func (p *Provider) checkDatabase(ctx context.Context) provider.Check {
+	databaseName := p.config.DatabaseName
+	check := provider.Check{Name: "Database", Status: provider.CheckPassed}
+
+	var owner, user string
+	var isOwner bool
+	query := "SELECT pg_get_userbyid(datdba), current_user, pg_has_role(datdba, 'MEMBER') FROM pg_database WHERE datname = $1"
+	err := p.dbConnection.QueryRowContext(ctx, query, databaseName).Scan(&owner, &user, &isOwner)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		check.Status = provider.CheckFailed
+		check.Message = databaseName + " does not exist"
+		check.Fix = "Create the database or fix `database` in lunar.yml"
+	case err != nil:
+		check.Status = provider.CheckWarning
+		check.Message = fmt.Sprintf("can't be checked: %v", err)
+	case !isOwner:
+		check.Status = provider.CheckFailed
+		check.Message = fmt.Sprintf("%s is owned by %s, only the owner may replace it on restore", databaseName, owner)
+		check.Fix = fmt.Sprintf("Run `ALTER DATABASE %s OWNER TO %s` as %s or a superuser", pq.QuoteIdentifier(databaseName), pq.QuoteIdentifier(user), owner)
+	default:
+		check.Message = fmt.Sprintf("%s exists and is owned by %s", databaseName, owner)
+	}
+	return check
+}
+
+// Connected clients make restores fail with "database is being accessed by other users"
+// if they can't be terminated
+func (p *Provider) checkConnectedClients(ctx context.Context) provider.Check {
+	check := provider.Check{Name: "Connected clients", Status: provider.CheckPassed}
+
+	sessions, err := p.clientSessions(ctx, p.config.DatabaseName)
+	if err != nil {
+		check.Status = provider.CheckWarning
+		check.Message = fmt.Sprintf("can't be checked: %v", err)
+		return check
+	}
+
+	check.Message = fmt.Sprintf("%d, connection strategy %s", len(sessions), p.connectionStrategy())
+	if len(sessions) > 0 && p.connectionStrategy() == connectionStrategyFail {
+		check.Status = provider.CheckWarning
+		check.Fix = "Disconnect the clients before restoring or change connection_strategy"
+	}
+	return check
+}
+
+// Snapshot ages are read from the modification time of the database files
+func (p *Provider) checkStatFile(ctx context.Context) provider.Check {
+	check := provider.Check{Name: "pg_stat_file", Status: provider.CheckPassed, Message: "snapshot ages can be determined"}
+
+	if _, err := p.getDatabaseAge(ctx, p.config.DatabaseName); err != nil {
+		check.Status = provider.CheckWarning
+		check.Message = fmt.Sprintf("snapshot ages can't be determined: %v", err)
+		check.Fix = "Run `GRANT EXECUTE ON FUNCTION pg_stat_file(text) TO <user>` as a superuser"
+	}
+	return check
+}
+
+func (p *Provider) checkSnapshotTablespace(ctx context.Context) provider.Check {
+	tablespace := p.config.SnapshotTablespace
+	check := provider.Check{Name: "Snapshot tablespace", Status: provider.CheckPassed, Message: tablespace + " is usable"}
+
+	var canCreate bool
+	query := "SELECT has_tablespace_privilege(oid, 'CREATE') FROM pg_tablespace WHERE spcname = $1"
+	err := p.dbConnection.QueryRowContext(ctx, query, tablespace).Scan(&canCreate)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		check.Status = provider.CheckFailed
+		check.Message = tablespace + " does not exist"
+		check.Fix = "Create the tablespace or fix snapshot_tablespace in lunar.yml"
+	case err != nil:
+		check.Status = provider.CheckWarning
+		check.Message = fmt.Sprintf("can't be checked: %v", err)
+	case !canCreate:
+		check.Status = provider.CheckFailed
+		check.Message = "the user may not create databases in " + tablespace
+		check.Fix = fmt.Sprintf("Run `GRANT CREATE ON TABLESPACE %s TO <user>` as a superuser", pq.QuoteIdentifier(tablespace))
+	}
+	return check
+}
+
+// The free space can only be checked when the server runs on this host
+func (p *Provider) checkDiskSpace(ctx context.Context) provider.Check {
+	size, err := p.databaseSize(ctx, p.config.DatabaseName)
+	if err != nil {
+		return provider.Check{Name: "Disk space", Status: provider.CheckWarning, Message: fmt.Sprintf("can't be checked: %v", err)}
+	}
+
+	directory, err := p.tablespaceDirectory(ctx, p.config.SnapshotTablespace)
+	if err != nil {
+		return provider.Check{
+			Name:    "Disk space",
+			Status:  provider.CheckWarning,
+			Message: fmt.Sprintf("can't be checked: %v", err),
+			Fix:     fmt.Sprintf("Make sure the server has room for %d times the size of the database", 1+p.warmCopies()),
+		}
+	}
+	return p.config.SpaceLimits.DiskSpaceCheck(directory, size, p.warmCopies())
+}
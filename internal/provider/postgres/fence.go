@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// How often a statement is retried while clients keep reconnecting to the database
+	fenceRetries = 5
+	// Delay before the first retry, doubled for every further retry
+	fenceRetryDelay = 200 * time.Millisecond
+)
+
+// fence keeps clients (e.g. app servers or job workers that reconnect right away) from
+// connecting to databases while Lunar copies, drops or renames them.
+type fence struct {
+	provider *Provider
+	// All fenced databases, by name
+	databases []string
+	// Databases whose connections were disallowed by the fence and have to be allowed again
+	disallowed map[string]bool
+}
+
+// Disallows new connections to the databases and clears the existing ones according to the connection strategy.
+// The caller has to release the fence, also when the operation failed.
+func (p *Provider) fenceDatabases(ctx context.Context, databaseNames ...string) (*fence, error) {
+	f := &fence{
+		provider:   p,
+		databases:  databaseNames,
+		disallowed: make(map[string]bool),
+	}
+
+	for _, databaseName := range databaseNames {
+		if err := f.disallowConnections(ctx, databaseName); err != nil {
+			f.release(ctx)
+			return nil, err
+		}
+	}
+
+	if err := f.clearConnections(ctx); err != nil {
+		f.release(ctx)
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *fence) disallowConnections(ctx context.Context, databaseName string) error {
+	var allowed bool
+	err := f.provider.dbConnection.QueryRowContext(ctx, "SELECT datallowconn FROM pg_database WHERE datname = $1", databaseName).Scan(&allowed)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !allowed) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check connections to %s: %v", databaseName, err)
+	}
+
+	_, err = f.provider.dbConnection.ExecContext(ctx, "ALTER DATABASE "+pq.QuoteIdentifier(databaseName)+" ALLOW_CONNECTIONS false")
+	if err != nil {
+		// Only owners can change the database, others are left with clearing connections
+		if isErrorCode(err, "42501") {
+			return nil
+		}
+		return fmt.Errorf("failed to disallow connections to %s: %v", databaseName, err)
+	}
+
+	f.disallowed[databaseName] = true
+	return nil
+}
+
+func (f *fence) clearConnections(ctx context.Context) error {
+	for _, databaseName := range f.databases {
+		if err := f.provider.clearConnections(ctx, databaseName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Keeps track of a fenced database that was renamed, so that its connections are allowed again
+func (f *fence) renamed(oldName, newName string) {
+	for i, databaseName := range f.databases {
+		if databaseName == oldName {
+			f.databases[i] = newName
+		}
+	}
+
+	if f.disallowed[oldName] {
+		delete(f.disallowed, oldName)
+		f.disallowed[newName] = true
+	}
+}
+
+// Runs the statement, clearing the connections of clients that got in again before every retry
+func (f *fence) retry(ctx context.Context, statement func() error) error {
+	delay := fenceRetryDelay
+
+	for attempt := 0; ; attempt++ {
+		err := statement()
+		if err == nil || attempt == fenceRetries || !isErrorCode(err, "55006") {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+
+		if err := f.clearConnections(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Allows connections again, even if the context of the operation was cancelled.
+// Databases that were dropped in the meantime are skipped.
+func (f *fence) release(ctx context.Context) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+
+	for databaseName := range f.disallowed {
+		exists, err := f.provider.doesDatabaseExist(ctx, databaseName)
+		if err != nil || !exists {
+			continue
+		}
+		_, _ = f.provider.dbConnection.ExecContext(ctx, "ALTER DATABASE "+pq.QuoteIdentifier(databaseName)+" ALLOW_CONNECTIONS true")
+	}
+}
+
+func isErrorCode(err error, code pq.ErrorCode) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == code
+}
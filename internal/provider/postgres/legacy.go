@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Snapshot databases of Lunar versions without namespaces are named `lunar_snapshot____<database>____<snapshot>`
+// and their copies `..._copy`. Returns the snapshots of the configured database among them, mapped to whether
+// they are copies. A copy is only a copy if the snapshot it belongs to exists, a snapshot may be named `..._copy` as well.
+func (p *Provider) legacySnapshotDatabases(snapshotDatabases []string) map[string]bool {
+	legacyPrefix := snapshotPrefix + p.config.DatabaseName + separator
+	legacy := make(map[string]bool)
+
+	// Hashed names have the same number of parts, so the snapshots of a database named like the marker can't be told apart
+	if p.config.DatabaseName == hashedNameMarker {
+		return legacy
+	}
+
+	for _, databaseName := range snapshotDatabases {
+		if rest, found := strings.CutPrefix(databaseName, legacyPrefix); found && !strings.Contains(rest, separator) {
+			legacy[rest] = false
+		}
+	}
+	for rest := range legacy {
+		if suffix := snapshotCopySuffix.FindString(rest); suffix != "" {
+			if _, found := legacy[strings.TrimSuffix(rest, suffix)]; found {
+				legacy[rest] = true
+			}
+		}
+	}
+
+	return legacy
+}
+
+// Lists the snapshots of the configured database taken by earlier versions of Lunar, without changing them
+func (p *Provider) LegacySnapshots(ctx context.Context) ([]string, error) {
+	snapshotDatabases, err := p.allSnapshotDatabases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotNames := make([]string, 0)
+	for rest, isCopy := range p.legacySnapshotDatabases(snapshotDatabases) {
+		if !isCopy {
+			snapshotNames = append(snapshotNames, rest)
+		}
+	}
+	slices.Sort(snapshotNames)
+	return snapshotNames, nil
+}
+
+// Moves the snapshots of the configured database taken by earlier versions of Lunar, and their copies, into the
+// configured namespace, so that they keep working after an upgrade. Everybody working with the database waits
+// for the operation lock, so that no other Lunar process uses the snapshots while they are renamed.
+// Returns the moved snapshots, databases that can't be moved are reported as warnings.
+func (p *Provider) MigrateLegacySnapshots(ctx context.Context) ([]string, error) {
+	databaseName := p.config.DatabaseName
+
+	if err := p.markOperationStart(ctx, databaseName); err != nil {
+		return nil, err
+	}
+	defer p.markOperationFinish(ctx, databaseName)
+
+	snapshotDatabases, err := p.allSnapshotDatabases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	legacyPrefix := snapshotPrefix + databaseName + separator
+	legacy := p.legacySnapshotDatabases(snapshotDatabases)
+
+	migrated := make([]string, 0)
+	for rest, isCopy := range legacy {
+		target := p.snapshotDatabaseName(rest)
+		snapshotName := rest
+		if isCopy {
+			suffix := snapshotCopySuffix.FindString(rest)
+			snapshotName = strings.TrimSuffix(rest, suffix)
+			target = p.snapshotDatabaseName(snapshotName) + suffix
+		}
+
+		exists, err := p.doesDatabaseExist(ctx, target)
+		if err == nil && exists {
+			err = fmt.Errorf("%s exists already", target)
+		}
+		if err == nil {
+			err = p.renameDatabase(ctx, legacyPrefix+rest, target)
+		}
+		if err != nil {
+			p.warn("snapshot database %s of an earlier version of Lunar wasn't moved into namespace %s: %v", legacyPrefix+rest, p.config.Namespace, err)
+			continue
+		}
+		if isCopy {
+			continue
+		}
+		migrated = append(migrated, snapshotName)
+
+		// Hashed names are listed through their metadata
+		if strings.HasPrefix(target, snapshotPrefix+hashedNameMarker+separator) {
+			metadata := snapshotMetadata{Namespace: p.config.Namespace, Database: databaseName, Snapshot: snapshotName}
+			if err := p.commentSnapshotMetadata(ctx, target, metadata); err != nil {
+				p.warn("%v", err)
+			}
+		}
+	}
+
+	slices.Sort(migrated)
+	return migrated, nil
+}
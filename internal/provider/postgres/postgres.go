@@ -3,30 +3,75 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"hash/crc32"
 	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/leonvogt/lunar/internal/provider"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 const separator = "____"
 
+const snapshotPrefix = "lunar_snapshot" + separator
+
+// Stands in for namespace and database in hashed snapshot database names, so it can't be used as namespace
+const hashedNameMarker = "h"
+
+// PostgreSQL truncates identifiers to 63 bytes, leave room for the suffix of copies (`_copy2`, ...)
+const maxSnapshotDatabaseNameLength = 63 - len("_copy999")
+
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
 type Config struct {
 	DatabaseURL         string
 	DatabaseName        string
 	MaintenanceDatabase string
+	// Keeps the snapshots of several users apart on a shared server
+	Namespace string
+	// "terminate" (default), "drain" or "fail", see fence.go
+	ConnectionStrategy string
+	// How long the "drain" strategy waits for sessions to become idle
+	DrainTimeout time.Duration
+	// CREATE DATABASE strategy: "auto" (default), "file_copy" or "wal_log"
+	CreateStrategy string
+	// Tablespace for snapshot databases, empty for the tablespace of the database
+	SnapshotTablespace string
+	// Records the roles referenced by snapshots and creates missing ones on restore
+	IncludeRoles bool
+	// Creates missing roles with LOGIN if they had it, NOLOGIN otherwise
+	IncludeRolesLogin bool
+	// Number of pre-warmed copies kept per snapshot for fast restores
+	WarmCopies  int
+	SpaceLimits provider.SpaceLimits
 }
 
 type Provider struct {
 	config       *Config
 	dbConnection *sql.DB
+	// Advisory locks belong to a session, so they are all taken and released on this connection
+	lockConnection *sql.Conn
+	// Warnings of the current operation, see TakeWarnings
+	warnings []string
 }
 
 func New(config *Config) (*Provider, error) {
+	if err := validateNamespace(config.Namespace); err != nil {
+		return nil, err
+	}
+	if err := validateConnectionStrategy(config.ConnectionStrategy); err != nil {
+		return nil, err
+	}
+	if err := validateCreateStrategy(config.CreateStrategy); err != nil {
+		return nil, err
+	}
+
 	db, err := connectToMaintenanceDatabase(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to maintenance database: %v", err)
@@ -38,7 +83,30 @@ func New(config *Config) (*Provider, error) {
 	}, nil
 }
 
+func validateNamespace(namespace string) error {
+	if !namespacePattern.MatchString(namespace) || strings.Contains(namespace, separator) {
+		return fmt.Errorf("invalid namespace %q: only letters, digits, `-` and `_` are allowed (but no `%s`)", namespace, separator)
+	}
+	if namespace == hashedNameMarker {
+		return fmt.Errorf("namespace %q is reserved for hashed snapshot names, please set another one with `namespace` in lunar.yml", namespace)
+	}
+	return nil
+}
+
+func (p *Provider) TakeWarnings() []string {
+	warnings := p.warnings
+	p.warnings = nil
+	return warnings
+}
+
+func (p *Provider) warn(format string, args ...any) {
+	p.warnings = append(p.warnings, fmt.Sprintf(format, args...))
+}
+
 func (p *Provider) Close() error {
+	if p.lockConnection != nil {
+		p.lockConnection.Close()
+	}
 	if p.dbConnection != nil {
 		return p.dbConnection.Close()
 	}
@@ -49,10 +117,78 @@ func (p *Provider) GetDatabaseIdentifier() string {
 	return p.config.DatabaseName
 }
 
-func (p *Provider) CheckIfSnapshotCanBeTaken(snapshotName string) error {
-	snapshotDBName := snapshotDatabaseName(p.config.DatabaseName, snapshotName)
+func (p *Provider) GetDetails(ctx context.Context) ([]provider.Detail, error) {
+	var serverVersion, maintenanceDatabase string
+	err := p.dbConnection.QueryRowContext(ctx, "SELECT current_setting('server_version'), current_database()").Scan(&serverVersion, &maintenanceDatabase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query server details: %v", err)
+	}
+
+	snapshotTablespace := p.config.SnapshotTablespace
+	if snapshotTablespace == "" {
+		snapshotTablespace = "(same as the database)"
+	}
+
+	return []provider.Detail{
+		{Label: "Server version", Value: serverVersion},
+		{Label: "Maintenance database", Value: maintenanceDatabase},
+		{Label: "Namespace", Value: p.config.Namespace},
+		{Label: "Create strategy", Value: p.createStrategy()},
+		{Label: "Snapshot tablespace", Value: snapshotTablespace},
+	}, nil
+}
+
+func (p *Provider) GetSnapshotDetails(ctx context.Context, snapshotName string) ([]provider.Detail, error) {
+	if err := p.CheckIfSnapshotExists(ctx, snapshotName); err != nil {
+		return nil, err
+	}
 
-	exists, err := p.doesDatabaseExist(snapshotDBName)
+	readyCopies, err := p.ReadySnapshotCopies(ctx, snapshotName)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotDBName := p.snapshotDatabaseName(snapshotName)
+	metadata, err := p.allSnapshotMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	copyStrategy := "CREATE DATABASE ... TEMPLATE"
+	if strategy := metadata[snapshotDBName].Strategy; strategy != "" {
+		copyStrategy += " (" + strings.ToUpper(strategy) + ")"
+	}
+
+	tablespace, err := p.databaseTablespace(ctx, snapshotDBName)
+	if err != nil {
+		return nil, err
+	}
+
+	protected, err := p.isSnapshotDatabaseProtected(ctx, snapshotDBName)
+	if err != nil {
+		return nil, err
+	}
+	protection := "yes, not connectable"
+	if !protected {
+		protection = "no, connectable (protect it with `lunar protect`)"
+	}
+
+	return []provider.Detail{
+		{Label: "Snapshot database", Value: snapshotDBName},
+		{Label: "Copy strategy", Value: copyStrategy},
+		{Label: "Tablespace", Value: tablespace},
+		{Label: "Protected", Value: protection},
+		{Label: "Fast restore copies", Value: fmt.Sprintf("%d of %d ready", readyCopies, p.warmCopies())},
+	}, nil
+}
+
+func (p *Provider) CheckIfSnapshotCanBeTaken(ctx context.Context, snapshotName string) error {
+	if err := provider.ValidateSnapshotName(snapshotName); err != nil {
+		return err
+	}
+
+	snapshotDBName := p.snapshotDatabaseName(snapshotName)
+
+	exists, err := p.doesDatabaseExist(ctx, snapshotDBName)
 	if err != nil {
 		return err
 	}
@@ -63,10 +199,10 @@ func (p *Provider) CheckIfSnapshotCanBeTaken(snapshotName string) error {
 	return nil
 }
 
-func (p *Provider) CheckIfSnapshotExists(snapshotName string) error {
-	snapshotDBName := snapshotDatabaseName(p.config.DatabaseName, snapshotName)
+func (p *Provider) CheckIfSnapshotExists(ctx context.Context, snapshotName string) error {
+	snapshotDBName := p.snapshotDatabaseName(snapshotName)
 
-	exists, err := p.doesDatabaseExist(snapshotDBName)
+	exists, err := p.doesDatabaseExist(ctx, snapshotDBName)
 	if err != nil {
 		return err
 	}
@@ -77,84 +213,178 @@ func (p *Provider) CheckIfSnapshotExists(snapshotName string) error {
 	return nil
 }
 
-func (p *Provider) CreateSnapshot(snapshotName string) error {
+func (p *Provider) CreateSnapshot(ctx context.Context, snapshotName string) error {
+	if err := provider.ValidateSnapshotName(snapshotName); err != nil {
+		return err
+	}
+
 	databaseName := p.config.DatabaseName
-	snapshotDBName := snapshotDatabaseName(databaseName, snapshotName)
+	snapshotDBName := p.snapshotDatabaseName(snapshotName)
 
-	if err := p.markOperationStart(databaseName); err != nil {
+	if err := p.markOperationStart(ctx, databaseName); err != nil {
 		return fmt.Errorf("failed to acquire operation lock: %v", err)
 	}
-	defer p.markOperationFinish(databaseName)
+	defer p.markOperationFinish(ctx, databaseName)
 
-	if err := p.markSnapshotStart(snapshotName); err != nil {
+	if err := p.markSnapshotStart(ctx, snapshotName); err != nil {
 		return fmt.Errorf("failed to mark snapshot start: %v", err)
 	}
-	defer p.markSnapshotFinish(snapshotName)
+	defer p.markSnapshotFinish(ctx, snapshotName)
+
+	if err := p.checkSnapshotSpace(ctx, ""); err != nil {
+		return fmt.Errorf("error creating snapshot: %v", err)
+	}
 
-	if err := p.createDatabaseCopy(databaseName, snapshotDBName); err != nil {
+	strategy, err := p.createDatabaseCopy(ctx, databaseName, snapshotDBName, p.config.SnapshotTablespace)
+	if err != nil {
+		return fmt.Errorf("error creating snapshot: %v", err)
+	}
+
+	if err := p.writeSnapshotMetadata(ctx, snapshotName, strategy, ""); err != nil {
+		p.removePartialDatabase(ctx, snapshotDBName)
+		return fmt.Errorf("error creating snapshot: %v", err)
+	}
+
+	if err := p.protectSnapshotDatabase(ctx, snapshotDBName); err != nil {
+		p.removePartialDatabase(ctx, snapshotDBName)
 		return fmt.Errorf("error creating snapshot: %v", err)
 	}
 
 	return nil
 }
 
-func (p *Provider) CreateSnapshotCopy(snapshotName string) error {
-	databaseName := p.config.DatabaseName
-	snapshotDBName := snapshotDatabaseName(databaseName, snapshotName)
-	snapshotCopyDBName := snapshotCopyDatabaseName(databaseName, snapshotName)
+// Fills the pool of pre-warmed copies of the snapshot up to the configured number of warm copies.
+// Only the snapshot lock is held, so restores can consume ready copies in the meantime.
+func (p *Provider) CreateSnapshotCopy(ctx context.Context, snapshotName string) error {
+	snapshotDBName := p.snapshotDatabaseName(snapshotName)
 
-	if err := p.markOperationStart(databaseName); err != nil {
-		return fmt.Errorf("failed to acquire operation lock: %v", err)
+	if err := p.markSnapshotStart(ctx, snapshotName); err != nil {
+		return fmt.Errorf("failed to mark snapshot start: %v", err)
 	}
-	defer p.markOperationFinish(databaseName)
+	defer p.markSnapshotFinish(ctx, snapshotName)
 
-	if err := p.terminateConnections(snapshotDBName); err != nil {
-		return fmt.Errorf("failed to terminate connections to snapshot: %v", err)
+	if err := p.CheckIfSnapshotExists(ctx, snapshotName); err != nil {
+		return err
 	}
 
-	if err := p.createDatabaseCopy(snapshotDBName, snapshotCopyDBName); err != nil {
-		return fmt.Errorf("failed to create snapshot copy: %v", err)
+	tablespace, err := p.snapshotCopyTablespace(ctx)
+	if err != nil {
+		return err
+	}
+
+	for index := 0; index < p.warmCopies(); index++ {
+		snapshotCopyDBName := p.snapshotCopyDatabaseName(snapshotName, index)
+
+		copyExists, err := p.doesDatabaseExist(ctx, snapshotCopyDBName)
+		if err != nil {
+			return err
+		}
+		if copyExists {
+			continue
+		}
+
+		if err := p.checkCopySpace(ctx, snapshotName); err != nil {
+			return fmt.Errorf("failed to create snapshot copy: %v", err)
+		}
+
+		if _, err := p.createDatabaseCopy(ctx, snapshotDBName, snapshotCopyDBName, tablespace); err != nil {
+			return fmt.Errorf("failed to create snapshot copy: %v", err)
+		}
 	}
 
 	return nil
 }
 
-func (p *Provider) RestoreSnapshot(snapshotName string) error {
-	databaseName := p.config.DatabaseName
-	snapshotDBName := snapshotDatabaseName(databaseName, snapshotName)
-	snapshotCopyDBName := snapshotCopyDatabaseName(databaseName, snapshotName)
+// Waits for a background process that is still creating copies of the snapshot.
+// If no copy is ready afterwards (e.g. the background process crashed), one is created synchronously.
+func (p *Provider) EnsureSnapshotCopy(ctx context.Context, snapshotName string) error {
+	if err := p.markSnapshotStart(ctx, snapshotName); err != nil {
+		return fmt.Errorf("failed to mark snapshot start: %v", err)
+	}
+	defer p.markSnapshotFinish(ctx, snapshotName)
+
+	if err := p.CheckIfSnapshotExists(ctx, snapshotName); err != nil {
+		return err
+	}
 
-	copyExists, err := p.doesDatabaseExist(snapshotCopyDBName)
+	copies, err := p.snapshotCopyDatabases(ctx, snapshotName)
 	if err != nil {
 		return err
 	}
-	if !copyExists {
-		return fmt.Errorf("snapshot copy %s does not exist. The snapshot may still be initializing or was not created properly", snapshotName)
+	if len(copies) > 0 {
+		return nil
+	}
+
+	tablespace, err := p.snapshotCopyTablespace(ctx)
+	if err != nil {
+		return err
+	}
+
+	snapshotDBName := p.snapshotDatabaseName(snapshotName)
+	if _, err := p.createDatabaseCopy(ctx, snapshotDBName, p.snapshotCopyDatabaseName(snapshotName, 0), tablespace); err != nil {
+		return fmt.Errorf("failed to create snapshot copy: %v", err)
+	}
+	return nil
+}
+
+func (p *Provider) RestoreSnapshot(ctx context.Context, snapshotName string) error {
+	databaseName := p.config.DatabaseName
+	snapshotDBName := p.snapshotDatabaseName(snapshotName)
+
+	if err := p.EnsureSnapshotCopy(ctx, snapshotName); err != nil {
+		return err
 	}
 
-	if err := p.markOperationStart(databaseName); err != nil {
+	if err := p.markOperationStart(ctx, databaseName); err != nil {
 		return fmt.Errorf("failed to acquire operation lock: %v", err)
 	}
-	defer p.markOperationFinish(databaseName)
+	defer p.markOperationFinish(ctx, databaseName)
 
-	if err := p.terminateConnections(databaseName); err != nil {
-		return fmt.Errorf("failed to terminate connections to database: %v", err)
+	// Another restore may have used the copy in the meantime
+	copies, err := p.snapshotCopyDatabases(ctx, snapshotName)
+	if err != nil {
+		return err
 	}
+	if len(copies) == 0 {
+		return fmt.Errorf("snapshot copy %s was used by another restore in the meantime. Please try again", snapshotName)
+	}
+	snapshotCopyDBName := copies[0]
 
-	if err := p.terminateConnections(snapshotCopyDBName); err != nil {
-		return fmt.Errorf("failed to terminate connections to snapshot copy: %v", err)
+	allMetadata, err := p.allSnapshotMetadata(ctx)
+	if err != nil {
+		return err
 	}
 
+	// Roles are created before the database is touched, so a failure leaves it as it is
+	if p.config.IncludeRoles {
+		metadata := allMetadata[snapshotDBName]
+		if err := p.ensureRoles(ctx, metadata.Roles, metadata.Memberships); err != nil {
+			return err
+		}
+	}
+
+	fence, err := p.fenceDatabases(ctx, databaseName, snapshotCopyDBName)
+	if err != nil {
+		return err
+	}
+	defer fence.release(ctx)
+
 	// Drop the current database and rename the copy to take its place
-	if err := p.dropDatabase(databaseName); err != nil {
+	if err := fence.retry(ctx, func() error { return p.dropDatabase(ctx, databaseName) }); err != nil {
 		return err
 	}
 
-	if err := p.renameDatabase(snapshotCopyDBName, databaseName); err != nil {
+	if err := fence.retry(ctx, func() error { return p.renameDatabase(ctx, snapshotCopyDBName, databaseName) }); err != nil {
 		return fmt.Errorf("failed to restore snapshot: %v", err)
 	}
+	fence.renamed(snapshotCopyDBName, databaseName)
+
+	// Snapshots taken before settings were captured leave the settings of the copy
+	if settings := allMetadata[snapshotDBName].Settings; settings != nil {
+		p.applyDatabaseSettings(ctx, databaseName, settings)
+	}
 
-	snapshotExists, err := p.doesDatabaseExist(snapshotDBName)
+	snapshotExists, err := p.doesDatabaseExist(ctx, snapshotDBName)
 	if err != nil {
 		return fmt.Errorf("failed to verify snapshot: %v", err)
 	}
@@ -165,245 +395,537 @@ func (p *Provider) RestoreSnapshot(snapshotName string) error {
 	return nil
 }
 
-func (p *Provider) RemoveSnapshot(snapshotName string) error {
-	databaseName := p.config.DatabaseName
-	snapshotDBName := snapshotDatabaseName(databaseName, snapshotName)
-	snapshotCopyDBName := snapshotCopyDatabaseName(databaseName, snapshotName)
-
-	if err := p.terminateConnections(snapshotDBName); err != nil {
-		return fmt.Errorf("failed to terminate connections to snapshot: %v", err)
-	}
-
-	if err := p.dropDatabase(snapshotDBName); err != nil {
-		return fmt.Errorf("failed to drop snapshot database: %v", err)
-	}
-
-	// Also remove the _copy database if it exists
-	copyExists, err := p.doesDatabaseExist(snapshotCopyDBName)
-	if err != nil {
-		return fmt.Errorf("failed to check if snapshot copy exists: %v", err)
-	}
-
-	if copyExists {
-		if err := p.terminateConnections(snapshotCopyDBName); err != nil {
-			return fmt.Errorf("failed to terminate connections to snapshot copy: %v", err)
-		}
-		if err := p.dropDatabase(snapshotCopyDBName); err != nil {
-			return fmt.Errorf("failed to drop snapshot copy database: %v", err)
-		}
+func (p *Provider) RemoveSnapshot(ctx context.Context, snapshotName string) error {
+	// Wait for a background process that is still creating copies of this snapshot
+	if err := p.markSnapshotStart(ctx, snapshotName); err != nil {
+		return fmt.Errorf("failed to mark snapshot start: %v", err)
 	}
+	defer p.markSnapshotFinish(ctx, snapshotName)
 
-	return nil
+	return p.dropSnapshotDatabases(ctx, snapshotName)
 }
 
-func (p *Provider) ReplaceSnapshot(snapshotName string) error {
+func (p *Provider) ReplaceSnapshot(ctx context.Context, snapshotName string) error {
 	databaseName := p.config.DatabaseName
 
-	if err := p.CheckIfSnapshotExists(snapshotName); err != nil {
+	if err := p.CheckIfSnapshotExists(ctx, snapshotName); err != nil {
 		return err
 	}
 
-	if err := p.markOperationStart(databaseName); err != nil {
+	if err := p.markOperationStart(ctx, databaseName); err != nil {
 		return fmt.Errorf("failed to acquire operation lock: %v", err)
 	}
-	defer p.markOperationFinish(databaseName)
+	defer p.markOperationFinish(ctx, databaseName)
 
-	if err := p.RemoveSnapshot(snapshotName); err != nil {
+	if err := p.markSnapshotStart(ctx, snapshotName); err != nil {
+		return fmt.Errorf("failed to mark snapshot start: %v", err)
+	}
+	defer p.markSnapshotFinish(ctx, snapshotName)
+
+	// Checked before the existing snapshot is dropped, so that it is kept if there is no room for the new one
+	if err := p.checkSnapshotSpace(ctx, snapshotName); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %v", err)
+	}
+
+	// The new snapshot keeps the description of the one it replaces
+	snapshotDBName := p.snapshotDatabaseName(snapshotName)
+	allMetadata, err := p.allSnapshotMetadata(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to replace snapshot: %v", err)
+	}
+	description := allMetadata[snapshotDBName].Description
+
+	if err := p.dropSnapshotDatabases(ctx, snapshotName); err != nil {
 		return fmt.Errorf("failed to remove existing snapshot: %v", err)
 	}
 
-	snapshotDBName := snapshotDatabaseName(databaseName, snapshotName)
+	strategy, err := p.createDatabaseCopy(ctx, databaseName, snapshotDBName, p.config.SnapshotTablespace)
+	if err != nil {
+		return fmt.Errorf("failed to create new snapshot: %v", err)
+	}
 
-	if err := p.markSnapshotStart(snapshotName); err != nil {
-		return fmt.Errorf("failed to mark snapshot start: %v", err)
+	if err := p.writeSnapshotMetadata(ctx, snapshotName, strategy, description); err != nil {
+		p.removePartialDatabase(ctx, snapshotDBName)
+		return fmt.Errorf("failed to create new snapshot: %v", err)
 	}
-	defer p.markSnapshotFinish(snapshotName)
 
-	if err := p.createDatabaseCopy(databaseName, snapshotDBName); err != nil {
+	if err := p.protectSnapshotDatabase(ctx, snapshotDBName); err != nil {
+		p.removePartialDatabase(ctx, snapshotDBName)
 		return fmt.Errorf("failed to create new snapshot: %v", err)
 	}
 
 	return nil
 }
 
-func (p *Provider) ListSnapshots() ([]provider.SnapshotInfo, error) {
+func (p *Provider) ReadySnapshotCopies(ctx context.Context, snapshotName string) (int, error) {
+	copies, err := p.snapshotCopyDatabases(ctx, snapshotName)
+	if err != nil {
+		return 0, err
+	}
+	return len(copies), nil
+}
+
+func (p *Provider) ListSnapshots(ctx context.Context) ([]provider.SnapshotInfo, error) {
 	databaseName := p.config.DatabaseName
-	snapshotNames, err := p.snapshotDatabasesForDatabase(databaseName)
+	snapshotNames, err := p.snapshotDatabasesForDatabase(ctx, databaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	allSnapshots, err := p.allSnapshotDatabases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	allMetadata, err := p.allSnapshotMetadata(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	snapshots := make([]provider.SnapshotInfo, 0, len(snapshotNames))
 	for _, name := range snapshotNames {
-		snapshotDBName := snapshotDatabaseName(databaseName, name)
-		creationTime, err := p.getDatabaseAge(snapshotDBName)
-		if err != nil {
-			snapshots = append(snapshots, provider.SnapshotInfo{Name: name, Age: 0})
-			continue
+		snapshots = append(snapshots, p.snapshotInfo(ctx, p.snapshotDatabaseName(name), name, allSnapshots, allMetadata))
+	}
+
+	return snapshots, nil
+}
+
+// Lists the snapshots of all databases in the configured namespace
+func (p *Provider) ListAllSnapshots(ctx context.Context) ([]provider.SnapshotInfo, error) {
+	allSnapshots, err := p.allSnapshotDatabases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	allMetadata, err := p.allSnapshotMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]provider.SnapshotInfo, 0)
+	for _, snapshotDB := range allSnapshots {
+		var databaseName, snapshotName string
+		if metadata, found := allMetadata[snapshotDB]; found {
+			if metadata.Namespace != p.config.Namespace {
+				continue
+			}
+			databaseName, snapshotName = metadata.Database, metadata.Snapshot
+		} else {
+			// Same as in snapshotDatabasesForDatabase, copies have no metadata and are skipped here
+			parts := strings.SplitN(snapshotDB, separator, 4)
+			if len(parts) != 4 || parts[1] != p.config.Namespace || snapshotCopySuffix.MatchString(parts[3]) {
+				continue
+			}
+			databaseName, snapshotName = parts[2], parts[3]
 		}
 
-		age := time.Since(creationTime)
-		snapshots = append(snapshots, provider.SnapshotInfo{Name: name, Age: age})
+		snapshot := p.snapshotInfo(ctx, snapshotDB, snapshotName, allSnapshots, allMetadata)
+		snapshot.Database = databaseName
+		snapshots = append(snapshots, snapshot)
 	}
 
 	return snapshots, nil
 }
 
-func (p *Provider) IsSnapshotInProgress(snapshotName string) bool {
-	lockID := int64(crc32.ChecksumIEEE([]byte(snapshotName)))
+func (p *Provider) snapshotInfo(ctx context.Context, snapshotDBName, snapshotName string, allSnapshots []string, allMetadata map[string]snapshotMetadata) provider.SnapshotInfo {
+	snapshot := provider.SnapshotInfo{Name: snapshotName, Description: allMetadata[snapshotDBName].Description}
 
-	var locked bool
-	err := p.dbConnection.QueryRow("SELECT pg_try_advisory_lock($1)", lockID).Scan(&locked)
-	if err != nil {
-		return true
+	for _, otherDBName := range allSnapshots {
+		if _, isCopy := snapshotCopyIndex(snapshotDBName, otherDBName); isCopy {
+			snapshot.ReadyCopies++
+		}
 	}
 
-	if locked {
-		_, _ = p.dbConnection.Exec("SELECT pg_advisory_unlock($1)", lockID)
-		return false
+	if creationTime, err := p.getDatabaseAge(ctx, snapshotDBName); err == nil {
+		snapshot.Age = time.Since(creationTime)
 	}
 
-	return true
+	if size, err := p.databaseSize(ctx, snapshotDBName); err == nil {
+		snapshot.Size = size
+		snapshot.DiskSize = size
+	}
+
+	if protected, err := p.isSnapshotDatabaseProtected(ctx, snapshotDBName); err == nil {
+		snapshot.Protected = protected
+	}
+
+	return snapshot
+}
+
+func (p *Provider) IsSnapshotInProgress(ctx context.Context, snapshotName string) bool {
+	return p.isLockHeld(ctx, p.snapshotLockKey(snapshotName))
 }
 
-func (p *Provider) IsOperationInProgress() bool {
-	lockID := p.operationLockID(p.config.DatabaseName)
+func (p *Provider) IsOperationInProgress(ctx context.Context) bool {
+	return p.isLockHeld(ctx, p.operationLockKey(p.config.DatabaseName))
+}
 
-	var locked bool
-	err := p.dbConnection.QueryRow("SELECT pg_try_advisory_lock($1)", lockID).Scan(&locked)
-	if err != nil {
-		return true
+// Blocks until the snapshot lock is free. Cancelling the context cancels the waiting query.
+func (p *Provider) WaitForOngoingSnapshot(ctx context.Context, snapshotName string) error {
+	if err := p.advisoryLock(ctx, p.snapshotLockKey(snapshotName)); err != nil {
+		return fmt.Errorf("failed waiting for ongoing snapshot to complete: %v", err)
 	}
 
-	if locked {
-		_, _ = p.dbConnection.Exec("SELECT pg_advisory_unlock($1)", lockID)
-		return false
+	p.markSnapshotFinish(ctx, snapshotName)
+	return nil
+}
+
+// Blocks until the operation lock is free. Cancelling the context cancels the waiting query.
+func (p *Provider) WaitForOngoingOperations(ctx context.Context) error {
+	if err := p.advisoryLock(ctx, p.operationLockKey(p.config.DatabaseName)); err != nil {
+		return fmt.Errorf("failed waiting for ongoing operation to complete: %v", err)
 	}
 
-	return true
+	p.markOperationFinish(ctx, p.config.DatabaseName)
+	return nil
 }
 
-func (p *Provider) WaitForOngoingSnapshot(snapshotName string) error {
-	lockID := int64(crc32.ChecksumIEEE([]byte(snapshotName)))
-	timeout := 30 * time.Minute
+// Looks up the sessions holding the operation lock or the lock of one of the snapshots.
+// Lunar sessions identify their process through application_name.
+func (p *Provider) LockHolders(ctx context.Context) ([]provider.LockHolder, error) {
+	snapshots, err := p.ListSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	locks := map[lockKey]string{p.operationLockKey(p.config.DatabaseName): "operation"}
+	for _, snapshot := range snapshots {
+		locks[p.snapshotLockKey(snapshot.Name)] = "snapshot " + snapshot.Name
+	}
 
-	_, err := p.dbConnection.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID)
+	query := `
+		SELECT l.classid::bigint, l.objid::bigint, a.pid, COALESCE(a.application_name, ''), a.backend_start
+		FROM pg_locks l
+		JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory'
+		AND l.granted
+		AND l.objsubid = 2
+		AND l.database = (SELECT oid FROM pg_database WHERE datname = current_database())
+		ORDER BY a.backend_start`
+
+	rows, err := p.dbConnection.QueryContext(ctx, query)
 	if err != nil {
-		return fmt.Errorf("timeout waiting for ongoing snapshot to complete: %v", err)
+		return nil, fmt.Errorf("failed to look up lock holders: %v", err)
+	}
+	defer rows.Close()
+
+	holders := make([]provider.LockHolder, 0)
+	for rows.Next() {
+		var classID, objID int64
+		var backendPID int
+		var applicationName string
+		var backendStart sql.NullTime
+		if err := rows.Scan(&classID, &objID, &backendPID, &applicationName, &backendStart); err != nil {
+			return nil, fmt.Errorf("failed to look up lock holders: %v", err)
+		}
+
+		// pg_locks shows the keys as unsigned oids
+		lock, ok := locks[lockKey{scope: int32(uint32(classID)), object: int32(uint32(objID))}]
+		if !ok {
+			continue
+		}
+
+		holder := parseApplicationName(applicationName)
+		holder.Lock = lock
+		holder.BackendPID = backendPID
+		if backendStart.Valid {
+			holder.StartedAt = backendStart.Time
+		}
+		holders = append(holders, holder)
+	}
+
+	return holders, rows.Err()
+}
+
+// Terminating the session makes PostgreSQL release all of its advisory locks
+func (p *Provider) BreakLock(ctx context.Context, holder provider.LockHolder) error {
+	if holder.BackendPID == 0 {
+		return fmt.Errorf("the session holding the %s lock is unknown", holder.Lock)
 	}
 
-	_, _ = p.dbConnection.Exec("SELECT pg_advisory_unlock($1)", lockID)
+	if _, err := p.dbConnection.ExecContext(ctx, "SELECT pg_terminate_backend($1)", holder.BackendPID); err != nil {
+		return fmt.Errorf("failed to terminate session %d: %v", holder.BackendPID, err)
+	}
 	return nil
 }
 
-func (p *Provider) WaitForOngoingOperations() error {
-	lockID := p.operationLockID(p.config.DatabaseName)
-	timeout := 30 * time.Minute
+func (p *Provider) warmCopies() int {
+	if p.config.WarmCopies < 1 {
+		return 1
+	}
+	return p.config.WarmCopies
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+// Returns the existing copies of the snapshot, ordered by their index in the pool.
+// Also includes copies beyond the configured pool size, e.g. after warm_copies was lowered.
+func (p *Provider) snapshotCopyDatabases(ctx context.Context, snapshotName string) ([]string, error) {
+	snapshotDBName := p.snapshotDatabaseName(snapshotName)
 
-	_, err := p.dbConnection.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID)
+	allSnapshots, err := p.allSnapshotDatabases(ctx)
 	if err != nil {
-		return fmt.Errorf("timeout waiting for ongoing operation to complete: %v", err)
+		return nil, err
+	}
+
+	indexes := make(map[string]int)
+	copies := make([]string, 0)
+	for _, databaseName := range allSnapshots {
+		if index, isCopy := snapshotCopyIndex(snapshotDBName, databaseName); isCopy {
+			indexes[databaseName] = index
+			copies = append(copies, databaseName)
+		}
+	}
+
+	sort.Slice(copies, func(i, j int) bool {
+		return indexes[copies[i]] < indexes[copies[j]]
+	})
+
+	return copies, nil
+}
+
+// Drops the snapshot database and all of its copies. Callers must hold the snapshot lock.
+func (p *Provider) dropSnapshotDatabases(ctx context.Context, snapshotName string) error {
+	snapshotDBName := p.snapshotDatabaseName(snapshotName)
+
+	if err := p.unprotectSnapshotDatabase(ctx, snapshotDBName); err != nil {
+		return err
+	}
+	if err := p.dropFencedDatabase(ctx, snapshotDBName); err != nil {
+		return fmt.Errorf("failed to drop snapshot database: %v", err)
+	}
+
+	copies, err := p.snapshotCopyDatabases(ctx, snapshotName)
+	if err != nil {
+		return fmt.Errorf("failed to check if snapshot copy exists: %v", err)
+	}
+
+	for _, snapshotCopyDBName := range copies {
+		if err := p.dropFencedDatabase(ctx, snapshotCopyDBName); err != nil {
+			return fmt.Errorf("failed to drop snapshot copy database: %v", err)
+		}
 	}
 
-	_, _ = p.dbConnection.Exec("SELECT pg_advisory_unlock($1)", lockID)
 	return nil
 }
 
-func (p *Provider) operationLockID(databaseName string) int64 {
-	return int64(crc32.ChecksumIEEE([]byte("op:" + databaseName)))
+// Advisory locks are taken with two keys: the first one identifies the database the lock belongs to,
+// the second one the locked object within it. The server needs no key, as every server has its own
+// advisory locks, and keys derived from the connection URL would differ for e.g. `localhost` and `127.0.0.1`.
+type lockKey struct {
+	scope  int32
+	object int32
 }
 
-func (p *Provider) markOperationStart(databaseName string) error {
-	lockID := p.operationLockID(databaseName)
-	_, err := p.dbConnection.Exec("SELECT pg_advisory_lock($1)", lockID)
-	if err != nil {
+// The target database is shared by everybody working with it, regardless of their namespace
+func (p *Provider) operationLockKey(databaseName string) lockKey {
+	return lockKey{
+		scope:  hashLockKey(databaseName),
+		object: hashLockKey("operation"),
+	}
+}
+
+func (p *Provider) snapshotLockKey(snapshotName string) lockKey {
+	return lockKey{
+		scope:  hashLockKey(p.config.Namespace, p.config.DatabaseName),
+		object: hashLockKey("snapshot", snapshotName),
+	}
+}
+
+func hashLockKey(parts ...string) int32 {
+	return int32(crc32.ChecksumIEEE([]byte(strings.Join(parts, separator))))
+}
+
+func (p *Provider) markOperationStart(ctx context.Context, databaseName string) error {
+	if err := p.advisoryLock(ctx, p.operationLockKey(databaseName)); err != nil {
 		return fmt.Errorf("failed to acquire operation lock: %v", err)
 	}
 	return nil
 }
 
-func (p *Provider) markOperationFinish(databaseName string) {
-	lockID := p.operationLockID(databaseName)
-	_, _ = p.dbConnection.Exec("SELECT pg_advisory_unlock($1)", lockID)
+// Locks are released even if the context was cancelled in the meantime
+func (p *Provider) markOperationFinish(ctx context.Context, databaseName string) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+
+	p.advisoryUnlock(ctx, p.operationLockKey(databaseName))
 }
 
-func (p *Provider) markSnapshotStart(snapshotName string) error {
-	lockID := int64(crc32.ChecksumIEEE([]byte(snapshotName)))
-	_, err := p.dbConnection.Exec("SELECT pg_advisory_lock($1)", lockID)
-	if err != nil {
+func (p *Provider) markSnapshotStart(ctx context.Context, snapshotName string) error {
+	if err := p.advisoryLock(ctx, p.snapshotLockKey(snapshotName)); err != nil {
 		return fmt.Errorf("failed to acquire snapshot lock: %v", err)
 	}
 	return nil
 }
 
-func (p *Provider) markSnapshotFinish(snapshotName string) {
-	lockID := int64(crc32.ChecksumIEEE([]byte(snapshotName)))
-	_, _ = p.dbConnection.Exec("SELECT pg_advisory_unlock($1)", lockID)
+func (p *Provider) markSnapshotFinish(ctx context.Context, snapshotName string) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+
+	p.advisoryUnlock(ctx, p.snapshotLockKey(snapshotName))
 }
 
-func (p *Provider) createDatabaseCopy(sourceDB, targetDB string) error {
-	if err := p.terminateConnections(sourceDB); err != nil {
-		return fmt.Errorf("failed to terminate connections: %v", err)
+// Returns the session that holds the advisory locks of this process. Its application_name
+// tells other Lunar processes who holds a lock, see LockHolders.
+func (p *Provider) lockSession(ctx context.Context) (*sql.Conn, error) {
+	if p.lockConnection != nil {
+		return p.lockConnection, nil
 	}
 
-	_, err := p.dbConnection.Exec(fmt.Sprintf("CREATE DATABASE \"%s\" TEMPLATE \"%s\"", targetDB, sourceDB))
+	conn, err := p.dbConnection.Conn(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create database copy: %v", err)
+		return nil, err
 	}
 
-	return nil
+	_, err = conn.ExecContext(ctx, "SELECT set_config('application_name', $1, false)", applicationName(provider.CurrentLockHolder()))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	p.lockConnection = conn
+	return conn, nil
+}
+
+func (p *Provider) advisoryLock(ctx context.Context, key lockKey) error {
+	conn, err := p.lockSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1, $2)", key.scope, key.object)
+	return err
+}
+
+func (p *Provider) advisoryUnlock(ctx context.Context, key lockKey) {
+	conn, err := p.lockSession(ctx)
+	if err != nil {
+		return
+	}
+
+	_, _ = conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1, $2)", key.scope, key.object)
+}
+
+// Errors count as held, so that callers wait rather than interfere with another process
+func (p *Provider) isLockHeld(ctx context.Context, key lockKey) bool {
+	conn, err := p.lockSession(ctx)
+	if err != nil {
+		return true
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1, $2)", key.scope, key.object).Scan(&locked); err != nil {
+		return true
+	}
+
+	if locked {
+		p.advisoryUnlock(ctx, key)
+		return false
+	}
+	return true
+}
+
+// Copies the source into the given tablespace (or the tablespace of the source if empty)
+// and returns the strategy that was used. The source must not have any connections while it is copied.
+func (p *Provider) createDatabaseCopy(ctx context.Context, sourceDB, targetDB, tablespace string) (string, error) {
+	strategy, withStrategy, err := p.resolveCreateStrategy(ctx, sourceDB)
+	if err != nil {
+		return "", err
+	}
+
+	fence, err := p.fenceDatabases(ctx, sourceDB)
+	if err != nil {
+		return "", err
+	}
+	defer fence.release(ctx)
+
+	stopWatching := p.watchCopyProgress(ctx, sourceDB, tablespace)
+
+	// When the context is cancelled, lib/pq sends a cancel request for the running statement,
+	// which has the same effect as pg_cancel_backend
+	err = fence.retry(ctx, func() error {
+		_, err := p.dbConnection.ExecContext(ctx, createDatabaseStatement(sourceDB, targetDB, strategy, withStrategy, tablespace))
+		return err
+	})
+	stopWatching()
+	if err != nil {
+		if ctx.Err() != nil {
+			p.removePartialDatabase(ctx, targetDB)
+		}
+		return "", fmt.Errorf("failed to create database copy: %v", err)
+	}
+
+	return strategy, nil
 }
 
-func (p *Provider) terminateConnections(databaseName string) error {
+// A cancelled CREATE DATABASE is rolled back by PostgreSQL. But the cancel request can arrive
+// too late, so make sure that an interrupted snapshot doesn't leave a database behind.
+func (p *Provider) removePartialDatabase(ctx context.Context, databaseName string) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+
+	p.dropDatabase(ctx, databaseName)
+}
+
+// Returns a context for cleanups that have to run even after the
+// context of the operation was cancelled or timed out
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+}
+
+func (p *Provider) terminateConnections(ctx context.Context, databaseName string) error {
 	query := `
 		SELECT pg_terminate_backend(pid)
 		FROM pg_stat_activity
 		WHERE datname = $1
 		AND pid <> pg_backend_pid()`
 
-	_, err := p.dbConnection.Exec(query, databaseName)
+	_, err := p.dbConnection.ExecContext(ctx, query, databaseName)
 	return err
 }
 
-func (p *Provider) doesDatabaseExist(databaseName string) (bool, error) {
+func (p *Provider) doesDatabaseExist(ctx context.Context, databaseName string) (bool, error) {
 	var exists bool
-	err := p.dbConnection.QueryRow("SELECT EXISTS(SELECT 1 FROM pg_database WHERE datname = $1)", databaseName).Scan(&exists)
+	err := p.dbConnection.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM pg_database WHERE datname = $1)", databaseName).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to check database existence: %v", err)
 	}
 	return exists, nil
 }
 
-func (p *Provider) dropDatabase(databaseName string) error {
-	_, err := p.dbConnection.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS \"%s\"", databaseName))
+// Drops the database, keeping clients from reconnecting in the meantime
+func (p *Provider) dropFencedDatabase(ctx context.Context, databaseName string) error {
+	fence, err := p.fenceDatabases(ctx, databaseName)
+	if err != nil {
+		return err
+	}
+	defer fence.release(ctx)
+
+	return fence.retry(ctx, func() error { return p.dropDatabase(ctx, databaseName) })
+}
+
+func (p *Provider) dropDatabase(ctx context.Context, databaseName string) error {
+	_, err := p.dbConnection.ExecContext(ctx, "DROP DATABASE IF EXISTS "+pq.QuoteIdentifier(databaseName))
 	if err != nil {
-		return fmt.Errorf("failed to drop database: %v", err)
+		return fmt.Errorf("failed to drop database: %w", err)
 	}
 	return nil
 }
 
-func (p *Provider) renameDatabase(oldName, newName string) error {
-	_, err := p.dbConnection.Exec(fmt.Sprintf("ALTER DATABASE \"%s\" RENAME TO \"%s\"", oldName, newName))
+func (p *Provider) renameDatabase(ctx context.Context, oldName, newName string) error {
+	_, err := p.dbConnection.ExecContext(ctx, "ALTER DATABASE "+pq.QuoteIdentifier(oldName)+" RENAME TO "+pq.QuoteIdentifier(newName))
 	if err != nil {
-		return fmt.Errorf("failed to rename database: %v", err)
+		return fmt.Errorf("failed to rename database: %w", err)
 	}
 	return nil
 }
 
-func (p *Provider) getDatabaseAge(databaseName string) (time.Time, error) {
+func (p *Provider) getDatabaseAge(ctx context.Context, databaseName string) (time.Time, error) {
 	var creationTime time.Time
 	query := `
 		SELECT (pg_stat_file('base/'|| oid ||'/PG_VERSION')).modification
 		FROM pg_database
 		WHERE datname = $1`
 
-	err := p.dbConnection.QueryRow(query, databaseName).Scan(&creationTime)
+	err := p.dbConnection.QueryRowContext(ctx, query, databaseName).Scan(&creationTime)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("failed to get database age: %v", err)
 	}
@@ -411,10 +933,13 @@ func (p *Provider) getDatabaseAge(databaseName string) (time.Time, error) {
 	return creationTime, nil
 }
 
-func (p *Provider) allDatabases() ([]string, error) {
+// Protected snapshot databases are templates, so only the built-in templates are left out
+const allDatabasesQuery = "SELECT datname FROM pg_database WHERE datname NOT IN ('template0', 'template1')"
+
+func (p *Provider) allDatabases(ctx context.Context) ([]string, error) {
 	databases := make([]string, 0)
 
-	rows, err := p.dbConnection.Query("SELECT datname FROM pg_database WHERE datistemplate = false")
+	rows, err := p.dbConnection.QueryContext(ctx, allDatabasesQuery)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query databases: %v", err)
 	}
@@ -435,17 +960,15 @@ func (p *Provider) allDatabases() ([]string, error) {
 	return databases, nil
 }
 
-func (p *Provider) allSnapshotDatabases() ([]string, error) {
-	databases, err := p.allDatabases()
+func (p *Provider) allSnapshotDatabases(ctx context.Context) ([]string, error) {
+	databases, err := p.allDatabases(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	snapshotDatabases := make([]string, 0)
-	expectedPrefix := "lunar_snapshot" + separator
-
 	for _, databaseName := range databases {
-		if len(databaseName) >= len(expectedPrefix) && databaseName[:len(expectedPrefix)] == expectedPrefix {
+		if strings.HasPrefix(databaseName, snapshotPrefix) {
 			snapshotDatabases = append(snapshotDatabases, databaseName)
 		}
 	}
@@ -453,19 +976,129 @@ func (p *Provider) allSnapshotDatabases() ([]string, error) {
 	return snapshotDatabases, nil
 }
 
-func (p *Provider) snapshotDatabasesForDatabase(databaseName string) ([]string, error) {
-	allSnapshots, err := p.allSnapshotDatabases()
+// snapshotMetadata is stored as comment of the snapshot database, so that snapshots
+// with a hashed database name can be listed
+type snapshotMetadata struct {
+	Namespace string `json:"namespace"`
+	Database  string `json:"database"`
+	Snapshot  string `json:"snapshot"`
+	// CREATE DATABASE strategy the snapshot was created with
+	Strategy string `json:"strategy,omitempty"`
+	// Settings of the database at snapshot time, reapplied on restore
+	Settings *databaseSettings `json:"settings,omitempty"`
+	// Roles referenced by the database, only recorded with `include_roles`
+	Roles       []role           `json:"roles,omitempty"`
+	Memberships []roleMembership `json:"memberships,omitempty"`
+	// Fingerprint of the schema and rows, checked by `lunar verify`
+	Checksum string `json:"checksum,omitempty"`
+	// Set with `lunar describe`, kept when the snapshot is replaced
+	Description string `json:"description,omitempty"`
+}
+
+func (p *Provider) writeSnapshotMetadata(ctx context.Context, snapshotName, strategy, description string) error {
+	settings, err := p.captureDatabaseSettings(ctx, p.config.DatabaseName)
+	if err != nil {
+		return err
+	}
+
+	metadata := snapshotMetadata{
+		Namespace:   p.config.Namespace,
+		Database:    p.config.DatabaseName,
+		Snapshot:    snapshotName,
+		Strategy:    strategy,
+		Settings:    settings,
+		Description: description,
+	}
+	if p.config.IncludeRoles {
+		metadata.Roles, metadata.Memberships, err = p.captureRoles(ctx, p.config.DatabaseName)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.withSnapshotConnection(ctx, p.snapshotDatabaseName(snapshotName), func(db *sql.DB) error {
+		checksum, err := databaseFingerprint(ctx, db)
+		metadata.Checksum = checksum
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to compute snapshot checksum: %v", err)
+	}
+
+	return p.commentSnapshotMetadata(ctx, p.snapshotDatabaseName(snapshotName), metadata)
+}
+
+func (p *Provider) commentSnapshotMetadata(ctx context.Context, snapshotDBName string, metadata snapshotMetadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot metadata: %v", err)
+	}
+
+	// COMMENT doesn't accept parameters
+	query := "COMMENT ON DATABASE " + pq.QuoteIdentifier(snapshotDBName) + " IS " + pq.QuoteLiteral(string(data))
+	if _, err := p.dbConnection.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to write snapshot metadata: %v", err)
+	}
+	return nil
+}
+
+// Returns the metadata of the snapshot databases by database name. Copies and
+// snapshots created before metadata was written have none.
+func (p *Provider) allSnapshotMetadata(ctx context.Context) (map[string]snapshotMetadata, error) {
+	query := `
+		SELECT datname, shobj_description(oid, 'pg_database')
+		FROM pg_database
+		WHERE left(datname, length($1)) = $1
+		AND shobj_description(oid, 'pg_database') IS NOT NULL`
+
+	rows, err := p.dbConnection.QueryContext(ctx, query, snapshotPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snapshot metadata: %v", err)
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]snapshotMetadata)
+	for rows.Next() {
+		var databaseName, comment string
+		if err := rows.Scan(&databaseName, &comment); err != nil {
+			return nil, fmt.Errorf("failed to scan snapshot metadata: %v", err)
+		}
+
+		var snapshot snapshotMetadata
+		if err := json.Unmarshal([]byte(comment), &snapshot); err == nil {
+			metadata[databaseName] = snapshot
+		}
+	}
+
+	return metadata, rows.Err()
+}
+
+// Returns the names of the snapshots of the database in the configured namespace
+func (p *Provider) snapshotDatabasesForDatabase(ctx context.Context, databaseName string) ([]string, error) {
+	allSnapshots, err := p.allSnapshotDatabases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	allMetadata, err := p.allSnapshotMetadata(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	snapshots := make([]string, 0)
 	for _, snapshotDB := range allSnapshots {
-		parts := strings.Split(snapshotDB, separator)
+		if metadata, found := allMetadata[snapshotDB]; found {
+			if metadata.Namespace == p.config.Namespace && metadata.Database == databaseName {
+				snapshots = append(snapshots, metadata.Snapshot)
+			}
+			continue
+		}
 
-		if len(parts) >= 3 && parts[1] == databaseName {
-			snapshotName := parts[2]
-			if !strings.HasSuffix(snapshotName, "_copy") {
+		// Hashed names have fewer parts, so copies of hashed snapshots are skipped as well
+		parts := strings.SplitN(snapshotDB, separator, 4)
+		if len(parts) == 4 && parts[1] == p.config.Namespace && parts[2] == databaseName {
+			snapshotName := parts[3]
+			if !snapshotCopySuffix.MatchString(snapshotName) {
 				snapshots = append(snapshots, snapshotName)
 			}
 		}
@@ -474,21 +1107,106 @@ func (p *Provider) snapshotDatabasesForDatabase(databaseName string) ([]string,
 	return snapshots, nil
 }
 
-func (p *Provider) GetDatabaseSize() (int64, error) {
+func (p *Provider) GetDatabaseSize(ctx context.Context) (int64, error) {
+	return p.databaseSize(ctx, p.config.DatabaseName)
+}
+
+// Counts the rows written to the database. A restore replaces the database, which changes its OID.
+// The counters are approximate: sessions report their writes only when their transaction ends and at most
+// once a second (or after several seconds when they go idle), and pg_stat_force_next_flush() only flushes
+// the calling session, so recent writes of other sessions may be missing. Resetting the statistics counts
+// as a modification.
+func (p *Provider) DatabaseFingerprint(ctx context.Context) (string, error) {
+	query := `
+		SELECT d.oid, COALESCE(s.tup_inserted + s.tup_updated + s.tup_deleted, 0)
+		FROM pg_database d
+		LEFT JOIN pg_stat_database s ON s.datid = d.oid
+		WHERE d.datname = $1`
+
+	var oid, writes int64
+	if err := p.dbConnection.QueryRowContext(ctx, query, p.config.DatabaseName).Scan(&oid, &writes); err != nil {
+		return "", fmt.Errorf("failed to fingerprint database: %v", err)
+	}
+	return fmt.Sprintf("%d:%d", oid, writes), nil
+}
+
+func (p *Provider) databaseSize(ctx context.Context, databaseName string) (int64, error) {
 	var size int64
-	err := p.dbConnection.QueryRow("SELECT pg_database_size($1)", p.config.DatabaseName).Scan(&size)
+	err := p.dbConnection.QueryRowContext(ctx, "SELECT pg_database_size($1)", databaseName).Scan(&size)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get database size: %v", err)
 	}
 	return size, nil
 }
 
-func snapshotDatabaseName(databaseName, snapshotName string) string {
-	return "lunar_snapshot" + separator + databaseName + separator + snapshotName
+// PostgreSQL truncates longer application names
+const maxApplicationNameLength = 63
+
+var applicationNamePattern = regexp.MustCompile(`^lunar pid=(\d+) host=(\S*) (.*)$`)
+
+func applicationName(holder provider.LockHolder) string {
+	name := fmt.Sprintf("lunar pid=%d host=%s %s", holder.PID, holder.Host, holder.Command)
+	if len(name) > maxApplicationNameLength {
+		name = name[:maxApplicationNameLength]
+	}
+	return name
+}
+
+// Sessions of other applications or without the permission to see their details
+// result in a holder without PID
+func parseApplicationName(name string) provider.LockHolder {
+	match := applicationNamePattern.FindStringSubmatch(name)
+	if match == nil {
+		return provider.LockHolder{}
+	}
+
+	pid, _ := strconv.Atoi(match[1])
+	return provider.LockHolder{PID: pid, Host: match[2], Command: match[3]}
+}
+
+// Snapshot databases are named `lunar_snapshot____<namespace>____<database>____<snapshot>`.
+// Names that don't fit into an identifier or contain other characters than ASCII letters,
+// digits, `_`, `.` and `-` are hashed to `lunar_snapshot____h____<hash>`. The comment of the
+// database keeps the actual names, see writeSnapshotMetadata.
+func (p *Provider) snapshotDatabaseName(snapshotName string) string {
+	name := snapshotPrefix + p.config.Namespace + separator + p.config.DatabaseName + separator + snapshotName
+	if provider.IsPlainSnapshotName(snapshotName) && len(name) <= maxSnapshotDatabaseNameLength {
+		return name
+	}
+
+	return snapshotPrefix + hashedNameMarker + separator + provider.HashedName(p.config.Namespace, p.config.DatabaseName, snapshotName)
+}
+
+// Returns the name of a pre-warmed copy. The first copy is named `<snapshot>_copy`,
+// further copies of the pool `<snapshot>_copy2`, `<snapshot>_copy3`, ...
+func (p *Provider) snapshotCopyDatabaseName(snapshotName string, index int) string {
+	name := p.snapshotDatabaseName(snapshotName) + "_copy"
+	if index > 0 {
+		name += strconv.Itoa(index + 1)
+	}
+	return name
 }
 
-func snapshotCopyDatabaseName(databaseName, snapshotName string) string {
-	return snapshotDatabaseName(databaseName, snapshotName) + "_copy"
+// Matches the suffix of pre-warmed copies: `_copy`, `_copy2`, `_copy3`, ...
+var snapshotCopySuffix = regexp.MustCompile(`_copy([2-9]|[1-9][0-9]+)?$`)
+
+// Returns the index in the pool if the given database is a copy of the snapshot database
+func snapshotCopyIndex(snapshotDBName, databaseName string) (int, bool) {
+	suffix, found := strings.CutPrefix(databaseName, snapshotDBName)
+	if !found {
+		return 0, false
+	}
+
+	match := snapshotCopySuffix.FindStringSubmatch(suffix)
+	if match == nil || match[0] != suffix {
+		return 0, false
+	}
+	if match[1] == "" {
+		return 0, true
+	}
+
+	number, _ := strconv.Atoi(match[1])
+	return number - 1, true
 }
 
 func defaultMaintenanceDatabases() []string {
@@ -578,7 +1296,7 @@ func ConnectToMaintenanceDatabaseWithURL(databaseURL string) (*sql.DB, error) {
 func AllDatabasesWithConnection(db *sql.DB) ([]string, error) {
 	databases := make([]string, 0)
 
-	rows, err := db.Query("SELECT datname FROM pg_database WHERE datistemplate = false")
+	rows, err := db.Query(allDatabasesQuery)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query databases: %v", err)
 	}
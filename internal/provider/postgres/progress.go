@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/leonvogt/lunar/internal/provider"
+)
+
+const progressPollInterval = 500 * time.Millisecond
+
+// The new database only becomes visible once CREATE DATABASE commits, so its size can't be
+// queried while it is copied. Its files grow in the target tablespace though, so the growth of
+// the tablespace is reported as the progress of the copy. Returns a function that stops watching.
+func (p *Provider) watchCopyProgress(ctx context.Context, sourceDB, tablespace string) func() {
+	if !provider.HasProgress(ctx) {
+		return func() {}
+	}
+
+	if tablespace == "" {
+		tablespace, _ = p.databaseTablespace(ctx, sourceDB)
+	}
+	if tablespace == "" {
+		return func() {}
+	}
+	baseline, err := p.tablespaceSize(ctx, tablespace)
+	if err != nil {
+		return func() {}
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(progressPollInterval)
+		defer ticker.Stop()
+
+		var reported int64
+		for {
+			select {
+			case <-watchCtx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			size, err := p.tablespaceSize(watchCtx, tablespace)
+			if err != nil {
+				continue
+			}
+			if growth := size - baseline; growth > reported {
+				provider.ReportProgress(ctx, growth-reported)
+				reported = growth
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// Requires the CREATE privilege on the tablespace, except for the default tablespace of the maintenance database
+func (p *Provider) tablespaceSize(ctx context.Context, tablespace string) (int64, error) {
+	var size int64
+	err := p.dbConnection.QueryRowContext(ctx, "SELECT pg_tablespace_size($1)", tablespace).Scan(&size)
+	return size, err
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Marks the snapshot database as a template nobody can connect to, so that tools which connect to
+// every database (e.g. GUI clients) can't modify it. Copies are created without connecting to it.
+func (p *Provider) protectSnapshotDatabase(ctx context.Context, databaseName string) error {
+	_, err := p.dbConnection.ExecContext(ctx, "ALTER DATABASE "+pq.QuoteIdentifier(databaseName)+" IS_TEMPLATE true ALLOW_CONNECTIONS false")
+	if err != nil {
+		return fmt.Errorf("failed to protect snapshot database: %v", err)
+	}
+	return nil
+}
+
+// Template databases can't be dropped, so the protection is lifted before dropping a snapshot
+func (p *Provider) unprotectSnapshotDatabase(ctx context.Context, databaseName string) error {
+	exists, err := p.doesDatabaseExist(ctx, databaseName)
+	if err != nil || !exists {
+		return err
+	}
+
+	_, err = p.dbConnection.ExecContext(ctx, "ALTER DATABASE "+pq.QuoteIdentifier(databaseName)+" IS_TEMPLATE false")
+	if err != nil {
+		return fmt.Errorf("failed to unprotect snapshot database: %v", err)
+	}
+	return nil
+}
+
+// Protects the snapshot again or lifts the protection until it's protected again, e.g. to inspect the
+// snapshot with a database client. Unlike the lifting inside Lunar operations, this also allows connections.
+func (p *Provider) SetSnapshotProtection(ctx context.Context, snapshotName string, protected bool) error {
+	if err := p.CheckIfSnapshotExists(ctx, snapshotName); err != nil {
+		return err
+	}
+
+	// No copy may be created while the protection changes
+	if err := p.markSnapshotStart(ctx, snapshotName); err != nil {
+		return fmt.Errorf("failed to mark snapshot start: %v", err)
+	}
+	defer p.markSnapshotFinish(ctx, snapshotName)
+
+	snapshotDBName := p.snapshotDatabaseName(snapshotName)
+	if protected {
+		return p.protectSnapshotDatabase(ctx, snapshotDBName)
+	}
+
+	_, err := p.dbConnection.ExecContext(ctx, "ALTER DATABASE "+pq.QuoteIdentifier(snapshotDBName)+" IS_TEMPLATE false ALLOW_CONNECTIONS true")
+	if err != nil {
+		return fmt.Errorf("failed to unprotect snapshot database: %v", err)
+	}
+	return nil
+}
+
+func (p *Provider) isSnapshotDatabaseProtected(ctx context.Context, databaseName string) (bool, error) {
+	var protected bool
+	err := p.dbConnection.QueryRowContext(ctx, "SELECT datistemplate AND NOT datallowconn FROM pg_database WHERE datname = $1", databaseName).Scan(&protected)
+	if err != nil {
+		return false, fmt.Errorf("failed to check the protection of %s: %v", databaseName, err)
+	}
+	return protected, nil
+}
@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/leonvogt/lunar/internal/provider"
+)
+
+// Renames the snapshot database and its copies. The metadata is updated before the database is renamed,
+// so that snapshots with hashed names are listed under the new name right away.
+func (p *Provider) RenameSnapshot(ctx context.Context, snapshotName, newName string) error {
+	if err := provider.ValidateSnapshotName(newName); err != nil {
+		return err
+	}
+	if err := p.CheckIfSnapshotExists(ctx, snapshotName); err != nil {
+		return err
+	}
+
+	// No copy of the snapshot and no snapshot with the new name may be created meanwhile
+	if err := p.markSnapshotStart(ctx, snapshotName); err != nil {
+		return fmt.Errorf("failed to mark snapshot start: %v", err)
+	}
+	defer p.markSnapshotFinish(ctx, snapshotName)
+	if err := p.markSnapshotStart(ctx, newName); err != nil {
+		return fmt.Errorf("failed to mark snapshot start: %v", err)
+	}
+	defer p.markSnapshotFinish(ctx, newName)
+
+	if err := p.CheckIfSnapshotCanBeTaken(ctx, newName); err != nil {
+		return err
+	}
+
+	snapshotDBName := p.snapshotDatabaseName(snapshotName)
+	newDBName := p.snapshotDatabaseName(newName)
+
+	copies, err := p.snapshotCopyDatabases(ctx, snapshotName)
+	if err != nil {
+		return err
+	}
+	allMetadata, err := p.allSnapshotMetadata(ctx)
+	if err != nil {
+		return err
+	}
+	metadata, found := allMetadata[snapshotDBName]
+	if !found {
+		// Snapshots of earlier versions of Lunar have no metadata yet
+		metadata = snapshotMetadata{Namespace: p.config.Namespace, Database: p.config.DatabaseName}
+	}
+	previousMetadata := metadata
+	metadata.Snapshot = newName
+
+	fence, err := p.fenceDatabases(ctx, append([]string{snapshotDBName}, copies...)...)
+	if err != nil {
+		return err
+	}
+	defer fence.release(ctx)
+
+	if err := p.commentSnapshotMetadata(ctx, snapshotDBName, metadata); err != nil {
+		return err
+	}
+	if err := fence.retry(ctx, func() error { return p.renameDatabase(ctx, snapshotDBName, newDBName) }); err != nil {
+		if found {
+			_ = p.commentSnapshotMetadata(ctx, snapshotDBName, previousMetadata)
+		}
+		return fmt.Errorf("failed to rename snapshot: %v", err)
+	}
+	fence.renamed(snapshotDBName, newDBName)
+
+	// Copies are only there to speed up restores, so a copy that can't be renamed is dropped instead
+	for _, copyDBName := range copies {
+		newCopyDBName := newDBName + strings.TrimPrefix(copyDBName, snapshotDBName)
+		err := fence.retry(ctx, func() error { return p.renameDatabase(ctx, copyDBName, newCopyDBName) })
+		if err != nil {
+			p.removePartialDatabase(ctx, copyDBName)
+			continue
+		}
+		fence.renamed(copyDBName, newCopyDBName)
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// A role referenced by the database, recorded with `include_roles`. Passwords are never recorded.
+type role struct {
+	Name        string `json:"name"`
+	Superuser   bool   `json:"superuser,omitempty"`
+	Inherit     bool   `json:"inherit"`
+	CreateRole  bool   `json:"create_role,omitempty"`
+	CreateDB    bool   `json:"create_db,omitempty"`
+	Login       bool   `json:"login,omitempty"`
+	Replication bool   `json:"replication,omitempty"`
+	BypassRLS   bool   `json:"bypass_rls,omitempty"`
+}
+
+type roleMembership struct {
+	Role        string `json:"role"`
+	Member      string `json:"member"`
+	AdminOption bool   `json:"admin_option,omitempty"`
+}
+
+func (r role) options() []string {
+	option := func(enabled bool, name string) string {
+		if enabled {
+			return name
+		}
+		return "NO" + name
+	}
+
+	return []string{
+		option(r.Superuser, "SUPERUSER"),
+		option(r.Inherit, "INHERIT"),
+		option(r.CreateRole, "CREATEROLE"),
+		option(r.CreateDB, "CREATEDB"),
+		option(r.Login, "LOGIN"),
+		option(r.Replication, "REPLICATION"),
+		option(r.BypassRLS, "BYPASSRLS"),
+	}
+}
+
+// Returns the roles that own objects in the database, have privileges on them or on the database
+// or have settings in it, together with the roles they are members of. Predefined roles are skipped.
+func (p *Provider) captureRoles(ctx context.Context, databaseName string) ([]role, []roleMembership, error) {
+	query := `
+		WITH RECURSIVE db AS (
+			SELECT oid FROM pg_database WHERE datname = $1
+		), referenced AS (
+			SELECT oid FROM (
+				SELECT d.refobjid AS oid
+				FROM pg_shdepend d, db
+				WHERE d.refclassid = 'pg_authid'::regclass
+				AND (d.dbid = db.oid OR (d.dbid = 0 AND d.classid = 'pg_database'::regclass AND d.objid = db.oid))
+				UNION
+				SELECT s.setrole FROM pg_db_role_setting s, db WHERE s.setdatabase = db.oid AND s.setrole <> 0
+			) seeds
+			UNION
+			SELECT m.roleid FROM pg_auth_members m JOIN referenced r ON m.member = r.oid
+		)
+		SELECT r.rolname, r.rolsuper, r.rolinherit, r.rolcreaterole, r.rolcreatedb, r.rolcanlogin, r.rolreplication, r.rolbypassrls
+		FROM pg_roles r
+		JOIN referenced ON referenced.oid = r.oid
+		WHERE r.rolname NOT LIKE 'pg\_%'
+		ORDER BY r.rolname`
+
+	rows, err := p.dbConnection.QueryContext(ctx, query, databaseName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query the roles of %s: %v", databaseName, err)
+	}
+	defer rows.Close()
+
+	var roles []role
+	var names []string
+	for rows.Next() {
+		var r role
+		if err := rows.Scan(&r.Name, &r.Superuser, &r.Inherit, &r.CreateRole, &r.CreateDB, &r.Login, &r.Replication, &r.BypassRLS); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan the roles of %s: %v", databaseName, err)
+		}
+		roles = append(roles, r)
+		names = append(names, r.Name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	memberships, err := p.roleMemberships(ctx, names)
+	if err != nil {
+		return nil, nil, err
+	}
+	return roles, memberships, nil
+}
+
+// Returns the memberships of the given roles
+func (p *Provider) roleMemberships(ctx context.Context, memberNames []string) ([]roleMembership, error) {
+	query := `
+		SELECT g.rolname, m.rolname, a.admin_option
+		FROM pg_auth_members a
+		JOIN pg_roles g ON g.oid = a.roleid
+		JOIN pg_roles m ON m.oid = a.member
+		WHERE m.rolname = ANY($1)
+		ORDER BY g.rolname, m.rolname`
+
+	rows, err := p.dbConnection.QueryContext(ctx, query, pq.Array(memberNames))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query role memberships: %v", err)
+	}
+	defer rows.Close()
+
+	var memberships []roleMembership
+	for rows.Next() {
+		var membership roleMembership
+		if err := rows.Scan(&membership.Role, &membership.Member, &membership.AdminOption); err != nil {
+			return nil, fmt.Errorf("failed to scan role memberships: %v", err)
+		}
+		memberships = append(memberships, membership)
+	}
+	return memberships, rows.Err()
+}
+
+// Returns the options a missing role is created with. Roles are created without passwords, so SUPERUSER,
+// REPLICATION and BYPASSRLS are never granted, and LOGIN only with `include_roles_login`: with trust or peer
+// authentication anybody could use them. Also returns the recorded options that were left out.
+func (p *Provider) creationOptions(r role) (role, []string) {
+	created := r
+	created.Superuser, created.Replication, created.BypassRLS = false, false, false
+	created.Login = r.Login && p.config.IncludeRolesLogin
+
+	var omitted []string
+	recorded, options := r.options(), created.options()
+	for i := range recorded {
+		if recorded[i] != options[i] {
+			omitted = append(omitted, recorded[i])
+		}
+	}
+	return created, omitted
+}
+
+// Creates the recorded roles and memberships that are missing in the cluster. Existing roles
+// are left alone, differences to the recorded ones are added to the warnings.
+func (p *Provider) ensureRoles(ctx context.Context, roles []role, memberships []roleMembership) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, r := range roles {
+		names = append(names, r.Name)
+	}
+
+	existing, err := p.existingRoles(ctx, names)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range roles {
+		current, found := existing[r.Name]
+		if !found {
+			created, omitted := p.creationOptions(r)
+			statement := "CREATE ROLE " + pq.QuoteIdentifier(r.Name) + " WITH " + strings.Join(created.options(), " ")
+			if _, err := p.dbConnection.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("failed to create role %s: %v", r.Name, err)
+			}
+			if len(omitted) > 0 {
+				p.warn("role %s was created without %s, grant them with ALTER ROLE if needed", r.Name, strings.Join(omitted, ", "))
+			}
+			continue
+		}
+
+		recorded, actual := r.options(), current.options()
+		for i := range recorded {
+			if recorded[i] != actual[i] {
+				p.warn("role %s is %s in the snapshot but %s in the cluster", r.Name, recorded[i], actual[i])
+			}
+		}
+	}
+
+	currentMemberships, err := p.roleMemberships(ctx, names)
+	if err != nil {
+		return err
+	}
+	granted := make(map[roleMembership]bool)
+	for _, membership := range currentMemberships {
+		granted[roleMembership{Role: membership.Role, Member: membership.Member}] = true
+	}
+
+	for _, membership := range memberships {
+		if granted[roleMembership{Role: membership.Role, Member: membership.Member}] {
+			continue
+		}
+
+		// Memberships are only added to roles created for the restore
+		if _, found := existing[membership.Member]; found {
+			p.warn("role %s is a member of %s in the snapshot but not in the cluster", membership.Member, membership.Role)
+			continue
+		}
+
+		statement := "GRANT " + pq.QuoteIdentifier(membership.Role) + " TO " + pq.QuoteIdentifier(membership.Member)
+		if membership.AdminOption {
+			statement += " WITH ADMIN OPTION"
+		}
+		if _, err := p.dbConnection.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to grant role %s to %s: %v", membership.Role, membership.Member, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *Provider) existingRoles(ctx context.Context, names []string) (map[string]role, error) {
+	query := `
+		SELECT rolname, rolsuper, rolinherit, rolcreaterole, rolcreatedb, rolcanlogin, rolreplication, rolbypassrls
+		FROM pg_roles
+		WHERE rolname = ANY($1)`
+
+	rows, err := p.dbConnection.QueryContext(ctx, query, pq.Array(names))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query roles: %v", err)
+	}
+	defer rows.Close()
+
+	roles := make(map[string]role)
+	for rows.Next() {
+		var r role
+		if err := rows.Scan(&r.Name, &r.Superuser, &r.Inherit, &r.CreateRole, &r.CreateDB, &r.Login, &r.Replication, &r.BypassRLS); err != nil {
+			return nil, fmt.Errorf("failed to scan roles: %v", err)
+		}
+		roles[r.Name] = r
+	}
+	return roles, rows.Err()
+}
@@ -0,0 +1,233 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Database-level properties that CREATE DATABASE ... TEMPLATE doesn't copy.
+// They are captured when a snapshot is taken and reapplied after a restore.
+type databaseSettings struct {
+	Owner string `json:"owner"`
+	// -1 for no limit
+	ConnectionLimit int `json:"connection_limit"`
+	// Privileges granted on the database, nil if the database has the default privileges
+	Grants []databaseGrant `json:"grants,omitempty"`
+	// ALTER DATABASE ... SET and ALTER ROLE ... IN DATABASE ... SET parameters
+	Parameters []databaseParameter `json:"parameters,omitempty"`
+	Comment    string              `json:"comment,omitempty"`
+}
+
+type databaseGrant struct {
+	// Empty for PUBLIC
+	Grantee     string `json:"grantee"`
+	Privilege   string `json:"privilege"`
+	GrantOption bool   `json:"grant_option,omitempty"`
+}
+
+type databaseParameter struct {
+	// Empty for parameters that apply to all roles
+	Role string `json:"role,omitempty"`
+	// As stored in pg_db_role_setting, e.g. `work_mem=64MB`
+	Setting string `json:"setting"`
+}
+
+// Parameters whose values are lists of separately quoted elements, like pg_dump handles them
+var listParameters = map[string]bool{
+	"search_path":               true,
+	"temp_tablespaces":          true,
+	"session_preload_libraries": true,
+	"local_preload_libraries":   true,
+}
+
+func (p *Provider) captureDatabaseSettings(ctx context.Context, databaseName string) (*databaseSettings, error) {
+	settings := &databaseSettings{ConnectionLimit: -1}
+
+	var hasACL bool
+	var comment sql.NullString
+	query := `
+		SELECT pg_get_userbyid(datdba), datconnlimit, datacl IS NOT NULL, shobj_description(oid, 'pg_database')
+		FROM pg_database
+		WHERE datname = $1`
+	if err := p.dbConnection.QueryRowContext(ctx, query, databaseName).Scan(&settings.Owner, &settings.ConnectionLimit, &hasACL, &comment); err != nil {
+		return nil, fmt.Errorf("failed to query the settings of %s: %v", databaseName, err)
+	}
+	settings.Comment = comment.String
+
+	if hasACL {
+		grants, err := p.databaseGrants(ctx, databaseName)
+		if err != nil {
+			return nil, err
+		}
+		settings.Grants = grants
+	}
+
+	parameters, err := p.databaseParameters(ctx, databaseName)
+	if err != nil {
+		return nil, err
+	}
+	settings.Parameters = parameters
+
+	return settings, nil
+}
+
+func (p *Provider) databaseGrants(ctx context.Context, databaseName string) ([]databaseGrant, error) {
+	query := `
+		SELECT CASE WHEN acl.grantee = 0 THEN '' ELSE pg_get_userbyid(acl.grantee) END, acl.privilege_type, acl.is_grantable
+		FROM pg_database d, aclexplode(d.datacl) acl
+		WHERE d.datname = $1`
+
+	rows, err := p.dbConnection.QueryContext(ctx, query, databaseName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the privileges on %s: %v", databaseName, err)
+	}
+	defer rows.Close()
+
+	grants := make([]databaseGrant, 0)
+	for rows.Next() {
+		var grant databaseGrant
+		if err := rows.Scan(&grant.Grantee, &grant.Privilege, &grant.GrantOption); err != nil {
+			return nil, fmt.Errorf("failed to scan the privileges on %s: %v", databaseName, err)
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
+
+func (p *Provider) databaseParameters(ctx context.Context, databaseName string) ([]databaseParameter, error) {
+	query := `
+		SELECT CASE WHEN s.setrole = 0 THEN '' ELSE pg_get_userbyid(s.setrole) END, unnest(s.setconfig)
+		FROM pg_db_role_setting s
+		JOIN pg_database d ON d.oid = s.setdatabase
+		WHERE d.datname = $1
+		ORDER BY 1`
+
+	rows, err := p.dbConnection.QueryContext(ctx, query, databaseName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the parameters of %s: %v", databaseName, err)
+	}
+	defer rows.Close()
+
+	var parameters []databaseParameter
+	for rows.Next() {
+		var parameter databaseParameter
+		if err := rows.Scan(&parameter.Role, &parameter.Setting); err != nil {
+			return nil, fmt.Errorf("failed to scan the parameters of %s: %v", databaseName, err)
+		}
+		parameters = append(parameters, parameter)
+	}
+	return parameters, rows.Err()
+}
+
+// Reapplies the captured settings to the database. All statements are tried, so that
+// one missing role doesn't cost the remaining settings. The database is already restored
+// at this point, so failures are added to the warnings instead of failing the restore.
+func (p *Provider) applyDatabaseSettings(ctx context.Context, databaseName string, settings *databaseSettings) {
+	for _, statement := range settings.statements(databaseName) {
+		if _, err := p.dbConnection.ExecContext(ctx, statement); err != nil {
+			p.warn("failed to reapply a setting of %s: %s: %v", databaseName, statement, err)
+		}
+	}
+}
+
+func (s *databaseSettings) statements(databaseName string) []string {
+	database := pq.QuoteIdentifier(databaseName)
+	var statements []string
+
+	if s.Owner != "" {
+		statements = append(statements, "ALTER DATABASE "+database+" OWNER TO "+pq.QuoteIdentifier(s.Owner))
+	}
+	if s.ConnectionLimit != -1 {
+		statements = append(statements, fmt.Sprintf("ALTER DATABASE %s CONNECTION LIMIT %d", database, s.ConnectionLimit))
+	}
+
+	// The new database has the default privileges, which are replaced by the captured ones
+	if s.Grants != nil {
+		statements = append(statements, "REVOKE ALL ON DATABASE "+database+" FROM PUBLIC")
+		for _, grant := range s.Grants {
+			grantee := "PUBLIC"
+			if grant.Grantee != "" {
+				grantee = pq.QuoteIdentifier(grant.Grantee)
+			}
+			statement := "GRANT " + grant.Privilege + " ON DATABASE " + database + " TO " + grantee
+			if grant.GrantOption {
+				statement += " WITH GRANT OPTION"
+			}
+			statements = append(statements, statement)
+		}
+	}
+
+	for _, parameter := range s.Parameters {
+		name, value, found := strings.Cut(parameter.Setting, "=")
+		if !found {
+			continue
+		}
+		target := "DATABASE " + database
+		if parameter.Role != "" {
+			target = "ROLE " + pq.QuoteIdentifier(parameter.Role) + " IN DATABASE " + database
+		}
+		statements = append(statements, "ALTER "+target+" SET "+parameterName(name)+" TO "+parameterValue(name, value))
+	}
+
+	if s.Comment != "" {
+		statements = append(statements, "COMMENT ON DATABASE "+database+" IS "+pq.QuoteLiteral(s.Comment))
+	}
+	return statements
+}
+
+// Custom parameters are qualified with a prefix, e.g. `app.tenant`
+func parameterName(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = pq.QuoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+func parameterValue(name, value string) string {
+	if !listParameters[strings.ToLower(name)] {
+		return pq.QuoteLiteral(value)
+	}
+
+	var elements []string
+	for _, element := range splitParameterList(value) {
+		elements = append(elements, pq.QuoteLiteral(element))
+	}
+	if len(elements) == 0 {
+		return "''"
+	}
+	return strings.Join(elements, ", ")
+}
+
+// Splits e.g. `"$user", public` into `$user` and `public`
+func splitParameterList(value string) []string {
+	var elements []string
+	var current strings.Builder
+	quoted := false
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '"' && quoted && i+1 < len(value) && value[i+1] == '"':
+			current.WriteByte('"')
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			elements = append(elements, current.String())
+			current.Reset()
+		case (c == ' ' || c == '\t') && !quoted:
+			// Whitespace around unquoted elements is not part of them
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if current.Len() > 0 || len(elements) > 0 {
+		elements = append(elements, current.String())
+	}
+	return elements
+}
@@ -0,0 +1,157 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Checks the quota and the free space before a snapshot of the database is created. The snapshot and
+// its first copy each take up to the size of the database. Replacing a snapshot releases the space of
+// the old one and its copies first.
+func (p *Provider) checkSnapshotSpace(ctx context.Context, replacedSnapshot string) error {
+	limits := p.config.SpaceLimits
+
+	size, err := p.databaseSize(ctx, p.config.DatabaseName)
+	if err != nil {
+		return err
+	}
+
+	if limits.MaxTotalSnapshotSize > 0 {
+		snapshots, err := p.ListSnapshots(ctx)
+		if err != nil {
+			return err
+		}
+		if err := limits.CheckQuota(snapshots, replacedSnapshot, size); err != nil {
+			return err
+		}
+	}
+
+	var released int64
+	if replacedSnapshot != "" {
+		if released, err = p.snapshotDatabasesSize(ctx, replacedSnapshot); err != nil {
+			return err
+		}
+	}
+
+	// Without access to the data directory (e.g. on a remote server or in a container) the free space can't be checked
+	snapshotDirectory, err := p.tablespaceDirectory(ctx, p.config.SnapshotTablespace)
+	if err != nil {
+		return nil
+	}
+	copyTablespace, err := p.snapshotCopyTablespace(ctx)
+	if err != nil {
+		return err
+	}
+	copyDirectory, err := p.tablespaceDirectory(ctx, copyTablespace)
+	if err != nil {
+		return nil
+	}
+
+	if copyDirectory == snapshotDirectory {
+		return limits.CheckFreeSpace(snapshotDirectory, 2*size, released)
+	}
+	if err := limits.CheckFreeSpace(snapshotDirectory, size, released); err != nil {
+		return err
+	}
+	return limits.CheckFreeSpace(copyDirectory, size, 0)
+}
+
+// Checks the free space before a copy of the snapshot is created
+func (p *Provider) checkCopySpace(ctx context.Context, snapshotName string) error {
+	size, err := p.databaseSize(ctx, p.snapshotDatabaseName(snapshotName))
+	if err != nil {
+		return err
+	}
+
+	tablespace, err := p.snapshotCopyTablespace(ctx)
+	if err != nil {
+		return err
+	}
+	directory, err := p.tablespaceDirectory(ctx, tablespace)
+	if err != nil {
+		return nil
+	}
+	return p.config.SpaceLimits.CheckFreeSpace(directory, size, 0)
+}
+
+// Returns the size of the snapshot database and its copies
+func (p *Provider) snapshotDatabasesSize(ctx context.Context, snapshotName string) (int64, error) {
+	copies, err := p.snapshotCopyDatabases(ctx, snapshotName)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, databaseName := range append([]string{p.snapshotDatabaseName(snapshotName)}, copies...) {
+		size, err := p.databaseSize(ctx, databaseName)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// Returns the directory of the tablespace on the server, the data directory for the default tablespaces.
+// The free space is measured on this host, so the directory is only returned if the server runs here.
+func (p *Provider) tablespaceDirectory(ctx context.Context, tablespace string) (string, error) {
+	if err := p.checkServerOnThisHost(ctx); err != nil {
+		return "", err
+	}
+
+	if tablespace != "" {
+		var location string
+		query := "SELECT pg_tablespace_location(oid) FROM pg_tablespace WHERE spcname = $1"
+		if err := p.dbConnection.QueryRowContext(ctx, query, tablespace).Scan(&location); err != nil {
+			return "", fmt.Errorf("failed to query the location of %s: %v", tablespace, err)
+		}
+		if location != "" {
+			return location, nil
+		}
+	}
+
+	var dataDirectory string
+	if err := p.dbConnection.QueryRowContext(ctx, "SELECT current_setting('data_directory')").Scan(&dataDirectory); err != nil {
+		return "", fmt.Errorf("failed to query the data directory: %v", err)
+	}
+	return dataDirectory, nil
+}
+
+// A server reached through a Unix socket or localhost may still run in a container or behind a
+// forwarded port, so the data directory the server sees has to be the one seen on this host.
+func (p *Provider) checkServerOnThisHost(ctx context.Context) error {
+	parsed, err := url.Parse(p.config.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse the database URL: %v", err)
+	}
+	if host := parsed.Hostname(); !isLocalHost(host) {
+		return fmt.Errorf("the server runs on %s, not on this host", host)
+	}
+
+	var dataDirectory string
+	var modification time.Time
+	query := "SELECT current_setting('data_directory'), (pg_stat_file('.')).modification"
+	if err := p.dbConnection.QueryRowContext(ctx, query).Scan(&dataDirectory, &modification); err != nil {
+		return fmt.Errorf("failed to query the data directory: %v", err)
+	}
+
+	info, err := os.Stat(dataDirectory)
+	if err != nil || !info.ModTime().Truncate(time.Second).Equal(modification.Truncate(time.Second)) {
+		return fmt.Errorf("the data directory %s of the server is not on this host", dataDirectory)
+	}
+	return nil
+}
+
+// Unix sockets are given as a directory instead of a host name
+func isLocalHost(host string) bool {
+	if host == "" || host == "localhost" || strings.HasPrefix(host, "/") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
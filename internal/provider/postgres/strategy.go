@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// How CREATE DATABASE copies the template
+const (
+	// FILE_COPY for large databases, WAL_LOG for small ones
+	createStrategyAuto = "auto"
+	// Copies the files of the template and checkpoints before and after
+	createStrategyFileCopy = "file_copy"
+	// Copies block by block through the WAL, the default since PostgreSQL 15
+	createStrategyWALLog = "wal_log"
+)
+
+const (
+	// From this size on, FILE_COPY is faster than WAL_LOG and doesn't generate a lot of WAL
+	fileCopySizeThreshold = 1 << 30
+	// The STRATEGY option of CREATE DATABASE exists since PostgreSQL 15
+	createStrategyMinServerVersion = 150000
+)
+
+func validateCreateStrategy(strategy string) error {
+	switch strategy {
+	case "", createStrategyAuto, createStrategyFileCopy, createStrategyWALLog:
+		return nil
+	default:
+		return fmt.Errorf("unknown create strategy %q for PostgreSQL provider. Must be 'auto', 'file_copy' or 'wal_log'", strategy)
+	}
+}
+
+func (p *Provider) createStrategy() string {
+	if p.config.CreateStrategy == "" {
+		return createStrategyAuto
+	}
+	return p.config.CreateStrategy
+}
+
+// Returns the strategy for copying the source database and whether the server supports choosing it.
+// Older servers always copy the files.
+func (p *Provider) resolveCreateStrategy(ctx context.Context, sourceDB string) (string, bool, error) {
+	var serverVersion int
+	if err := p.dbConnection.QueryRowContext(ctx, "SELECT current_setting('server_version_num')::int").Scan(&serverVersion); err != nil {
+		return "", false, fmt.Errorf("failed to query server version: %v", err)
+	}
+
+	strategy := p.createStrategy()
+	if serverVersion < createStrategyMinServerVersion {
+		if strategy == createStrategyWALLog {
+			return "", false, fmt.Errorf("create strategy `wal_log` requires PostgreSQL 15 or later")
+		}
+		return createStrategyFileCopy, false, nil
+	}
+
+	if strategy != createStrategyAuto {
+		return strategy, true, nil
+	}
+
+	var size int64
+	if err := p.dbConnection.QueryRowContext(ctx, "SELECT pg_database_size($1)", sourceDB).Scan(&size); err != nil {
+		return "", false, fmt.Errorf("failed to query the size of %s: %v", sourceDB, err)
+	}
+	if size >= fileCopySizeThreshold {
+		return createStrategyFileCopy, true, nil
+	}
+	return createStrategyWALLog, true, nil
+}
+
+func createDatabaseStatement(sourceDB, targetDB, strategy string, withStrategy bool, tablespace string) string {
+	statement := "CREATE DATABASE " + pq.QuoteIdentifier(targetDB) + " TEMPLATE " + pq.QuoteIdentifier(sourceDB)
+	if withStrategy {
+		statement += " STRATEGY " + strings.ToUpper(strategy)
+	}
+	if tablespace != "" {
+		statement += " TABLESPACE " + pq.QuoteIdentifier(tablespace)
+	}
+	return statement
+}
+
+// Copies of a snapshot become the database on restore, so they belong in the tablespace of the
+// database rather than in the snapshot tablespace. Without a snapshot tablespace they simply
+// inherit the tablespace of the snapshot.
+func (p *Provider) snapshotCopyTablespace(ctx context.Context) (string, error) {
+	if p.config.SnapshotTablespace == "" {
+		return "", nil
+	}
+	return p.databaseTablespace(ctx, p.config.DatabaseName)
+}
+
+// Returns an empty tablespace if the database doesn't exist
+func (p *Provider) databaseTablespace(ctx context.Context, databaseName string) (string, error) {
+	query := `
+		SELECT t.spcname
+		FROM pg_database d
+		JOIN pg_tablespace t ON t.oid = d.dattablespace
+		WHERE d.datname = $1`
+
+	var tablespace string
+	err := p.dbConnection.QueryRowContext(ctx, query, databaseName).Scan(&tablespace)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query the tablespace of %s: %v", databaseName, err)
+	}
+	return tablespace, nil
+}
@@ -0,0 +1,214 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+func (p *Provider) VerifySnapshot(ctx context.Context, snapshotName string) ([]string, error) {
+	if err := p.CheckIfSnapshotExists(ctx, snapshotName); err != nil {
+		return nil, err
+	}
+
+	// No copy may be created while Lunar is connected to the snapshot
+	if err := p.markSnapshotStart(ctx, snapshotName); err != nil {
+		return nil, fmt.Errorf("failed to mark snapshot start: %v", err)
+	}
+	defer p.markSnapshotFinish(ctx, snapshotName)
+
+	snapshotDBName := p.snapshotDatabaseName(snapshotName)
+
+	// The statistics of a database start empty when it is created, and Lunar never writes to a snapshot
+	query := `
+		SELECT d.datistemplate, d.datallowconn, COALESCE(s.tup_inserted + s.tup_updated + s.tup_deleted, 0)
+		FROM pg_database d
+		LEFT JOIN pg_stat_database s ON s.datid = d.oid
+		WHERE d.datname = $1`
+
+	var isTemplate, allowsConnections bool
+	var writes int64
+	if err := p.dbConnection.QueryRowContext(ctx, query, snapshotDBName).Scan(&isTemplate, &allowsConnections, &writes); err != nil {
+		return nil, fmt.Errorf("failed to verify snapshot: %v", err)
+	}
+
+	var problems []string
+	if !isTemplate || allowsConnections {
+		problems = append(problems, "the snapshot database accepts connections, so it may have been modified (snapshots created by earlier versions of Lunar aren't protected)")
+	}
+	if writes > 0 {
+		problems = append(problems, fmt.Sprintf("%d rows were inserted, updated or deleted since the snapshot was created", writes))
+	}
+
+	allMetadata, err := p.allSnapshotMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	checksum := allMetadata[snapshotDBName].Checksum
+
+	err = p.withSnapshotConnection(ctx, snapshotDBName, func(db *sql.DB) error {
+		if checksum != "" {
+			fingerprint, err := databaseFingerprint(ctx, db)
+			if err != nil {
+				return err
+			}
+			if fingerprint != checksum {
+				problems = append(problems, "the schema or rows of the snapshot don't match the checksum recorded when the snapshot was created")
+			}
+		}
+
+		indexProblems, err := checkIndexes(ctx, db)
+		if err != nil {
+			return err
+		}
+		problems = append(problems, indexProblems...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify snapshot: %v", err)
+	}
+
+	return problems, nil
+}
+
+// Connects to the snapshot database, allowing connections to a protected snapshot only for as long as the action runs
+func (p *Provider) withSnapshotConnection(ctx context.Context, databaseName string, action func(db *sql.DB) error) error {
+	var allowsConnections bool
+	if err := p.dbConnection.QueryRowContext(ctx, "SELECT datallowconn FROM pg_database WHERE datname = $1", databaseName).Scan(&allowsConnections); err != nil {
+		return fmt.Errorf("failed to check connections to %s: %v", databaseName, err)
+	}
+
+	if !allowsConnections {
+		if _, err := p.dbConnection.ExecContext(ctx, "ALTER DATABASE "+pq.QuoteIdentifier(databaseName)+" ALLOW_CONNECTIONS true"); err != nil {
+			return fmt.Errorf("failed to allow connections to %s: %v", databaseName, err)
+		}
+		defer func() {
+			ctx, cancel := cleanupContext(ctx)
+			defer cancel()
+			_, _ = p.dbConnection.ExecContext(ctx, "ALTER DATABASE "+pq.QuoteIdentifier(databaseName)+" ALLOW_CONNECTIONS false")
+		}()
+	}
+
+	db, err := openDatabaseConnection(p.config.DatabaseURL + databaseName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	return action(db)
+}
+
+// Returns a fingerprint of the schema and the rows of every table. Rows are summed up
+// rather than ordered, so the fingerprint doesn't depend on their physical order.
+func databaseFingerprint(ctx context.Context, db *sql.DB) (string, error) {
+	hash := sha256.New()
+
+	var schema sql.NullString
+	schemaQuery := `
+		SELECT string_agg(format('%s.%s.%s:%s', table_schema, table_name, column_name, data_type), ',' ORDER BY table_schema, table_name, ordinal_position)
+		FROM information_schema.columns
+		WHERE table_schema NOT IN ('pg_catalog', 'information_schema')`
+	if err := db.QueryRowContext(ctx, schemaQuery).Scan(&schema); err != nil {
+		return "", fmt.Errorf("failed to fingerprint schema: %v", err)
+	}
+	fmt.Fprintf(hash, "%s\n", schema.String)
+
+	tablesQuery := `
+		SELECT n.nspname, c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'r'
+		AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		AND n.nspname NOT LIKE 'pg\_toast%'
+		ORDER BY n.nspname, c.relname`
+
+	rows, err := db.QueryContext(ctx, tablesQuery)
+	if err != nil {
+		return "", fmt.Errorf("failed to list tables: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var schemaName, tableName string
+		if err := rows.Scan(&schemaName, &tableName); err != nil {
+			rows.Close()
+			return "", fmt.Errorf("failed to list tables: %v", err)
+		}
+		tables = append(tables, pq.QuoteIdentifier(schemaName)+"."+pq.QuoteIdentifier(tableName))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	for _, table := range tables {
+		var count int64
+		var sum string
+		query := "SELECT count(*), COALESCE(sum(hashtext(t::text)::bigint), 0)::text FROM " + table + " t"
+		if err := db.QueryRowContext(ctx, query).Scan(&count, &sum); err != nil {
+			return "", fmt.Errorf("failed to fingerprint %s: %v", table, err)
+		}
+		fmt.Fprintf(hash, "%s:%d:%s\n", table, count, sum)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Checks the B-tree indexes with amcheck if the extension is installed in the database
+func checkIndexes(ctx context.Context, db *sql.DB) ([]string, error) {
+	var installed bool
+	if err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM pg_extension WHERE extname = 'amcheck')").Scan(&installed); err != nil {
+		return nil, fmt.Errorf("failed to check for amcheck: %v", err)
+	}
+	if !installed {
+		return nil, nil
+	}
+
+	query := `
+		SELECT c.oid, format('%I.%I', n.nspname, c.relname)
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_am a ON a.oid = c.relam
+		WHERE a.amname = 'btree'
+		AND c.relpersistence <> 't'
+		AND i.indisready AND i.indisvalid
+		ORDER BY 2`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %v", err)
+	}
+	type index struct {
+		oid  int64
+		name string
+	}
+	var indexes []index
+	for rows.Next() {
+		var i index
+		if err := rows.Scan(&i.oid, &i.name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to list indexes: %v", err)
+		}
+		indexes = append(indexes, i)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for _, i := range indexes {
+		if _, err := db.ExecContext(ctx, "SELECT bt_index_check($1::oid::regclass)", i.oid); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			problems = append(problems, fmt.Sprintf("index %s is damaged: %v", i.name, err))
+		}
+	}
+	return problems, nil
+}
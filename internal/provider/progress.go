@@ -0,0 +1,25 @@
+package provider
+
+import "context"
+
+type progressKey struct{}
+
+// Returns a context whose operations report the bytes they copied to `report`,
+// e.g. to render a progress bar. `report` is called with the bytes copied since the last call.
+func WithProgress(ctx context.Context, report func(bytes int64)) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+// Adds bytes to the progress of the running operation, if anyone listens.
+// Negative bytes take back the progress of an attempt that is started over.
+func ReportProgress(ctx context.Context, bytes int64) {
+	if report, ok := ctx.Value(progressKey{}).(func(int64)); ok && bytes != 0 {
+		report(bytes)
+	}
+}
+
+// Whether the running operation reports its progress, to skip the work of measuring it otherwise
+func HasProgress(ctx context.Context) bool {
+	_, ok := ctx.Value(progressKey{}).(func(int64))
+	return ok
+}
@@ -1,32 +1,83 @@
 package provider
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type SnapshotInfo struct {
 	Name string
-	Age  time.Duration
+	// Database the snapshot was taken of, only set by ListAllSnapshots
+	Database string
+	Age      time.Duration
+	// Size of the snapshot in bytes as seen by the database
+	Size int64
+	// Size the snapshot occupies on disk (differs from Size for compressed snapshots)
+	DiskSize int64
+	// Number of pre-warmed copies that are ready to be restored
+	ReadyCopies int
+	// Whether the snapshot refuses connections, see `lunar protect`. Only PostgreSQL protects snapshots.
+	Protected bool
+	// Optional description of the snapshot, see `lunar describe`
+	Description string
+}
+
+// Detail is a labeled piece of information shown by `lunar info`
+type Detail struct {
+	Label string
+	Value string
 }
 
+// Provider implements the snapshot operations for a database system.
+// Cancelling the context aborts a running operation and cleans up what it created so far.
 type Provider interface {
 	// Snapshot operations
-	CheckIfSnapshotCanBeTaken(snapshotName string) error
-	CheckIfSnapshotExists(snapshotName string) error
-	CreateSnapshot(snapshotName string) error
-	CreateSnapshotCopy(snapshotName string) error
-	RestoreSnapshot(snapshotName string) error
-	RemoveSnapshot(snapshotName string) error
-	ReplaceSnapshot(snapshotName string) error
-	ListSnapshots() ([]SnapshotInfo, error)
+	CheckIfSnapshotCanBeTaken(ctx context.Context, snapshotName string) error
+	CheckIfSnapshotExists(ctx context.Context, snapshotName string) error
+	CreateSnapshot(ctx context.Context, snapshotName string) error
+	CreateSnapshotCopy(ctx context.Context, snapshotName string) error
+	// Makes sure a copy for restoring is ready, building one synchronously if needed
+	EnsureSnapshotCopy(ctx context.Context, snapshotName string) error
+	RestoreSnapshot(ctx context.Context, snapshotName string) error
+	RemoveSnapshot(ctx context.Context, snapshotName string) error
+	ReplaceSnapshot(ctx context.Context, snapshotName string) error
+	// Renames the snapshot together with its copies
+	RenameSnapshot(ctx context.Context, snapshotName, newName string) error
+	ListSnapshots(ctx context.Context) ([]SnapshotInfo, error)
+	// Lists the snapshots of every database on the server, not only of the configured one
+	ListAllSnapshots(ctx context.Context) ([]SnapshotInfo, error)
+	ReadySnapshotCopies(ctx context.Context, snapshotName string) (int, error)
+	// Returns the problems found with the snapshot, e.g. modifications since it was created
+	VerifySnapshot(ctx context.Context, snapshotName string) ([]string, error)
+	// Protects the snapshot against connections and modifications, or lifts the protection
+	SetSnapshotProtection(ctx context.Context, snapshotName string, protected bool) error
+	// Stores a description of the snapshot, an empty description removes it
+	SetSnapshotDescription(ctx context.Context, snapshotName, description string) error
+	// Lists the snapshots taken by earlier versions of Lunar that MigrateLegacySnapshots would move
+	LegacySnapshots(ctx context.Context) ([]string, error)
+	// Moves snapshots taken by earlier versions of Lunar to where this version looks for them
+	MigrateLegacySnapshots(ctx context.Context) ([]string, error)
 
 	// Locking/synchronization operations
-	IsSnapshotInProgress(snapshotName string) bool
-	IsOperationInProgress() bool
-	WaitForOngoingSnapshot(snapshotName string) error
-	WaitForOngoingOperations() error
+	IsSnapshotInProgress(ctx context.Context, snapshotName string) bool
+	IsOperationInProgress(ctx context.Context) bool
+	WaitForOngoingSnapshot(ctx context.Context, snapshotName string) error
+	WaitForOngoingOperations(ctx context.Context) error
+	// Returns the processes currently holding locks of the database
+	LockHolders(ctx context.Context) ([]LockHolder, error)
+	// Releases a lock whose holder died without releasing it
+	BreakLock(ctx context.Context, holder LockHolder) error
+
+	// Returns and clears the warnings of the last operation, e.g. differences found while restoring
+	TakeWarnings() []string
 
 	// Info operations
 	GetDatabaseIdentifier() string
-	GetDatabaseSize() (int64, error)
+	GetDatabaseSize(ctx context.Context) (int64, error)
+	// Returns a cheap fingerprint of the database that changes when it is modified
+	DatabaseFingerprint(ctx context.Context) (string, error)
+	GetDetails(ctx context.Context) ([]Detail, error)
+	GetSnapshotDetails(ctx context.Context, snapshotName string) ([]Detail, error)
 
 	// Close releases any resources held by the provider
 	Close() error
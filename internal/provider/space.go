@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/leonvogt/lunar/internal/disk"
+)
+
+// Keeps snapshots from filling up the disk. A full disk makes snapshots fail halfway
+// and can leave PostgreSQL unable to write WAL.
+type SpaceLimits struct {
+	// Space that has to remain free after a snapshot or copy was written
+	MinFreeDiskSpace int64
+	// Upper limit for the size of all snapshots together, 0 for no limit
+	MaxTotalSnapshotSize int64
+}
+
+// Returns an error if writing `required` bytes to the directory would leave less than the minimum free space.
+// `released` is the space freed before writing, e.g. by the snapshot being replaced. Directories that
+// can't be checked, like the data directory of a remote PostgreSQL server, are skipped.
+func (l SpaceLimits) CheckFreeSpace(directory string, required, released int64) error {
+	free, err := disk.FreeSpace(directory)
+	if err != nil {
+		return nil
+	}
+
+	available := int64(free) + released - l.MinFreeDiskSpace
+	if required <= available {
+		return nil
+	}
+	return fmt.Errorf("not enough disk space in %s: %s free, but %s are needed and %s have to remain free (min_free_disk_space). Remove snapshots you no longer need or free up disk space",
+		directory, disk.FormatBytes(int64(free)), disk.FormatBytes(required), disk.FormatBytes(l.MinFreeDiskSpace))
+}
+
+// Returns an error if adding a snapshot of the given size exceeds max_total_snapshot_size.
+// The replaced snapshot, if any, doesn't count.
+func (l SpaceLimits) CheckQuota(snapshots []SnapshotInfo, replacedSnapshot string, size int64) error {
+	if l.MaxTotalSnapshotSize <= 0 {
+		return nil
+	}
+
+	total := size
+	for _, snapshot := range snapshots {
+		if snapshot.Name != replacedSnapshot {
+			total += snapshot.DiskSize
+		}
+	}
+	if total <= l.MaxTotalSnapshotSize {
+		return nil
+	}
+	return fmt.Errorf("snapshots would take %s, more than max_total_snapshot_size of %s. Remove snapshots you no longer need or raise the limit",
+		disk.FormatBytes(total), disk.FormatBytes(l.MaxTotalSnapshotSize))
+}
+
+// Checks that the filesystem of the directory has room for a snapshot and its pre-warmed copies,
+// each of which takes up to the size of the database, besides the minimum free space
+func (l SpaceLimits) DiskSpaceCheck(directory string, databaseSize int64, warmCopies int) Check {
+	check := Check{Name: "Disk space", Status: CheckPassed}
+
+	free, err := disk.FreeSpace(directory)
+	if err != nil {
+		check.Status = CheckWarning
+		check.Message = fmt.Sprintf("can't be checked: %v", err)
+		return check
+	}
+
+	required := databaseSize*int64(1+warmCopies) + l.MinFreeDiskSpace
+	check.Message = fmt.Sprintf("%s free in %s, a snapshot and its fast restore copies need up to %s (including min_free_disk_space)", disk.FormatBytes(int64(free)), directory, disk.FormatBytes(required))
+	if int64(free) < required {
+		check.Status = CheckWarning
+		check.Fix = "Free up disk space, remove snapshots you no longer need or lower warm_copies"
+	}
+	return check
+}
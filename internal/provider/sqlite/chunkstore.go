@@ -0,0 +1,401 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	storageFile  = "file"
+	storageDedup = "dedup"
+
+	chunkDirectoryName    = ".lunar_chunks"
+	manifestFileExtension = ".manifest"
+
+	// Chunks span this many database pages, so a changed page only invalidates a single chunk
+	pagesPerChunk   = 16
+	defaultPageSize = 4096
+)
+
+func validateStorage(storage string) error {
+	switch storage {
+	case "", storageFile, storageDedup:
+		return nil
+	default:
+		return fmt.Errorf("unknown snapshot storage %q for SQLite provider. Must be 'file' or 'dedup'", storage)
+	}
+}
+
+// chunkManifest lists the chunks a deduplicated snapshot is made of.
+type chunkManifest struct {
+	ChunkSize int           `json:"chunk_size"`
+	Files     []chunkedFile `json:"files"`
+}
+
+type chunkedFile struct {
+	// Suffix of the file relative to the database path ("" for the database itself, "-wal", "-shm")
+	Suffix string   `json:"suffix"`
+	Size   int64    `json:"size"`
+	Chunks []string `json:"chunks"`
+}
+
+// chunkStore is a content-addressed store: every chunk is saved once under the SHA-256 of its content.
+type chunkStore struct {
+	directory string
+	compress  bool
+	encoder   *zstd.Encoder
+	decoder   *zstd.Decoder
+}
+
+func (p *Provider) chunkStore() *chunkStore {
+	return &chunkStore{
+		directory: filepath.Join(p.config.SnapshotDirectory, chunkDirectoryName),
+		compress:  p.config.Compression == compressionZstd,
+	}
+}
+
+func (s *chunkStore) close() {
+	if s.encoder != nil {
+		s.encoder.Close()
+	}
+	if s.decoder != nil {
+		s.decoder.Close()
+	}
+}
+
+func (s *chunkStore) chunkPath(hash string) string {
+	return filepath.Join(s.directory, hash[:2], hash)
+}
+
+// Stores the chunk unless the store already has it and returns its hash
+// together with the number of bytes newly written to disk.
+func (s *chunkStore) put(chunk []byte) (string, int64, error) {
+	sum := sha256.Sum256(chunk)
+	hash := hex.EncodeToString(sum[:])
+	path := s.chunkPath(hash)
+
+	// A chunk may have been stored compressed or uncompressed by an earlier snapshot
+	for _, candidate := range []string{path, path + compressedFileExtension} {
+		if _, err := os.Stat(candidate); err == nil {
+			return hash, 0, nil
+		}
+	}
+
+	data := chunk
+	if s.compress {
+		if s.encoder == nil {
+			encoder, err := zstd.NewWriter(nil)
+			if err != nil {
+				return "", 0, err
+			}
+			s.encoder = encoder
+		}
+		data = s.encoder.EncodeAll(chunk, nil)
+		path += compressedFileExtension
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, err
+	}
+
+	// Write to a temporary file first so that an interrupted snapshot never leaves a truncated chunk behind
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return "", 0, err
+	}
+
+	return hash, int64(len(data)), nil
+}
+
+func (s *chunkStore) get(hash string) ([]byte, error) {
+	path := s.chunkPath(hash)
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return data, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	data, err = os.ReadFile(path + compressedFileExtension)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("chunk %s is missing from the chunk store", hash)
+		}
+		return nil, err
+	}
+
+	if s.decoder == nil {
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		s.decoder = decoder
+	}
+	return s.decoder.DecodeAll(data, nil)
+}
+
+// Splits the file into chunks and stores them. Returns the file entry for the manifest
+// and the number of bytes newly written to the store.
+func (s *chunkStore) storeFile(ctx context.Context, path string, chunkSize int) (chunkedFile, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return chunkedFile{}, 0, err
+	}
+	defer file.Close()
+
+	entry := chunkedFile{Chunks: make([]string, 0)}
+	buffer := make([]byte, chunkSize)
+	var storedSize int64
+
+	reader := contextReader(ctx, file)
+	for {
+		n, err := io.ReadFull(reader, buffer)
+		if n > 0 {
+			hash, written, putErr := s.put(buffer[:n])
+			if putErr != nil {
+				return chunkedFile{}, 0, putErr
+			}
+			entry.Chunks = append(entry.Chunks, hash)
+			entry.Size += int64(n)
+			storedSize += written
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return entry, storedSize, nil
+		}
+		if err != nil {
+			return chunkedFile{}, 0, err
+		}
+	}
+}
+
+// Reassembles a file from its chunks. Zeroed chunks become holes in the destination.
+func (s *chunkStore) restoreFile(ctx context.Context, entry chunkedFile, dst string) error {
+	destFile, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	for _, hash := range entry.Chunks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		chunk, err := s.get(hash)
+		if err != nil {
+			return err
+		}
+
+		if _, err := sparseCopy(destFile, bytes.NewReader(chunk)); err != nil {
+			return err
+		}
+	}
+
+	if err := destFile.Truncate(entry.Size); err != nil {
+		return err
+	}
+
+	return destFile.Sync()
+}
+
+// Removes all chunks that are not referenced by the given set of hashes.
+func (s *chunkStore) collectGarbage(referenced map[string]bool) error {
+	err := filepath.WalkDir(s.directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		hash := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), ".tmp"), compressedFileExtension)
+		if !referenced[hash] || strings.HasSuffix(entry.Name(), ".tmp") {
+			return os.Remove(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Remove the fan-out directories that became empty
+	entries, err := os.ReadDir(s.directory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			os.Remove(filepath.Join(s.directory, entry.Name()))
+		}
+	}
+
+	return nil
+}
+
+// Stores the database (and its WAL files) as chunks and writes the manifest.
+// Returns the size of the database and the number of bytes the snapshot added to the chunk store.
+func (p *Provider) storeDeduplicatedSnapshot(ctx context.Context, snapshotName string) (int64, int64, error) {
+	store := p.chunkStore()
+	defer store.close()
+
+	manifest := chunkManifest{ChunkSize: sqlitePageSize(p.config.DatabasePath) * pagesPerChunk}
+	var storedSize int64
+
+	for _, suffix := range append([]string{""}, walFileSuffixes...) {
+		path := p.config.DatabasePath + suffix
+		if _, err := os.Stat(path); err != nil {
+			// Only the database file itself is required, the WAL files exist in WAL mode only
+			if suffix != "" && os.IsNotExist(err) {
+				continue
+			}
+			return 0, 0, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+
+		entry, written, err := store.storeFile(ctx, path, manifest.ChunkSize)
+		if err != nil {
+			return 0, 0, err
+		}
+		entry.Suffix = suffix
+		manifest.Files = append(manifest.Files, entry)
+		storedSize += written
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to encode snapshot manifest: %v", err)
+	}
+	if err := os.WriteFile(p.snapshotManifestPath(snapshotName), data, 0644); err != nil {
+		return 0, 0, fmt.Errorf("failed to write snapshot manifest: %v", err)
+	}
+
+	return manifest.Files[0].Size, storedSize, nil
+}
+
+// Reassembles a deduplicated snapshot (and its WAL files) to dst.
+func (p *Provider) restoreDeduplicatedSnapshot(ctx context.Context, snapshotName, dst string) error {
+	// Reassembling runs without the operation lock, e.g. for copies, so keep the chunks from being collected meanwhile
+	if p.chunkLock != nil {
+		if err := p.chunkLock.lockShared(ctx); err != nil {
+			return fmt.Errorf("failed to acquire chunk store lock: %v", err)
+		}
+		defer p.chunkLock.unlock()
+	}
+
+	manifest, err := readChunkManifest(p.snapshotManifestPath(snapshotName))
+	if err != nil {
+		return err
+	}
+
+	store := p.chunkStore()
+	defer store.close()
+
+	for _, entry := range manifest.Files {
+		if err := store.restoreFile(ctx, entry, dst+entry.Suffix); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Removes chunks that are no longer referenced by any manifest in the snapshot directory.
+// The directory may be shared by multiple databases, so all manifests are taken into account.
+// Waits for snapshots that are being reassembled. Callers must hold the lock.
+func (p *Provider) collectUnreferencedChunks(ctx context.Context) error {
+	if p.chunkLock != nil {
+		if err := p.chunkLock.lock(ctx); err != nil {
+			return fmt.Errorf("failed to acquire chunk store lock: %v", err)
+		}
+		defer p.chunkLock.unlock()
+	}
+
+	manifestPaths, err := filepath.Glob(filepath.Join(p.config.SnapshotDirectory, "*"+manifestFileExtension))
+	if err != nil {
+		return err
+	}
+
+	referenced := make(map[string]bool)
+	for _, manifestPath := range manifestPaths {
+		manifest, err := readChunkManifest(manifestPath)
+		if err != nil {
+			// Never delete chunks based on an incomplete picture
+			return err
+		}
+		for _, entry := range manifest.Files {
+			for _, hash := range entry.Chunks {
+				referenced[hash] = true
+			}
+		}
+	}
+
+	if err := p.chunkStore().collectGarbage(referenced); err != nil {
+		return fmt.Errorf("failed to remove unreferenced chunks: %v", err)
+	}
+	return nil
+}
+
+func readChunkManifest(path string) (*chunkManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot manifest: %v", err)
+	}
+
+	manifest := &chunkManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot manifest %s: %v", filepath.Base(path), err)
+	}
+	return manifest, nil
+}
+
+// Reads the page size from the SQLite database header.
+// Falls back to the SQLite default if the file does not look like a database.
+func sqlitePageSize(path string) int {
+	file, err := os.Open(path)
+	if err != nil {
+		return defaultPageSize
+	}
+	defer file.Close()
+
+	header := make([]byte, 100)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return defaultPageSize
+	}
+	if string(header[:16]) != "SQLite format 3\x00" {
+		return defaultPageSize
+	}
+
+	// The page size is stored big-endian at offset 16. The value 1 means 65536.
+	pageSize := int(binary.BigEndian.Uint16(header[16:18]))
+	if pageSize == 1 {
+		return 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return defaultPageSize
+	}
+	return pageSize
+}
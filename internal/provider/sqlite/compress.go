@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	compressionNone = "none"
+	compressionZstd = "zstd"
+
+	compressedFileExtension = ".zst"
+)
+
+func validateCompression(compression string) error {
+	switch compression {
+	case "", compressionNone, compressionZstd:
+		return nil
+	default:
+		return fmt.Errorf("unknown compression %q for SQLite provider. Must be 'none' or 'zstd'", compression)
+	}
+}
+
+// Streams src into a zstd compressed dst and returns the uncompressed size.
+func compressFile(ctx context.Context, src, dst string) (int64, error) {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer sourceFile.Close()
+
+	destFile, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer destFile.Close()
+
+	encoder, err := zstd.NewWriter(destFile)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := io.Copy(encoder, contextReader(ctx, sourceFile))
+	if err != nil {
+		encoder.Close()
+		return 0, err
+	}
+
+	if err := encoder.Close(); err != nil {
+		return 0, err
+	}
+
+	return size, destFile.Sync()
+}
+
+// Streams the zstd compressed src into an uncompressed dst.
+func decompressFile(ctx context.Context, src, dst string) error {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	decoder, err := zstd.NewReader(sourceFile)
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	destFile, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	size, err := sparseCopy(destFile, contextReader(ctx, decoder))
+	if err != nil {
+		return err
+	}
+
+	if err := destFile.Truncate(size); err != nil {
+		return err
+	}
+
+	return destFile.Sync()
+}
@@ -0,0 +1,170 @@
+package sqlite
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/leonvogt/lunar/internal/provider"
+)
+
+// copyStrategy describes how the bytes of a file ended up in its destination.
+type copyStrategy string
+
+const (
+	copyStrategyReflink       copyStrategy = "reflink"
+	copyStrategyCopyFileRange copyStrategy = "copy_file_range"
+	copyStrategySparse        copyStrategy = "sparse copy"
+	copyStrategyZstd          copyStrategy = "zstd"
+	copyStrategyChunked       copyStrategy = "chunked"
+)
+
+func (s copyStrategy) Description() string {
+	switch s {
+	case copyStrategyReflink:
+		return "reflink (copy-on-write clone)"
+	case copyStrategyCopyFileRange:
+		return "copy_file_range (in-kernel copy)"
+	case copyStrategySparse:
+		return "sparse-aware copy"
+	case copyStrategyZstd:
+		return "zstd compression"
+	case copyStrategyChunked:
+		return "deduplicated chunks"
+	default:
+		return string(s)
+	}
+}
+
+const sparseCopyBlockSize = 64 * 1024
+
+// Copies src to dst using the cheapest strategy the filesystem supports.
+// Copy-on-write filesystems (btrfs, XFS, bcachefs) get a reflink, which is near-instant
+// regardless of the file size. Everything else falls back to a copy that skips zeroed blocks.
+func copyFile(ctx context.Context, src, dst string) (copyStrategy, error) {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer sourceFile.Close()
+
+	// Get source file info for permissions
+	sourceInfo, err := sourceFile.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	destFile, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, sourceInfo.Mode())
+	if err != nil {
+		return "", err
+	}
+	defer destFile.Close()
+
+	strategy, err := copyFileContents(ctx, destFile, sourceFile, sourceInfo.Size())
+	if err != nil {
+		return "", err
+	}
+
+	return strategy, destFile.Sync()
+}
+
+func copyFileContents(ctx context.Context, dst, src *os.File, size int64) (copyStrategy, error) {
+	if err := reflinkFile(dst, src); err == nil {
+		provider.ReportProgress(ctx, size)
+		return copyStrategyReflink, nil
+	}
+
+	copied, err := copyFileRange(ctx, dst, src, size)
+	if err == nil {
+		return copyStrategyCopyFileRange, nil
+	} else if ctx.Err() != nil {
+		return "", err
+	}
+
+	// A failed copy_file_range may have written part of the file already. The sparse copy
+	// starts over and reports these bytes again.
+	if err := resetFile(dst, src); err != nil {
+		return "", err
+	}
+	provider.ReportProgress(ctx, -copied)
+
+	if _, err := sparseCopy(dst, contextReader(ctx, src)); err != nil {
+		return "", err
+	}
+
+	// Trailing holes are only materialized by setting the final size
+	if err := dst.Truncate(size); err != nil {
+		return "", err
+	}
+	return copyStrategySparse, nil
+}
+
+func resetFile(dst, src *os.File) error {
+	if err := dst.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := dst.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := src.Seek(0, io.SeekStart)
+	return err
+}
+
+// Copies src to dst block by block, seeking over blocks that only contain zeros
+// so that holes in the source stay holes in the destination.
+// Returns the number of bytes copied. Callers must truncate dst to that size afterwards.
+func sparseCopy(dst *os.File, src io.Reader) (int64, error) {
+	buffer := make([]byte, sparseCopyBlockSize)
+	var copied int64
+
+	for {
+		n, err := io.ReadFull(src, buffer)
+		if n > 0 {
+			if isZeroBlock(buffer[:n]) {
+				if _, err := dst.Seek(int64(n), io.SeekCurrent); err != nil {
+					return copied, err
+				}
+			} else if _, err := dst.Write(buffer[:n]); err != nil {
+				return copied, err
+			}
+			copied += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return copied, nil
+		}
+		if err != nil {
+			return copied, err
+		}
+	}
+}
+
+type cancellableReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+// Wraps the reader so that reading fails once the context is cancelled,
+// which stops long running copies between two blocks. The bytes read are
+// reported as the progress of the operation.
+func contextReader(ctx context.Context, reader io.Reader) io.Reader {
+	return &cancellableReader{ctx: ctx, reader: reader}
+}
+
+func (r *cancellableReader) Read(buffer []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.reader.Read(buffer)
+	provider.ReportProgress(r.ctx, int64(n))
+	return n, err
+}
+
+func isZeroBlock(block []byte) bool {
+	for _, b := range block {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
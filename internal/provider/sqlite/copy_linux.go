@@ -0,0 +1,44 @@
+//go:build linux
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/leonvogt/lunar/internal/provider"
+	"golang.org/x/sys/unix"
+)
+
+const copyFileRangeChunkSize = 64 * 1024 * 1024
+
+// Clones src into dst with the FICLONE ioctl. Only works on copy-on-write filesystems
+// and when both files live on the same filesystem.
+func reflinkFile(dst, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
+
+// Lets the kernel copy the data without passing it through user space.
+// Some filesystems (e.g. XFS, btrfs) turn this into a reflink as well.
+// The data is copied in chunks, so that the copy can be cancelled in between.
+// Returns the number of bytes copied (and reported as progress), also when it fails halfway.
+func copyFileRange(ctx context.Context, dst, src *os.File, size int64) (int64, error) {
+	var copied int64
+	for copied < size {
+		if err := ctx.Err(); err != nil {
+			return copied, err
+		}
+
+		n, err := unix.CopyFileRange(int(src.Fd()), nil, int(dst.Fd()), nil, int(min(size-copied, copyFileRangeChunkSize)), 0)
+		if err != nil {
+			return copied, err
+		}
+		if n == 0 {
+			return copied, fmt.Errorf("copy_file_range stopped with %d bytes remaining", size-copied)
+		}
+		copied += int64(n)
+		provider.ReportProgress(ctx, int64(n))
+	}
+	return copied, nil
+}
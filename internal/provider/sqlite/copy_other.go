@@ -0,0 +1,19 @@
+//go:build !linux
+
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+var errCopyStrategyUnsupported = errors.New("not supported on this platform")
+
+func reflinkFile(dst, src *os.File) error {
+	return errCopyStrategyUnsupported
+}
+
+func copyFileRange(ctx context.Context, dst, src *os.File, size int64) (int64, error) {
+	return 0, errCopyStrategyUnsupported
+}
@@ -0,0 +1,82 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/leonvogt/lunar/internal/disk"
+	"github.com/leonvogt/lunar/internal/provider"
+)
+
+// Runs the checks of `lunar doctor`. Unlike New, it reports all problems instead of stopping at the first one.
+func Diagnose(ctx context.Context, config *Config) []provider.Check {
+	checks := []provider.Check{checkConfig(config)}
+	if config.DatabasePath == "" {
+		return checks
+	}
+
+	databaseCheck := provider.Check{Name: "Database file", Status: provider.CheckPassed, Message: config.DatabasePath}
+	var databaseSize int64
+	if info, err := os.Stat(config.DatabasePath); err != nil {
+		databaseCheck.Status = provider.CheckFailed
+		databaseCheck.Message = err.Error()
+		databaseCheck.Fix = "Check database_path in lunar.yml"
+	} else if file, err := os.Open(config.DatabasePath); err != nil {
+		databaseCheck.Status = provider.CheckFailed
+		databaseCheck.Message = err.Error()
+		databaseCheck.Fix = "Make the database file readable for the current user"
+	} else {
+		file.Close()
+		databaseSize = info.Size()
+	}
+	checks = append(checks, databaseCheck)
+
+	snapshotDirectory := config.SnapshotDirectory
+	if snapshotDirectory == "" {
+		snapshotDirectory = filepath.Join(filepath.Dir(config.DatabasePath), ".lunar_snapshots")
+	}
+
+	directoryCheck := provider.Check{Name: "Snapshot directory", Status: provider.CheckPassed, Message: snapshotDirectory + " is writable"}
+	err := os.MkdirAll(snapshotDirectory, 0755)
+	if err == nil {
+		err = disk.CheckWritable(snapshotDirectory)
+	}
+	if err != nil {
+		directoryCheck.Status = provider.CheckFailed
+		directoryCheck.Message = err.Error()
+		directoryCheck.Fix = fmt.Sprintf("Make %s writable for the current user or set snapshot_directory in lunar.yml", snapshotDirectory)
+		return append(checks, directoryCheck)
+	}
+	checks = append(checks, directoryCheck)
+
+	lockingCheck := provider.Check{Name: "File locking", Status: provider.CheckPassed, Message: "supported"}
+	if err := disk.CheckLocking(snapshotDirectory); err != nil {
+		lockingCheck.Status = provider.CheckFailed
+		lockingCheck.Message = err.Error()
+		lockingCheck.Fix = "Move snapshot_directory to a local filesystem, some network filesystems don't support file locks"
+	}
+	checks = append(checks, lockingCheck)
+
+	return append(checks, config.SpaceLimits.DiskSpaceCheck(snapshotDirectory, databaseSize, (&Provider{config: config}).warmCopies()))
+}
+
+func checkConfig(config *Config) provider.Check {
+	var problems []string
+	if config.DatabasePath == "" {
+		problems = append(problems, "database_path is required for SQLite provider")
+	}
+	if err := validateCompression(config.Compression); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := validateStorage(config.Storage); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if len(problems) > 0 {
+		return provider.Check{Name: "Configuration", Status: provider.CheckFailed, Message: strings.Join(problems, "; "), Fix: "Fix lunar.yml"}
+	}
+	return provider.Check{Name: "Configuration", Status: provider.CheckPassed, Message: "valid"}
+}
@@ -0,0 +1,137 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/leonvogt/lunar/internal/provider"
+)
+
+// How often a blocked lock is retried while waiting for it
+const lockRetryDelay = 100 * time.Millisecond
+
+// fileLock is a file lock that records its holder, so that other processes can tell who they are waiting for.
+// The holder is kept in a separate `.owner` file, as Windows doesn't allow other processes to read a locked file.
+type fileLock struct {
+	name  string
+	flock *flock.Flock
+}
+
+func newFileLock(name, path string) *fileLock {
+	return &fileLock{
+		name:  name,
+		flock: flock.New(path),
+	}
+}
+
+// Waits for the lock until the context is cancelled
+func (l *fileLock) lock(ctx context.Context) error {
+	if err := l.acquire(ctx); err != nil {
+		return err
+	}
+
+	// The holder is only informational, so failing to record it doesn't fail the operation
+	if data, err := json.Marshal(provider.CurrentLockHolder()); err == nil {
+		_ = os.WriteFile(l.ownerPath(), data, 0644)
+	}
+	return nil
+}
+
+// Waits for the lock shared with other readers until the context is cancelled. No holder is recorded,
+// as readers don't block each other.
+func (l *fileLock) lockShared(ctx context.Context) error {
+	locked, err := l.flock.TryRLockContext(ctx, lockRetryDelay)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return errors.New("lock is held by another process")
+	}
+	return nil
+}
+
+func (l *fileLock) unlock() error {
+	_ = os.Remove(l.ownerPath())
+	return l.flock.Unlock()
+}
+
+// Waits until the current holder released the lock, without keeping it
+func (l *fileLock) wait(ctx context.Context) error {
+	if err := l.acquire(ctx); err != nil {
+		return err
+	}
+	return l.flock.Unlock()
+}
+
+func (l *fileLock) acquire(ctx context.Context) error {
+	locked, err := l.flock.TryLockContext(ctx, lockRetryDelay)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return errors.New("lock is held by another process")
+	}
+	return nil
+}
+
+func (l *fileLock) isHeld() bool {
+	locked, err := l.flock.TryLock()
+	if err != nil {
+		return true
+	}
+	if locked {
+		_ = l.flock.Unlock()
+		return false
+	}
+	return true
+}
+
+// Returns the process holding the lock, or nil if the lock is free
+func (l *fileLock) holder() (*provider.LockHolder, error) {
+	locked, err := l.flock.TryLock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %s lock: %v", l.name, err)
+	}
+	if locked {
+		// Left behind by a process that didn't get to clean up
+		_ = os.Remove(l.ownerPath())
+		_ = l.flock.Unlock()
+		return nil, nil
+	}
+
+	holder := provider.LockHolder{}
+	if data, err := os.ReadFile(l.ownerPath()); err == nil {
+		_ = json.Unmarshal(data, &holder)
+	}
+	holder.Lock = l.name
+	return &holder, nil
+}
+
+// The OS releases file locks of processes that exited, so a lock that is still locked belongs to a running
+// process, e.g. one on another host or one that reused the PID of the recorded holder. Only a lock that can
+// be taken is released, by removing its stale holder. The lock file itself is kept, as processes waiting for
+// it would otherwise lock the removed file while new processes lock a fresh one.
+func (l *fileLock) breakLock() error {
+	locked, err := l.flock.TryLock()
+	if err != nil {
+		return fmt.Errorf("failed to check %s lock: %v", l.name, err)
+	}
+	if !locked {
+		return fmt.Errorf("the %s lock is still held by a running process, wait for it to finish", l.name)
+	}
+	defer l.flock.Unlock()
+
+	if err := os.Remove(l.ownerPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove the holder of the %s lock: %v", l.name, err)
+	}
+	return nil
+}
+
+func (l *fileLock) ownerPath() string {
+	return l.flock.Path() + ".owner"
+}
@@ -0,0 +1,59 @@
+package sqlite
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// snapshotMetadata is stored next to each snapshot file and records how the snapshot was made.
+type snapshotMetadata struct {
+	// Name of the snapshot, needed for snapshots whose file name is hashed
+	Name         string       `json:"name,omitempty"`
+	CreatedAt    time.Time    `json:"created_at"`
+	CopyStrategy copyStrategy `json:"copy_strategy,omitempty"`
+	Compression  string       `json:"compression,omitempty"`
+	// Size of the uncompressed database in bytes
+	Size int64 `json:"size,omitempty"`
+	// Bytes a deduplicated snapshot added to the chunk store
+	StoredSize int64 `json:"stored_size,omitempty"`
+	// SHA-256 of the snapshot file and its WAL files (the manifest for deduplicated snapshots), checked by `lunar verify`.
+	// Empty for reflinked snapshots.
+	Checksum string `json:"checksum,omitempty"`
+	// Set with `lunar describe`, kept when the snapshot is replaced
+	Description string `json:"description,omitempty"`
+}
+
+// Returns empty metadata for snapshots that were created before metadata was recorded.
+func (p *Provider) readSnapshotMetadata(snapshotName string) (*snapshotMetadata, error) {
+	return readMetadataFile(p.snapshotMetadataPath(snapshotName))
+}
+
+func readMetadataFile(path string) (*snapshotMetadata, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &snapshotMetadata{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot metadata: %v", err)
+	}
+
+	metadata := &snapshotMetadata{}
+	if err := json.Unmarshal(data, metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot metadata: %v", err)
+	}
+	return metadata, nil
+}
+
+func (p *Provider) writeSnapshotMetadata(snapshotName string, metadata *snapshotMetadata) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot metadata: %v", err)
+	}
+
+	if err := os.WriteFile(p.snapshotMetadataPath(snapshotName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write snapshot metadata: %v", err)
+	}
+	return nil
+}
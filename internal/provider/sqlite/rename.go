@@ -0,0 +1,81 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/leonvogt/lunar/internal/provider"
+)
+
+// Renames the snapshot files, its copies and its metadata. The copy lock is taken before the lock,
+// like when copies are created, so that no copy is created under the old name meanwhile.
+func (p *Provider) RenameSnapshot(ctx context.Context, snapshotName, newName string) error {
+	if err := provider.ValidateSnapshotName(newName); err != nil {
+		return err
+	}
+
+	if err := p.copyLock.lock(ctx); err != nil {
+		return fmt.Errorf("failed to acquire copy lock: %v", err)
+	}
+	defer p.copyLock.unlock()
+
+	return p.withLock(ctx, func() error {
+		if err := p.CheckIfSnapshotExists(ctx, snapshotName); err != nil {
+			return err
+		}
+		if err := p.CheckIfSnapshotCanBeTaken(ctx, newName); err != nil {
+			return err
+		}
+
+		metadata, err := p.readSnapshotMetadata(snapshotName)
+		if err != nil {
+			return err
+		}
+		// Snapshots created before metadata was recorded get one now
+		if metadata.CreatedAt.IsZero() {
+			if version, err := p.snapshotVersion(snapshotName); err == nil {
+				metadata.CreatedAt = version
+			}
+		}
+		basePath, newBasePath := p.snapshotBasePath(snapshotName), p.snapshotBasePath(newName)
+		copies := p.snapshotCopyPaths(snapshotName)
+
+		// A snapshot that can't be moved completely is moved back, so that it keeps its old name
+		extensions := []string{".db", ".db" + compressedFileExtension, ".db" + manifestFileExtension}
+		for _, suffix := range walFileSuffixes {
+			extensions = append(extensions, ".db"+suffix, ".db"+suffix+compressedFileExtension)
+		}
+		var moved []string
+		for _, extension := range extensions {
+			if _, err := os.Stat(basePath + extension); err != nil {
+				continue
+			}
+			if err := os.Rename(basePath+extension, newBasePath+extension); err != nil {
+				for _, movedExtension := range moved {
+					os.Rename(newBasePath+movedExtension, basePath+movedExtension)
+				}
+				return fmt.Errorf("failed to rename snapshot: %v", err)
+			}
+			moved = append(moved, extension)
+		}
+
+		// The metadata keeps the name of snapshots with hashed file names
+		metadata.Name = newName
+		if err := p.writeSnapshotMetadata(newName, metadata); err != nil {
+			return err
+		}
+		os.Remove(basePath + ".json")
+
+		// Copies are only there to speed up restores, so a copy that can't be renamed is removed instead
+		for _, copyPath := range copies {
+			newCopyPath := newBasePath + strings.TrimPrefix(copyPath, basePath)
+			if err := p.renameDatabaseFiles(copyPath, newCopyPath); err != nil {
+				p.removeDatabaseFiles(copyPath)
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,46 @@
+package sqlite
+
+import (
+	"context"
+	"os"
+)
+
+// Checks the quota and the free space before a snapshot of the database is stored. The snapshot and
+// its first copy each take up to the size of the database, less if the snapshot is compressed or
+// deduplicated. Replacing a snapshot releases the space of the old one and its copies first.
+func (p *Provider) checkSnapshotSpace(ctx context.Context, replacedSnapshot string) error {
+	limits := p.config.SpaceLimits
+
+	size, err := p.GetDatabaseSize(ctx)
+	if err != nil {
+		return err
+	}
+
+	if limits.MaxTotalSnapshotSize > 0 {
+		snapshots, err := p.ListSnapshots(ctx)
+		if err != nil {
+			return err
+		}
+		if err := limits.CheckQuota(snapshots, replacedSnapshot, size); err != nil {
+			return err
+		}
+	}
+
+	var released int64
+	if replacedSnapshot != "" {
+		_, released = p.snapshotSizes(replacedSnapshot)
+		for _, copyPath := range p.snapshotCopyPaths(replacedSnapshot) {
+			if info, err := os.Stat(copyPath); err == nil {
+				released += info.Size()
+			}
+		}
+	}
+
+	return limits.CheckFreeSpace(p.config.SnapshotDirectory, 2*size, released)
+}
+
+// Checks the free space before a copy of the snapshot is materialized
+func (p *Provider) checkCopySpace(snapshotName string) error {
+	size, _ := p.snapshotSizes(snapshotName)
+	return p.config.SpaceLimits.CheckFreeSpace(p.config.SnapshotDirectory, size, 0)
+}
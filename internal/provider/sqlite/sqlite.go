@@ -1,25 +1,49 @@
 package sqlite
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/gofrs/flock"
 	"github.com/leonvogt/lunar/internal/provider"
 )
 
 type Config struct {
 	DatabasePath      string
 	SnapshotDirectory string
+	Compression       string
+	Storage           string
+	// Number of pre-warmed copies kept per snapshot for fast restores
+	WarmCopies  int
+	SpaceLimits provider.SpaceLimits
 }
 
+// Files SQLite keeps next to the database in WAL mode
+var walFileSuffixes = []string{"-wal", "-shm"}
+
+// Leaves room for the longest suffix of snapshot files (e.g. `_copy12.db-wal`) within the
+// 255 bytes most file systems allow for file names
+const maxSnapshotFileNameLength = 255 - 24
+
+// Marks snapshot file names that are hashed, `@` never appears in plain snapshot names
+const hashedFileNamePrefix = "@"
+
+// Matches pre-warmed copies: `_copy.db`, `_copy2.db`, `_copy3.db`, ...
+var snapshotCopyFilePattern = regexp.MustCompile(`_copy([2-9]|[1-9][0-9]+)?\.db$`)
+
 type Provider struct {
 	config *Config
-	lock   *flock.Flock
+	lock   *fileLock
+	// Serializes background processes that fill the pool of pre-warmed copies
+	copyLock *fileLock
+	// Shared while snapshots are reassembled from chunks, exclusive while unreferenced chunks are removed
+	chunkLock *fileLock
 }
 
 func New(config *Config) (*Provider, error) {
@@ -31,6 +55,14 @@ func New(config *Config) (*Provider, error) {
 		return nil, fmt.Errorf("database file does not exist: %s", config.DatabasePath)
 	}
 
+	if err := validateCompression(config.Compression); err != nil {
+		return nil, err
+	}
+
+	if err := validateStorage(config.Storage); err != nil {
+		return nil, err
+	}
+
 	// Set default snapshot directory if not provided
 	if config.SnapshotDirectory == "" {
 		config.SnapshotDirectory = filepath.Join(filepath.Dir(config.DatabasePath), ".lunar_snapshots")
@@ -40,15 +72,18 @@ func New(config *Config) (*Provider, error) {
 		return nil, fmt.Errorf("failed to create snapshot directory: %v", err)
 	}
 
-	lockPath := filepath.Join(config.SnapshotDirectory, ".lunar.lock")
-	fileLock := flock.New(lockPath)
-
 	return &Provider{
-		config: config,
-		lock:   fileLock,
+		config:    config,
+		lock:      newFileLock("operation", filepath.Join(config.SnapshotDirectory, ".lunar.lock")),
+		copyLock:  newFileLock("snapshot copy", filepath.Join(config.SnapshotDirectory, ".lunar_copy.lock")),
+		chunkLock: newFileLock("chunk store", filepath.Join(config.SnapshotDirectory, ".lunar_chunks.lock")),
 	}, nil
 }
 
+func (p *Provider) TakeWarnings() []string {
+	return nil
+}
+
 func (p *Provider) Close() error {
 	// No persistent connections to close for SQLite file-based approach
 	return nil
@@ -58,7 +93,7 @@ func (p *Provider) GetDatabaseIdentifier() string {
 	return p.config.DatabasePath
 }
 
-func (p *Provider) GetDatabaseSize() (int64, error) {
+func (p *Provider) GetDatabaseSize(ctx context.Context) (int64, error) {
 	info, err := os.Stat(p.config.DatabasePath)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get database size: %v", err)
@@ -66,86 +101,207 @@ func (p *Provider) GetDatabaseSize() (int64, error) {
 	return info.Size(), nil
 }
 
-func (p *Provider) CheckIfSnapshotCanBeTaken(snapshotName string) error {
-	snapshotPath := p.snapshotPath(snapshotName)
+// Writes change the size or modification time of the database or its WAL file. Readers of a
+// database in WAL mode create an empty WAL file, which doesn't count as a modification.
+func (p *Provider) DatabaseFingerprint(ctx context.Context) (string, error) {
+	info, err := os.Stat(p.config.DatabasePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint database: %v", err)
+	}
+	fingerprint := fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+
+	if walInfo, err := os.Stat(p.config.DatabasePath + "-wal"); err == nil && walInfo.Size() > 0 {
+		fingerprint += fmt.Sprintf(":%d:%d", walInfo.Size(), walInfo.ModTime().UnixNano())
+	}
+	return fingerprint, nil
+}
+
+func (p *Provider) GetDetails(ctx context.Context) ([]provider.Detail, error) {
+	return []provider.Detail{
+		{Label: "Snapshot directory", Value: p.config.SnapshotDirectory},
+	}, nil
+}
+
+func (p *Provider) GetSnapshotDetails(ctx context.Context, snapshotName string) ([]provider.Detail, error) {
+	if err := p.CheckIfSnapshotExists(ctx, snapshotName); err != nil {
+		return nil, err
+	}
 
-	if _, err := os.Stat(snapshotPath); err == nil {
+	metadata, err := p.readSnapshotMetadata(snapshotName)
+	if err != nil {
+		return nil, err
+	}
+
+	copyStrategy := "unknown"
+	if metadata.CopyStrategy != "" {
+		copyStrategy = metadata.CopyStrategy.Description()
+	}
+
+	readyCopies, err := p.ReadySnapshotCopies(ctx, snapshotName)
+	if err != nil {
+		return nil, err
+	}
+
+	format, snapshotFile, _ := p.findSnapshot(snapshotName)
+
+	compression := metadata.Compression
+	if format == snapshotFormatDeduplicated {
+		// Earlier versions recorded the configured compression, which only applies to new chunks
+		compression = "per chunk"
+	} else if compression == "" {
+		compression = compressionNone
+	}
+
+	return []provider.Detail{
+		{Label: "Snapshot file", Value: snapshotFile},
+		{Label: "Storage format", Value: string(format)},
+		{Label: "Compression", Value: compression},
+		{Label: "Copy strategy", Value: copyStrategy},
+		{Label: "Fast restore copies", Value: fmt.Sprintf("%d of %d ready", readyCopies, p.warmCopies())},
+	}, nil
+}
+
+func (p *Provider) CheckIfSnapshotCanBeTaken(ctx context.Context, snapshotName string) error {
+	if err := provider.ValidateSnapshotName(snapshotName); err != nil {
+		return err
+	}
+
+	if p.snapshotExists(snapshotName) {
 		return fmt.Errorf("snapshot with name %s already exists", snapshotName)
 	}
 
 	return nil
 }
 
-func (p *Provider) CheckIfSnapshotExists(snapshotName string) error {
-	snapshotPath := p.snapshotPath(snapshotName)
-
-	if _, err := os.Stat(snapshotPath); os.IsNotExist(err) {
+func (p *Provider) CheckIfSnapshotExists(ctx context.Context, snapshotName string) error {
+	if !p.snapshotExists(snapshotName) {
 		return fmt.Errorf("snapshot with name %s does not exist", snapshotName)
 	}
 
 	return nil
 }
 
-func (p *Provider) CreateSnapshot(snapshotName string) error {
-	return p.withLock(func() error {
-		snapshotPath := p.snapshotPath(snapshotName)
+func (p *Provider) CreateSnapshot(ctx context.Context, snapshotName string) error {
+	if err := provider.ValidateSnapshotName(snapshotName); err != nil {
+		return err
+	}
 
-		if err := copyFile(p.config.DatabasePath, snapshotPath); err != nil {
+	return p.withLock(ctx, func() error {
+		if err := p.checkSnapshotSpace(ctx, ""); err != nil {
 			return fmt.Errorf("failed to create snapshot: %v", err)
 		}
 
-		p.copyWALFiles(p.config.DatabasePath, snapshotPath)
+		if err := p.storeSnapshot(ctx, snapshotName, ""); err != nil {
+			// Don't leave a partial snapshot behind, e.g. when the snapshot was interrupted
+			p.removeFailedSnapshot(ctx, snapshotName)
+			return fmt.Errorf("failed to create snapshot: %v", err)
+		}
 
 		return nil
 	})
 }
 
-func (p *Provider) CreateSnapshotCopy(snapshotName string) error {
-	return p.withLock(func() error {
-		snapshotPath := p.snapshotPath(snapshotName)
-		copyPath := p.snapshotCopyPath(snapshotName)
+// Fills the pool of pre-warmed copies of the snapshot up to the configured number of warm copies.
+// Copies are created without holding the main lock, so restores can consume ready copies in the meantime.
+func (p *Provider) CreateSnapshotCopy(ctx context.Context, snapshotName string) error {
+	if err := p.copyLock.lock(ctx); err != nil {
+		return fmt.Errorf("failed to acquire copy lock: %v", err)
+	}
+	defer p.copyLock.unlock()
+
+	for index := 0; index < p.warmCopies(); index++ {
+		copyPath := p.snapshotCopyPath(snapshotName, index)
+		if _, err := os.Stat(copyPath); err == nil {
+			continue
+		}
 
-		if err := copyFile(snapshotPath, copyPath); err != nil {
+		if err := p.checkCopySpace(snapshotName); err != nil {
 			return fmt.Errorf("failed to create snapshot copy: %v", err)
 		}
 
-		// Also copy WAL files if they exist
-		p.copyWALFiles(snapshotPath, copyPath)
+		if err := p.createSnapshotCopy(ctx, snapshotName, copyPath); err != nil {
+			return fmt.Errorf("failed to create snapshot copy: %v", err)
+		}
+	}
 
-		return nil
-	})
+	return nil
 }
 
-func (p *Provider) RestoreSnapshot(snapshotName string) error {
-	return p.withLock(func() error {
-		copyPath := p.snapshotCopyPath(snapshotName)
+// The copy is always a plain database file, so that restoring stays fast
+// regardless of how the snapshot itself is stored
+func (p *Provider) createSnapshotCopy(ctx context.Context, snapshotName, copyPath string) error {
+	version, err := p.snapshotVersion(snapshotName)
+	if err != nil {
+		return err
+	}
+
+	tempPath := copyPath + ".tmp"
+	defer p.removeDatabaseFiles(tempPath)
+
+	if err := p.materializeSnapshot(ctx, snapshotName, tempPath); err != nil {
+		return err
+	}
 
-		if _, err := os.Stat(copyPath); os.IsNotExist(err) {
-			return fmt.Errorf("snapshot copy %s does not exist. The snapshot may still be initializing or was not created properly", snapshotName)
+	return p.withLock(ctx, func() error {
+		// The snapshot may have been removed or replaced while the copy was created
+		currentVersion, err := p.snapshotVersion(snapshotName)
+		if err != nil || !currentVersion.Equal(version) {
+			return nil
 		}
 
-		if err := os.Remove(p.config.DatabasePath); err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("failed to remove current database: %v", err)
+		for _, suffix := range append([]string{""}, walFileSuffixes...) {
+			if _, err := os.Stat(tempPath + suffix); err != nil {
+				continue
+			}
+			if err := os.Rename(tempPath+suffix, copyPath+suffix); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+}
 
-		// Remove WAL and SHM files if they exist
-		os.Remove(p.config.DatabasePath + "-wal")
-		os.Remove(p.config.DatabasePath + "-shm")
+// Waits for a background process that is still creating copies of the snapshot.
+// If no copy is ready afterwards (e.g. the background process crashed), one is created synchronously.
+func (p *Provider) EnsureSnapshotCopy(ctx context.Context, snapshotName string) error {
+	if err := p.copyLock.lock(ctx); err != nil {
+		return fmt.Errorf("failed to acquire copy lock: %v", err)
+	}
+	defer p.copyLock.unlock()
 
-		if err := copyFile(copyPath, p.config.DatabasePath); err != nil {
-			return fmt.Errorf("failed to restore snapshot: %v", err)
-		}
+	if !p.snapshotExists(snapshotName) {
+		return fmt.Errorf("snapshot with name %s does not exist", snapshotName)
+	}
+	if len(p.snapshotCopyPaths(snapshotName)) > 0 {
+		return nil
+	}
+
+	if err := p.createSnapshotCopy(ctx, snapshotName, p.snapshotCopyPath(snapshotName, 0)); err != nil {
+		return fmt.Errorf("failed to create snapshot copy: %v", err)
+	}
+	return nil
+}
+
+func (p *Provider) RestoreSnapshot(ctx context.Context, snapshotName string) error {
+	if err := p.EnsureSnapshotCopy(ctx, snapshotName); err != nil {
+		return err
+	}
 
-		// Copy WAL files if they exist
-		p.copyWALFiles(copyPath, p.config.DatabasePath)
+	return p.withLock(ctx, func() error {
+		// Another restore may have used the copy in the meantime
+		copies := p.snapshotCopyPaths(snapshotName)
+		if len(copies) == 0 {
+			return fmt.Errorf("snapshot copy %s was used by another restore in the meantime. Please try again", snapshotName)
+		}
+		copyPath := copies[0]
 
-		// Remove the copy file after restore (it will be recreated)
-		os.Remove(copyPath)
-		os.Remove(copyPath + "-wal")
-		os.Remove(copyPath + "-shm")
+		// The copy is used up by the restore (the pool will be refilled). Moving it into place
+		// is instant and never leaves a half-written database behind if the restore is interrupted.
+		if err := p.moveIntoPlace(ctx, copyPath, p.config.DatabasePath); err != nil {
+			return fmt.Errorf("failed to restore snapshot: %v", err)
+		}
 
-		snapshotPath := p.snapshotPath(snapshotName)
-		if _, err := os.Stat(snapshotPath); os.IsNotExist(err) {
+		if !p.snapshotExists(snapshotName) {
 			return fmt.Errorf("snapshot %s no longer exists after restore", snapshotName)
 		}
 
@@ -153,55 +309,56 @@ func (p *Provider) RestoreSnapshot(snapshotName string) error {
 	})
 }
 
-func (p *Provider) RemoveSnapshot(snapshotName string) error {
-	return p.withLock(func() error {
-		snapshotPath := p.snapshotPath(snapshotName)
-		copyPath := p.snapshotCopyPath(snapshotName)
+func (p *Provider) RemoveSnapshot(ctx context.Context, snapshotName string) error {
+	// Wait for a background process that is still creating copies, so that it doesn't leave its temporary copy behind
+	if err := p.copyLock.lock(ctx); err != nil {
+		return fmt.Errorf("failed to acquire copy lock: %v", err)
+	}
+	defer p.copyLock.unlock()
 
-		if err := os.Remove(snapshotPath); err != nil && !os.IsNotExist(err) {
+	return p.withLock(ctx, func() error {
+		if err := p.removeSnapshotFiles(snapshotName); err != nil {
 			return fmt.Errorf("failed to remove snapshot: %v", err)
 		}
 
-		os.Remove(snapshotPath + "-wal")
-		os.Remove(snapshotPath + "-shm")
-		os.Remove(copyPath)
-		os.Remove(copyPath + "-wal")
-		os.Remove(copyPath + "-shm")
-
-		return nil
+		return p.collectUnreferencedChunks(ctx)
 	})
 }
 
-func (p *Provider) ReplaceSnapshot(snapshotName string) error {
-	return p.withLock(func() error {
-		if err := p.CheckIfSnapshotExists(snapshotName); err != nil {
+func (p *Provider) ReplaceSnapshot(ctx context.Context, snapshotName string) error {
+	return p.withLock(ctx, func() error {
+		if err := p.CheckIfSnapshotExists(ctx, snapshotName); err != nil {
 			return err
 		}
 
-		// Remove snapshot files directly (not calling RemoveSnapshot to avoid deadlock)
-		snapshotPath := p.snapshotPath(snapshotName)
-		copyPath := p.snapshotCopyPath(snapshotName)
+		// The old snapshot is only removed once it's clear that the new one fits
+		if err := p.checkSnapshotSpace(ctx, snapshotName); err != nil {
+			return fmt.Errorf("failed to replace snapshot: %v", err)
+		}
+
+		// The new snapshot keeps the description of the one it replaces
+		metadata, err := p.readSnapshotMetadata(snapshotName)
+		if err != nil {
+			return fmt.Errorf("failed to replace snapshot: %v", err)
+		}
 
-		if err := os.Remove(snapshotPath); err != nil && !os.IsNotExist(err) {
+		// Remove snapshot files directly (not calling RemoveSnapshot to avoid deadlock)
+		if err := p.removeSnapshotFiles(snapshotName); err != nil {
 			return fmt.Errorf("failed to remove existing snapshot: %v", err)
 		}
-		os.Remove(snapshotPath + "-wal")
-		os.Remove(snapshotPath + "-shm")
-		os.Remove(copyPath)
-		os.Remove(copyPath + "-wal")
-		os.Remove(copyPath + "-shm")
 
 		// Create snapshot directly (not calling CreateSnapshot to avoid deadlock)
-		if err := copyFile(p.config.DatabasePath, snapshotPath); err != nil {
+		if err := p.storeSnapshot(ctx, snapshotName, metadata.Description); err != nil {
+			p.removeFailedSnapshot(ctx, snapshotName)
 			return fmt.Errorf("failed to create new snapshot: %v", err)
 		}
-		p.copyWALFiles(p.config.DatabasePath, snapshotPath)
 
-		return nil
+		// Collect after storing, so chunks shared by the old and new snapshot are not written twice
+		return p.collectUnreferencedChunks(ctx)
 	})
 }
 
-func (p *Provider) ListSnapshots() ([]provider.SnapshotInfo, error) {
+func (p *Provider) ListSnapshots(ctx context.Context) ([]provider.SnapshotInfo, error) {
 	entries, err := os.ReadDir(p.config.SnapshotDirectory)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -226,12 +383,14 @@ func (p *Provider) ListSnapshots() ([]provider.SnapshotInfo, error) {
 		}
 
 		// Skip copy files
-		if strings.HasSuffix(name, "_copy.db") {
+		if snapshotCopyFilePattern.MatchString(name) {
 			continue
 		}
 
-		// Match snapshot files: dbname_snapshotname.db
+		// Match snapshot files: dbname_snapshotname.db, .db.zst or .db.manifest
 		prefix := strings.TrimSuffix(dbBaseName, filepath.Ext(dbBaseName)) + "_"
+		name = strings.TrimSuffix(name, compressedFileExtension)
+		name = strings.TrimSuffix(name, manifestFileExtension)
 		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".db") {
 			continue
 		}
@@ -239,134 +398,309 @@ func (p *Provider) ListSnapshots() ([]provider.SnapshotInfo, error) {
 		// Extract snapshot name
 		snapshotName := strings.TrimPrefix(name, prefix)
 		snapshotName = strings.TrimSuffix(snapshotName, ".db")
+		basePath := filepath.Join(p.config.SnapshotDirectory, strings.TrimSuffix(name, ".db"))
+		metadata, err := readMetadataFile(basePath + ".json")
+		if strings.HasPrefix(snapshotName, hashedFileNamePrefix) {
+			if err != nil || metadata.Name == "" {
+				continue
+			}
+			snapshotName = metadata.Name
+		}
 
-		info, err := entry.Info()
-		if err != nil {
-			snapshots = append(snapshots, provider.SnapshotInfo{Name: snapshotName, Age: 0})
-			continue
+		size, diskSize := p.snapshotSizes(snapshotName)
+		snapshot := provider.SnapshotInfo{
+			Name:        snapshotName,
+			Size:        size,
+			DiskSize:    diskSize,
+			ReadyCopies: len(p.snapshotCopyPaths(snapshotName)),
+		}
+		if err == nil {
+			snapshot.Description = metadata.Description
 		}
 
-		age := time.Since(info.ModTime())
-		snapshots = append(snapshots, provider.SnapshotInfo{Name: snapshotName, Age: age})
+		if info, err := entry.Info(); err == nil {
+			snapshot.Age = time.Since(info.ModTime())
+		}
+
+		snapshots = append(snapshots, snapshot)
 	}
 
 	return snapshots, nil
 }
 
-// For SQLite, we use mutex-based locking, so we just try to acquire the lock
-func (p *Provider) IsSnapshotInProgress(snapshotName string) bool {
-	if p.lock == nil {
-		return false
-	}
+// SQLite has no server that knows about other databases, and snapshot directories are
+// usually kept per database
+func (p *Provider) ListAllSnapshots(ctx context.Context) ([]provider.SnapshotInfo, error) {
+	return nil, fmt.Errorf("listing the snapshots of all databases is only supported for PostgreSQL")
+}
 
-	locked, err := p.lock.TryLock()
-	if err != nil {
-		return true
-	}
-	if locked {
-		_ = p.lock.Unlock()
+// SQLite snapshots are files in the snapshot directory that no database client opens by itself
+func (p *Provider) SetSnapshotProtection(ctx context.Context, snapshotName string, protected bool) error {
+	return fmt.Errorf("protecting snapshots is only supported for PostgreSQL")
+}
+
+// Stores the description in the metadata file of the snapshot
+func (p *Provider) SetSnapshotDescription(ctx context.Context, snapshotName, description string) error {
+	return p.withLock(ctx, func() error {
+		if err := p.CheckIfSnapshotExists(ctx, snapshotName); err != nil {
+			return err
+		}
+
+		metadata, err := p.readSnapshotMetadata(snapshotName)
+		if err != nil {
+			return err
+		}
+		// Snapshots created before metadata was recorded get one now
+		if metadata.CreatedAt.IsZero() {
+			if version, err := p.snapshotVersion(snapshotName); err == nil {
+				metadata.CreatedAt = version
+			}
+		}
+		metadata.Name = snapshotName
+		metadata.Description = description
+
+		return p.writeSnapshotMetadata(snapshotName, metadata)
+	})
+}
+
+// Snapshot file names didn't change between versions, so there is nothing to migrate
+func (p *Provider) LegacySnapshots(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (p *Provider) MigrateLegacySnapshots(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+// For SQLite, we use mutex-based locking, so we just try to acquire the lock.
+// Copies are prepared under their own lock, so that restores are not blocked by them.
+func (p *Provider) IsSnapshotInProgress(ctx context.Context, snapshotName string) bool {
+	if p.copyLock == nil {
 		return false
 	}
-	return true
+	return p.copyLock.isHeld()
 }
 
-func (p *Provider) IsOperationInProgress() bool {
+func (p *Provider) IsOperationInProgress(ctx context.Context) bool {
 	if p.lock == nil {
 		return false
 	}
+	return p.lock.isHeld()
+}
 
-	locked, err := p.lock.TryLock()
-	if err != nil {
-		return true
+func (p *Provider) WaitForOngoingSnapshot(ctx context.Context, snapshotName string) error {
+	if p.copyLock == nil {
+		return nil
 	}
-	if locked {
-		_ = p.lock.Unlock()
-		return false
+
+	if err := p.copyLock.wait(ctx); err != nil {
+		return fmt.Errorf("failed to acquire copy lock: %v", err)
 	}
-	return true
+	return nil
 }
 
-func (p *Provider) WaitForOngoingSnapshot(snapshotName string) error {
+func (p *Provider) WaitForOngoingOperations(ctx context.Context) error {
 	if p.lock == nil {
 		return nil
 	}
 
-	if err := p.lock.Lock(); err != nil {
+	if err := p.lock.wait(ctx); err != nil {
 		return fmt.Errorf("failed to acquire lock: %v", err)
 	}
-	return p.lock.Unlock()
+	return nil
 }
 
-func (p *Provider) WaitForOngoingOperations() error {
-	if p.lock == nil {
-		return nil
+func (p *Provider) LockHolders(ctx context.Context) ([]provider.LockHolder, error) {
+	holders := make([]provider.LockHolder, 0)
+	for _, lock := range []*fileLock{p.lock, p.copyLock} {
+		holder, err := lock.holder()
+		if err != nil {
+			return nil, err
+		}
+		if holder != nil {
+			holders = append(holders, *holder)
+		}
 	}
+	return holders, nil
+}
 
-	if err := p.lock.Lock(); err != nil {
-		return fmt.Errorf("failed to acquire lock: %v", err)
+func (p *Provider) BreakLock(ctx context.Context, holder provider.LockHolder) error {
+	for _, lock := range []*fileLock{p.lock, p.copyLock} {
+		if lock.name == holder.Lock {
+			return lock.breakLock()
+		}
 	}
-	return p.lock.Unlock()
+	return fmt.Errorf("unknown lock: %s", holder.Lock)
 }
 
-func (p *Provider) withLock(action func() error) error {
+func (p *Provider) withLock(ctx context.Context, action func() error) error {
 	if p.lock == nil {
 		return action()
 	}
 
-	if err := p.lock.Lock(); err != nil {
+	if err := p.lock.lock(ctx); err != nil {
 		return fmt.Errorf("failed to acquire lock: %v", err)
 	}
-	defer p.lock.Unlock()
+	defer p.lock.unlock()
 
 	return action()
 }
 
+// Returns the path of the snapshot files without extension: `<database>_<snapshot>`.
+// Names that aren't safe or too long for file names are hashed to `<database>_@<hash>`,
+// the metadata of the snapshot keeps the actual name.
+func (p *Provider) snapshotBasePath(snapshotName string) string {
+	fileName := p.databaseBaseName() + "_" + snapshotName
+	if provider.IsPlainSnapshotName(snapshotName) && len(fileName) <= maxSnapshotFileNameLength {
+		return filepath.Join(p.config.SnapshotDirectory, fileName)
+	}
+
+	// Snapshots created before names were hashed keep their file names
+	legacyPath := filepath.Join(p.config.SnapshotDirectory, fileName)
+	for _, extension := range []string{".db", ".db" + compressedFileExtension, ".db" + manifestFileExtension} {
+		if _, err := os.Stat(legacyPath + extension); err == nil {
+			return legacyPath
+		}
+	}
+
+	return filepath.Join(p.config.SnapshotDirectory, p.databaseBaseName()+"_"+hashedFileNamePrefix+provider.HashedName(snapshotName))
+}
+
 func (p *Provider) snapshotPath(snapshotName string) string {
-	dbBaseName := filepath.Base(p.config.DatabasePath)
-	dbNameWithoutExt := strings.TrimSuffix(dbBaseName, filepath.Ext(dbBaseName))
-	return filepath.Join(p.config.SnapshotDirectory, dbNameWithoutExt+"_"+snapshotName+".db")
+	return p.snapshotBasePath(snapshotName) + ".db"
 }
 
-func (p *Provider) snapshotCopyPath(snapshotName string) string {
+func (p *Provider) databaseBaseName() string {
 	dbBaseName := filepath.Base(p.config.DatabasePath)
-	dbNameWithoutExt := strings.TrimSuffix(dbBaseName, filepath.Ext(dbBaseName))
-	return filepath.Join(p.config.SnapshotDirectory, dbNameWithoutExt+"_"+snapshotName+"_copy.db")
+	return strings.TrimSuffix(dbBaseName, filepath.Ext(dbBaseName))
+}
+
+// Returns the path of a pre-warmed copy. The first copy is named `<snapshot>_copy.db`,
+// further copies of the pool `<snapshot>_copy2.db`, `<snapshot>_copy3.db`, ...
+func (p *Provider) snapshotCopyPath(snapshotName string, index int) string {
+	suffix := "_copy"
+	if index > 0 {
+		suffix += strconv.Itoa(index + 1)
+	}
+	return p.snapshotBasePath(snapshotName) + suffix + ".db"
 }
 
-func (p *Provider) copyWALFiles(src, dst string) {
-	// Copy WAL file if exists
-	if _, err := os.Stat(src + "-wal"); err == nil {
-		copyFile(src+"-wal", dst+"-wal")
+// Returns the existing copies of the snapshot, ordered by their index in the pool.
+// Also includes copies beyond the configured pool size, e.g. after warm_copies was lowered.
+func (p *Provider) snapshotCopyPaths(snapshotName string) []string {
+	firstCopy := p.snapshotCopyPath(snapshotName, 0)
+	prefix := strings.TrimSuffix(firstCopy, "_copy.db")
+
+	matches, _ := filepath.Glob(prefix + "_copy*.db")
+	copies := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if snapshotCopyFilePattern.MatchString(match) && snapshotCopyFilePattern.FindStringIndex(match)[0] == len(prefix) {
+			copies = append(copies, match)
+		}
 	}
-	// Copy SHM file if exists
-	if _, err := os.Stat(src + "-shm"); err == nil {
-		copyFile(src+"-shm", dst+"-shm")
+
+	// `_copy.db` sorts after `_copy2.db`, so order by the length of the name first
+	sort.Slice(copies, func(i, j int) bool {
+		if len(copies[i]) != len(copies[j]) {
+			return len(copies[i]) < len(copies[j])
+		}
+		return copies[i] < copies[j]
+	})
+
+	return copies
+}
+
+func (p *Provider) ReadySnapshotCopies(ctx context.Context, snapshotName string) (int, error) {
+	return len(p.snapshotCopyPaths(snapshotName)), nil
+}
+
+func (p *Provider) warmCopies() int {
+	if p.config.WarmCopies < 1 {
+		return 1
 	}
+	return p.config.WarmCopies
 }
 
-func copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
-	if err != nil {
-		return err
+// Identifies the current version of a snapshot, to detect when it was replaced
+func (p *Provider) snapshotVersion(snapshotName string) (time.Time, error) {
+	_, path, exists := p.findSnapshot(snapshotName)
+	if !exists {
+		return time.Time{}, fmt.Errorf("snapshot with name %s does not exist", snapshotName)
 	}
-	defer sourceFile.Close()
 
-	// Get source file info for permissions
-	sourceInfo, err := sourceFile.Stat()
+	info, err := os.Stat(path)
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
+	return info.ModTime(), nil
+}
 
-	destFile, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, sourceInfo.Mode())
-	if err != nil {
+// Removes a database file together with its WAL and SHM files
+func (p *Provider) removeDatabaseFiles(path string) {
+	os.Remove(path)
+	for _, suffix := range walFileSuffixes {
+		os.Remove(path + suffix)
+	}
+}
+
+func (p *Provider) snapshotMetadataPath(snapshotName string) string {
+	return p.snapshotBasePath(snapshotName) + ".json"
+}
+
+func (p *Provider) copyWALFiles(ctx context.Context, src, dst string) error {
+	for _, suffix := range walFileSuffixes {
+		if _, err := os.Stat(src + suffix); err != nil {
+			continue
+		}
+		if _, err := copyFile(ctx, src+suffix, dst+suffix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replaces dst (and its WAL files) with src. Falls back to copying when both are on
+// different filesystems, in which case the copy is written next to dst first.
+func (p *Provider) moveIntoPlace(ctx context.Context, src, dst string) error {
+	if err := p.renameDatabaseFiles(src, dst); err == nil {
+		return nil
+	}
+
+	tempPath := dst + ".lunar.tmp"
+	defer p.removeDatabaseFiles(tempPath)
+
+	if _, err := copyFile(ctx, src, tempPath); err != nil {
+		return err
+	}
+	if err := p.copyWALFiles(ctx, src, tempPath); err != nil {
+		return err
+	}
+	if err := p.renameDatabaseFiles(tempPath, dst); err != nil {
 		return err
 	}
-	defer destFile.Close()
 
-	_, err = io.Copy(destFile, sourceFile)
-	if err != nil {
+	p.removeDatabaseFiles(src)
+	return nil
+}
+
+// WAL files of dst are removed first, as they must never be combined with another database file
+func (p *Provider) renameDatabaseFiles(src, dst string) error {
+	for _, suffix := range walFileSuffixes {
+		if err := os.Remove(dst + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Rename(src, dst); err != nil {
 		return err
 	}
 
-	return destFile.Sync()
+	for _, suffix := range walFileSuffixes {
+		if _, err := os.Stat(src + suffix); err == nil {
+			if err := os.Rename(src+suffix, dst+suffix); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
@@ -0,0 +1,242 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// snapshotFormat describes how a snapshot is kept in the snapshot directory.
+// It is detected from the files on disk, so snapshots keep working after the configuration changes.
+type snapshotFormat string
+
+const (
+	// Plain copy of the database: dbname_snapshot.db
+	snapshotFormatFile snapshotFormat = "file"
+	// zstd compressed copy of the database: dbname_snapshot.db.zst
+	snapshotFormatCompressed snapshotFormat = "compressed"
+	// Manifest referencing chunks in the content-addressed store: dbname_snapshot.db.manifest
+	snapshotFormatDeduplicated snapshotFormat = "deduplicated"
+)
+
+func (p *Provider) compressedSnapshotPath(snapshotName string) string {
+	return p.snapshotPath(snapshotName) + compressedFileExtension
+}
+
+func (p *Provider) snapshotManifestPath(snapshotName string) string {
+	return p.snapshotPath(snapshotName) + manifestFileExtension
+}
+
+// Returns the format and the main file of an existing snapshot.
+func (p *Provider) findSnapshot(snapshotName string) (snapshotFormat, string, bool) {
+	candidates := []struct {
+		format snapshotFormat
+		path   string
+	}{
+		{snapshotFormatFile, p.snapshotPath(snapshotName)},
+		{snapshotFormatCompressed, p.compressedSnapshotPath(snapshotName)},
+		{snapshotFormatDeduplicated, p.snapshotManifestPath(snapshotName)},
+	}
+
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate.path); err == nil {
+			return candidate.format, candidate.path, true
+		}
+	}
+
+	return "", "", false
+}
+
+func (p *Provider) snapshotExists(snapshotName string) bool {
+	_, _, exists := p.findSnapshot(snapshotName)
+	return exists
+}
+
+// Returns the logical (uncompressed) size of the snapshot and the size it occupies on disk.
+// For deduplicated snapshots the size on disk is what the snapshot added to the chunk store.
+func (p *Provider) snapshotSizes(snapshotName string) (int64, int64) {
+	format, path, exists := p.findSnapshot(snapshotName)
+	if !exists {
+		return 0, 0
+	}
+
+	var diskSize int64
+	if info, err := os.Stat(path); err == nil {
+		diskSize = info.Size()
+	}
+
+	size := diskSize
+	if metadata, err := p.readSnapshotMetadata(snapshotName); err == nil {
+		if metadata.Size > 0 {
+			size = metadata.Size
+		}
+		if format == snapshotFormatDeduplicated {
+			diskSize += metadata.StoredSize
+		}
+	}
+
+	return size, diskSize
+}
+
+// Stores the database (and its WAL files) in the snapshot directory using the configured format
+// and records how it was stored. Callers must hold the lock.
+func (p *Provider) storeSnapshot(ctx context.Context, snapshotName, description string) error {
+	metadata := &snapshotMetadata{
+		Name:        snapshotName,
+		CreatedAt:   time.Now(),
+		Compression: p.compression(),
+		Description: description,
+	}
+
+	switch {
+	case p.config.Storage == storageDedup:
+		size, storedSize, err := p.storeDeduplicatedSnapshot(ctx, snapshotName)
+		if err != nil {
+			return err
+		}
+		// Chunks shared with earlier snapshots keep the compression they were stored with
+		metadata.Compression = ""
+		metadata.CopyStrategy = copyStrategyChunked
+		metadata.Size = size
+		metadata.StoredSize = storedSize
+
+	case p.config.Compression == compressionZstd:
+		size, err := p.storeCompressedSnapshot(ctx, snapshotName)
+		if err != nil {
+			return err
+		}
+		metadata.CopyStrategy = copyStrategyZstd
+		metadata.Size = size
+
+	default:
+		snapshotPath := p.snapshotPath(snapshotName)
+		strategy, err := copyFile(ctx, p.config.DatabasePath, snapshotPath)
+		if err != nil {
+			return err
+		}
+		if err := p.copyWALFiles(ctx, p.config.DatabasePath, snapshotPath); err != nil {
+			return err
+		}
+
+		size, err := p.GetDatabaseSize(ctx)
+		if err != nil {
+			return err
+		}
+		metadata.CopyStrategy = strategy
+		metadata.Size = size
+	}
+
+	// A reflink is near-instant, reading the whole snapshot for its checksum would make it as slow as a copy.
+	// `lunar verify` still checks the integrity of reflinked snapshots.
+	if metadata.CopyStrategy != copyStrategyReflink {
+		checksum, err := p.snapshotChecksum(ctx, snapshotName)
+		if err != nil {
+			return fmt.Errorf("failed to compute snapshot checksum: %v", err)
+		}
+		metadata.Checksum = checksum
+	}
+
+	return p.writeSnapshotMetadata(snapshotName, metadata)
+}
+
+// Writes the snapshot (and its WAL files) as a plain database file to dst.
+func (p *Provider) materializeSnapshot(ctx context.Context, snapshotName, dst string) error {
+	format, path, exists := p.findSnapshot(snapshotName)
+	if !exists {
+		return fmt.Errorf("snapshot with name %s does not exist", snapshotName)
+	}
+
+	switch format {
+	case snapshotFormatCompressed:
+		return p.decompressSnapshot(ctx, snapshotName, dst)
+	case snapshotFormatDeduplicated:
+		return p.restoreDeduplicatedSnapshot(ctx, snapshotName, dst)
+	default:
+		if _, err := copyFile(ctx, path, dst); err != nil {
+			return err
+		}
+		return p.copyWALFiles(ctx, path, dst)
+	}
+}
+
+func (p *Provider) compression() string {
+	if p.config.Compression == "" {
+		return compressionNone
+	}
+	return p.config.Compression
+}
+
+// Compresses the database (and its WAL files) into the snapshot directory while reading it.
+// Returns the uncompressed size of the database.
+func (p *Provider) storeCompressedSnapshot(ctx context.Context, snapshotName string) (int64, error) {
+	snapshotPath := p.snapshotPath(snapshotName)
+
+	size, err := compressFile(ctx, p.config.DatabasePath, p.compressedSnapshotPath(snapshotName))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, suffix := range walFileSuffixes {
+		if _, err := os.Stat(p.config.DatabasePath + suffix); err == nil {
+			if _, err := compressFile(ctx, p.config.DatabasePath+suffix, snapshotPath+suffix+compressedFileExtension); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return size, nil
+}
+
+// Decompresses a compressed snapshot (and its WAL files) to dst.
+func (p *Provider) decompressSnapshot(ctx context.Context, snapshotName, dst string) error {
+	snapshotPath := p.snapshotPath(snapshotName)
+
+	if err := decompressFile(ctx, p.compressedSnapshotPath(snapshotName), dst); err != nil {
+		return err
+	}
+
+	for _, suffix := range walFileSuffixes {
+		compressedPath := snapshotPath + suffix + compressedFileExtension
+		if _, err := os.Stat(compressedPath); err == nil {
+			if err := decompressFile(ctx, compressedPath, dst+suffix); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Removes the snapshot, its copies and all related files. Callers must hold the lock.
+// Chunks of deduplicated snapshots are left in place, see collectUnreferencedChunks.
+func (p *Provider) removeSnapshotFiles(snapshotName string) error {
+	snapshotPath := p.snapshotPath(snapshotName)
+
+	mainFiles := []string{snapshotPath, p.compressedSnapshotPath(snapshotName), p.snapshotManifestPath(snapshotName)}
+	for _, path := range mainFiles {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	for _, suffix := range walFileSuffixes {
+		os.Remove(snapshotPath + suffix)
+		os.Remove(snapshotPath + suffix + compressedFileExtension)
+	}
+	for _, copyPath := range p.snapshotCopyPaths(snapshotName) {
+		p.removeDatabaseFiles(copyPath)
+	}
+	os.Remove(p.snapshotMetadataPath(snapshotName))
+
+	return nil
+}
+
+// Removes what a failed store left behind, including the chunks that only the partial snapshot referenced.
+// Runs even if the store was interrupted, errors are ignored. Callers must hold the lock.
+func (p *Provider) removeFailedSnapshot(ctx context.Context, snapshotName string) {
+	p.removeSnapshotFiles(snapshotName)
+	if p.config.Storage == storageDedup {
+		p.collectUnreferencedChunks(context.WithoutCancel(ctx))
+	}
+}
@@ -0,0 +1,216 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func (p *Provider) VerifySnapshot(ctx context.Context, snapshotName string) ([]string, error) {
+	if err := p.CheckIfSnapshotExists(ctx, snapshotName); err != nil {
+		return nil, err
+	}
+
+	format, path, _ := p.findSnapshot(snapshotName)
+	var problems []string
+
+	// The metadata is written after the snapshot file, so a snapshot file that changed later was modified
+	if metadataInfo, err := os.Stat(p.snapshotMetadataPath(snapshotName)); err == nil {
+		snapshotInfo, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify snapshot: %v", err)
+		}
+		if snapshotInfo.ModTime().After(metadataInfo.ModTime()) {
+			problems = append(problems, fmt.Sprintf("the snapshot file was modified at %s, after the snapshot was created", snapshotInfo.ModTime().Format("2006-01-02 15:04:05")))
+		}
+	}
+
+	metadata, err := p.readSnapshotMetadata(snapshotName)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.Checksum != "" {
+		checksum, err := p.snapshotChecksum(ctx, snapshotName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify snapshot: %v", err)
+		}
+		if checksum != metadata.Checksum {
+			problems = append(problems, "the checksum of the snapshot files doesn't match the one recorded when the snapshot was created")
+		}
+	}
+
+	if format == snapshotFormatDeduplicated {
+		chunkProblems, err := p.verifyChunks(ctx, snapshotName)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, chunkProblems...)
+	}
+
+	integrityProblems, err := p.checkIntegrity(ctx, snapshotName)
+	if err != nil {
+		return nil, err
+	}
+	return append(problems, integrityProblems...), nil
+}
+
+// Returns the SHA-256 of the stored snapshot files as hex: the main file followed by the WAL files.
+// Deduplicated snapshots are covered by their manifest, which references the chunks of all files by their hash.
+func (p *Provider) snapshotChecksum(ctx context.Context, snapshotName string) (string, error) {
+	format, path, exists := p.findSnapshot(snapshotName)
+	if !exists {
+		return "", fmt.Errorf("snapshot with name %s does not exist", snapshotName)
+	}
+
+	paths := []string{path}
+	if format != snapshotFormatDeduplicated {
+		for _, suffix := range walFileSuffixes {
+			walPath := p.snapshotPath(snapshotName) + suffix
+			if format == snapshotFormatCompressed {
+				walPath += compressedFileExtension
+			}
+			paths = append(paths, walPath)
+		}
+	}
+
+	hash := sha256.New()
+	for i, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			// WAL files are only stored if the database had them
+			if i > 0 && os.IsNotExist(err) {
+				continue
+			}
+			return "", err
+		}
+		_, err = io.Copy(hash, contextReader(ctx, file))
+		file.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Every chunk is stored under the hash of its content, so missing or damaged chunks can be found without a checksum
+func (p *Provider) verifyChunks(ctx context.Context, snapshotName string) ([]string, error) {
+	manifest, err := readChunkManifest(p.snapshotManifestPath(snapshotName))
+	if err != nil {
+		return nil, err
+	}
+
+	store := p.chunkStore()
+	defer store.close()
+
+	var problems []string
+	checked := make(map[string]bool)
+	for _, entry := range manifest.Files {
+		for _, hash := range entry.Chunks {
+			if checked[hash] {
+				continue
+			}
+			checked[hash] = true
+
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			chunk, err := store.get(hash)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("chunk %s can't be read: %v", hash, err))
+				continue
+			}
+			if sum := sha256.Sum256(chunk); hex.EncodeToString(sum[:]) != hash {
+				problems = append(problems, fmt.Sprintf("chunk %s is damaged", hash))
+			}
+		}
+	}
+	return problems, nil
+}
+
+// Checks the database the snapshot restores to. Lunar is built without cgo, so PRAGMA integrity_check
+// is run with the sqlite3 command line tool and skipped if it isn't installed.
+func (p *Provider) checkIntegrity(ctx context.Context, snapshotName string) ([]string, error) {
+	tempFile, err := os.CreateTemp(p.config.SnapshotDirectory, ".lunar_verify_*.db")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	tempPath := tempFile.Name()
+	tempFile.Close()
+	defer p.removeDatabaseFiles(tempPath)
+
+	if err := p.materializeSnapshot(ctx, snapshotName, tempPath); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return []string{fmt.Sprintf("the snapshot can't be read: %v", err)}, nil
+	}
+
+	problems := checkDatabaseHeader(tempPath)
+	if len(problems) > 0 {
+		return problems, nil
+	}
+
+	sqlite3, err := exec.LookPath("sqlite3")
+	if err != nil {
+		return nil, nil
+	}
+
+	out, err := exec.CommandContext(ctx, sqlite3, "-readonly", tempPath, "PRAGMA integrity_check;").CombinedOutput()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return []string{fmt.Sprintf("integrity check failed: %s", strings.TrimSpace(string(out)))}, nil
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "ok" {
+			problems = append(problems, "integrity check: "+line)
+		}
+	}
+	return problems, nil
+}
+
+// Detects truncated databases with the database size in the header. It is only
+// valid if the "version-valid-for" number matches the change counter.
+func checkDatabaseHeader(path string) []string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return []string{fmt.Sprintf("the snapshot can't be read: %v", err)}
+	}
+	// An empty file is a valid, empty database
+	if info.Size() == 0 {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return []string{fmt.Sprintf("the snapshot can't be read: %v", err)}
+	}
+	defer file.Close()
+
+	header := make([]byte, 100)
+	if _, err := io.ReadFull(file, header); err != nil || string(header[:16]) != "SQLite format 3\x00" {
+		return []string{"the snapshot is not a SQLite database"}
+	}
+
+	changeCounter := binary.BigEndian.Uint32(header[24:28])
+	pageCount := int64(binary.BigEndian.Uint32(header[28:32]))
+	versionValidFor := binary.BigEndian.Uint32(header[92:96])
+	if changeCounter != versionValidFor || pageCount == 0 {
+		return nil
+	}
+
+	expectedSize := pageCount * int64(sqlitePageSize(path))
+	if info.Size() < expectedSize {
+		return []string{fmt.Sprintf("the database is truncated: %d of %d bytes", info.Size(), expectedSize)}
+	}
+	return nil
+}
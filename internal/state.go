@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Overrides the directory where Lunar keeps its state, mainly useful for tests and CI
+const STATE_DIR_ENV = "LUNAR_STATE_DIR"
+
+// Returns the directory where Lunar keeps state that doesn't belong into the project,
+// like background jobs. Every project (lunar.yml) gets its own directory below
+// $XDG_STATE_HOME/lunar (defaulting to ~/.local/state/lunar).
+func (c *Config) StateDir() (string, error) {
+	if dir := os.Getenv(STATE_DIR_ENV); dir != "" {
+		return dir, nil
+	}
+
+	baseDir := os.Getenv("XDG_STATE_HOME")
+	if baseDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not determine state directory: %v", err)
+		}
+		baseDir = filepath.Join(homeDir, ".local", "state")
+	}
+
+	return filepath.Join(baseDir, "lunar", c.projectKey()), nil
+}
+
+// Identifies the project by the location of its config file,
+// while keeping the directory name recognizable
+func (c *Config) projectKey() string {
+	configPath := c.configPath
+	if configPath == "" {
+		configPath, _ = filepath.Abs(CONFIG_PATH)
+	}
+
+	sum := sha256.Sum256([]byte(configPath))
+	return filepath.Base(filepath.Dir(configPath)) + "-" + hex.EncodeToString(sum[:4])
+}
+
+// Remembers which snapshot a database was last restored from (or snapshotted to),
+// so that `lunar status` can tell whether it was modified since
+type DatabaseState struct {
+	Snapshot string `json:"snapshot"`
+	// "restore" or "snapshot"
+	Action string    `json:"action"`
+	At     time.Time `json:"at"`
+	// Fingerprint of the database right after the action, see Provider.DatabaseFingerprint
+	Fingerprint string `json:"fingerprint"`
+}
+
+// A past snapshot of a database, to estimate how long the next one takes
+type snapshotDuration struct {
+	Size     int64         `json:"size"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Number of past snapshots per database the estimate is based on
+const snapshotDurationHistory = 5
+
+func (c *Config) statePath(name string) (string, error) {
+	stateDir, err := c.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, name), nil
+}
+
+func (c *Config) readStateFile(name string, value any) error {
+	path, err := c.statePath(name)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", name, err)
+	}
+	return nil
+}
+
+func (c *Config) writeStateFile(name string, value any) error {
+	path, err := c.statePath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", name, err)
+	}
+
+	// Replace the file atomically, so that a concurrent `lunar status` never reads half of it
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	return nil
+}
+
+// Returns nil if nothing was recorded for the database yet
+func (c *Config) ReadDatabaseState(database string) (*DatabaseState, error) {
+	states := make(map[string]DatabaseState)
+	if err := c.readStateFile("databases.json", &states); err != nil {
+		return nil, err
+	}
+	if state, found := states[database]; found {
+		return &state, nil
+	}
+	return nil, nil
+}
+
+func (c *Config) WriteDatabaseState(database string, state DatabaseState) error {
+	states := make(map[string]DatabaseState)
+	if err := c.readStateFile("databases.json", &states); err != nil {
+		return err
+	}
+	states[database] = state
+	return c.writeStateFile("databases.json", states)
+}
+
+func (c *Config) RecordSnapshotDuration(database string, size int64, duration time.Duration) error {
+	durations := make(map[string][]snapshotDuration)
+	if err := c.readStateFile("durations.json", &durations); err != nil {
+		return err
+	}
+
+	history := append(durations[database], snapshotDuration{Size: size, Duration: duration})
+	if len(history) > snapshotDurationHistory {
+		history = history[len(history)-snapshotDurationHistory:]
+	}
+	durations[database] = history
+	return c.writeStateFile("durations.json", durations)
+}
+
+// Estimates how long a snapshot of the given size takes from the throughput of the last snapshots
+// of the database. Returns 0 if there are none.
+func (c *Config) EstimateSnapshotDuration(database string, size int64) time.Duration {
+	durations := make(map[string][]snapshotDuration)
+	if err := c.readStateFile("durations.json", &durations); err != nil {
+		return 0
+	}
+
+	var totalSize int64
+	var totalDuration time.Duration
+	for _, past := range durations[database] {
+		totalSize += past.Size
+		totalDuration += past.Duration
+	}
+	if totalDuration == 0 {
+		return 0
+	}
+	if totalSize == 0 || size == 0 {
+		return totalDuration / time.Duration(len(durations[database]))
+	}
+	return time.Duration(float64(totalDuration) * float64(size) / float64(totalSize))
+}
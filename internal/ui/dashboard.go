@@ -0,0 +1,437 @@
+package ui
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/leonvogt/lunar/internal/disk"
+)
+
+const (
+	dashboardRefreshInterval = 2 * time.Second
+	// Lines of the running (or last) action's output that are kept on screen
+	dashboardOutputLines = 8
+)
+
+// A snapshot as listed by the dashboard
+type DashboardSnapshot struct {
+	Name string
+	Age  time.Duration
+	Size int64
+	// Readiness of the copies for fast restores, e.g. "1 of 1 copies ready, preparing"
+	Copies      string
+	Description string
+}
+
+// An operation on the selected snapshot, started with Key
+type DashboardAction struct {
+	Key  string
+	Name string
+	// Asks before running the action, for actions that throw data away
+	Confirm bool
+	// Asks for a value before running the action, e.g. "New name". The value is passed to Command.
+	Prompt string
+	// Returns the command that performs the action. Its output is shown below the snapshots.
+	Command func(snapshot, input string) *exec.Cmd
+}
+
+// What the dashboard shows and does. Load and Details are called in the background,
+// Load every dashboardRefreshInterval so that the dashboard follows running jobs.
+type Dashboard struct {
+	Title string
+	// Returns the snapshots and a few lines about the database and running jobs
+	Load    func() (snapshots []DashboardSnapshot, status []string, err error)
+	Details func(snapshot string) ([]string, error)
+	Actions []DashboardAction
+}
+
+type dashboardModel struct {
+	dashboard Dashboard
+
+	snapshots []DashboardSnapshot
+	status    []string
+	loadErr   error
+	loading   bool
+
+	cursor     int
+	details    []string
+	detailsErr error
+
+	confirming *DashboardAction
+	// The action that asks for a value and the value typed so far
+	prompting *DashboardAction
+	input     string
+	// The action that runs and the snapshot it runs on
+	running         *DashboardAction
+	runningSnapshot string
+	output          []string
+	message         string
+
+	height int
+}
+
+type dashboardLoadedMsg struct {
+	snapshots []DashboardSnapshot
+	status    []string
+	err       error
+}
+
+type dashboardDetailsMsg struct {
+	snapshot string
+	lines    []string
+	err      error
+}
+
+type dashboardTickMsg time.Time
+
+type actionOutputMsg struct {
+	line   string
+	lines  chan string
+	result chan error
+}
+
+type actionDoneMsg struct {
+	err error
+}
+
+// Runs the dashboard until it's closed with q or the context is cancelled
+func RunDashboard(ctx context.Context, dashboard Dashboard) error {
+	m := &dashboardModel{dashboard: dashboard, loading: true}
+	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx), tea.WithoutSignalHandler())
+	_, err := p.Run()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (m *dashboardModel) Init() tea.Cmd {
+	return tea.Batch(m.load(), dashboardTick())
+}
+
+func dashboardTick() tea.Cmd {
+	return tea.Tick(dashboardRefreshInterval, func(t time.Time) tea.Msg {
+		return dashboardTickMsg(t)
+	})
+}
+
+func (m *dashboardModel) load() tea.Cmd {
+	m.loading = true
+	return func() tea.Msg {
+		snapshots, status, err := m.dashboard.Load()
+		return dashboardLoadedMsg{snapshots: snapshots, status: status, err: err}
+	}
+}
+
+func (m *dashboardModel) loadDetails() tea.Cmd {
+	snapshot := m.selected()
+	if snapshot == "" {
+		m.details, m.detailsErr = nil, nil
+		return nil
+	}
+	return func() tea.Msg {
+		lines, err := m.dashboard.Details(snapshot)
+		return dashboardDetailsMsg{snapshot: snapshot, lines: lines, err: err}
+	}
+}
+
+func (m *dashboardModel) selected() string {
+	if m.cursor < len(m.snapshots) {
+		return m.snapshots[m.cursor].Name
+	}
+	return ""
+}
+
+func (m *dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.prompting != nil {
+			return m, m.handleInput(msg)
+		}
+		return m, m.handleKey(msg.String())
+
+	case dashboardTickMsg:
+		if m.loading {
+			return m, dashboardTick()
+		}
+		return m, tea.Batch(m.load(), dashboardTick())
+
+	case dashboardLoadedMsg:
+		m.loading = false
+		m.loadErr = msg.err
+		if msg.err != nil {
+			return m, nil
+		}
+
+		// Keep the selection on the same snapshot when snapshots come or go
+		selected := m.selected()
+		m.snapshots, m.status = msg.snapshots, msg.status
+		m.cursor = min(m.cursor, max(len(m.snapshots)-1, 0))
+		for i, snapshot := range m.snapshots {
+			if snapshot.Name == selected {
+				m.cursor = i
+			}
+		}
+		return m, m.loadDetails()
+
+	case dashboardDetailsMsg:
+		if msg.snapshot == m.selected() {
+			m.details, m.detailsErr = msg.lines, msg.err
+		}
+		return m, nil
+
+	case actionOutputMsg:
+		m.output = append(m.output, msg.line)
+		if len(m.output) > dashboardOutputLines {
+			m.output = m.output[len(m.output)-dashboardOutputLines:]
+		}
+		return m, waitForActionOutput(msg.lines, msg.result)
+
+	case actionDoneMsg:
+		if msg.err != nil {
+			m.message = fmt.Sprintf("%s of %s failed: %v", m.running.Name, m.runningSnapshot, msg.err)
+		} else {
+			m.message = fmt.Sprintf("%s of %s finished", m.running.Name, m.runningSnapshot)
+		}
+		m.running = nil
+		return m, m.load()
+
+	default:
+		return m, nil
+	}
+}
+
+func (m *dashboardModel) handleKey(key string) tea.Cmd {
+	if m.confirming != nil {
+		action := m.confirming
+		m.confirming = nil
+		if key == "y" || key == "Y" {
+			return m.startAction(action, m.selected(), "")
+		}
+		m.message = action.Name + " cancelled"
+		return nil
+	}
+
+	switch key {
+	case "q", "esc", "ctrl+c":
+		// Stopping halfway would leave the snapshot to the cleanup of the interrupted command
+		if m.running != nil {
+			m.message = fmt.Sprintf("Waiting for %s to finish before quitting is possible", m.running.Name)
+			return nil
+		}
+		return tea.Quit
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+			return m.loadDetails()
+		}
+		return nil
+	case "down", "j":
+		if m.cursor < len(m.snapshots)-1 {
+			m.cursor++
+			return m.loadDetails()
+		}
+		return nil
+	}
+
+	for i := range m.dashboard.Actions {
+		action := &m.dashboard.Actions[i]
+		if action.Key != key || m.selected() == "" {
+			continue
+		}
+		if m.running != nil {
+			m.message = fmt.Sprintf("Wait for %s to finish first", m.running.Name)
+			return nil
+		}
+		if action.Confirm {
+			m.confirming = action
+			return nil
+		}
+		if action.Prompt != "" {
+			m.prompting, m.input = action, ""
+			return nil
+		}
+		return m.startAction(action, m.selected(), "")
+	}
+	return nil
+}
+
+// Edits the value the prompting action asks for. Enter runs the action, Esc cancels it.
+func (m *dashboardModel) handleInput(msg tea.KeyMsg) tea.Cmd {
+	action := m.prompting
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.prompting = nil
+		if m.input == "" {
+			m.message = action.Name + " cancelled"
+			return nil
+		}
+		return m.startAction(action, m.selected(), m.input)
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.prompting = nil
+		m.message = action.Name + " cancelled"
+	case tea.KeyBackspace:
+		if runes := []rune(m.input); len(runes) > 0 {
+			m.input = string(runes[:len(runes)-1])
+		}
+	case tea.KeySpace:
+		m.input += " "
+	case tea.KeyRunes:
+		m.input += string(msg.Runes)
+	}
+	return nil
+}
+
+// Starts the command of the action and streams its output into the dashboard line by line
+func (m *dashboardModel) startAction(action *DashboardAction, snapshot, input string) tea.Cmd {
+	command := action.Command(snapshot, input)
+	reader, writer := io.Pipe()
+	command.Stdout = writer
+	command.Stderr = writer
+
+	m.output = nil
+	m.message = ""
+	if err := command.Start(); err != nil {
+		m.message = fmt.Sprintf("%s of %s failed: %v", action.Name, snapshot, err)
+		return nil
+	}
+	m.running, m.runningSnapshot = action, snapshot
+
+	lines := make(chan string)
+	result := make(chan error, 1)
+	go func() {
+		err := command.Wait()
+		writer.Close()
+		result <- err
+	}()
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		// Drain overlong lines too, the command would block on a full pipe otherwise
+		io.Copy(io.Discard, reader)
+	}()
+
+	return waitForActionOutput(lines, result)
+}
+
+func waitForActionOutput(lines chan string, result chan error) tea.Cmd {
+	return func() tea.Msg {
+		line, ok := <-lines
+		if !ok {
+			return actionDoneMsg{err: <-result}
+		}
+		return actionOutputMsg{line: line, lines: lines, result: result}
+	}
+}
+
+func (m *dashboardModel) View() string {
+	var view strings.Builder
+	fmt.Fprintf(&view, "%s\n\n", m.dashboard.Title)
+
+	switch {
+	case m.loadErr != nil:
+		fmt.Fprintf(&view, "  %v\n", m.loadErr)
+	case m.loading && m.snapshots == nil:
+		view.WriteString("  Loading snapshots...\n")
+	case len(m.snapshots) == 0:
+		view.WriteString("  No snapshots yet, create one with `lunar snapshot <name>`\n")
+	default:
+		m.renderSnapshots(&view)
+	}
+
+	if name := m.selected(); name != "" {
+		fmt.Fprintf(&view, "\n── %s ──\n", name)
+		if m.detailsErr != nil {
+			fmt.Fprintf(&view, "%v\n", m.detailsErr)
+		}
+		for _, line := range m.details {
+			fmt.Fprintln(&view, line)
+		}
+	}
+
+	if len(m.status) > 0 {
+		view.WriteString("\n")
+		for _, line := range m.status {
+			fmt.Fprintln(&view, line)
+		}
+	}
+
+	if len(m.output) > 0 || m.running != nil {
+		view.WriteString("\n")
+		for _, line := range m.output {
+			fmt.Fprintf(&view, "  %s\n", line)
+		}
+	}
+	if m.message != "" {
+		fmt.Fprintf(&view, "\n%s\n", m.message)
+	}
+
+	view.WriteString("\n")
+	switch {
+	case m.confirming != nil:
+		fmt.Fprintf(&view, "%s snapshot %s? (y/N)", capitalize(m.confirming.Name), m.selected())
+	case m.prompting != nil:
+		fmt.Fprintf(&view, "%s for %s (Enter to %s, Esc to cancel): %s_", m.prompting.Prompt, m.selected(), m.prompting.Name, m.input)
+	case m.running != nil:
+		fmt.Fprintf(&view, "Running %s...", m.running.Name)
+	default:
+		view.WriteString(m.help())
+	}
+	return view.String()
+}
+
+func (m *dashboardModel) renderSnapshots(view *strings.Builder) {
+	nameWidth, copiesWidth := len("NAME"), len("COPIES")
+	for _, snapshot := range m.snapshots {
+		nameWidth = max(nameWidth, len(snapshot.Name))
+		copiesWidth = max(copiesWidth, len(snapshot.Copies))
+	}
+
+	// Scroll the list so that the selected snapshot stays visible, leaving room for the other panes
+	visible := len(m.snapshots)
+	if m.height > 0 {
+		visible = min(visible, max(m.height-25, 3))
+	}
+	first := max(m.cursor-visible+1, 0)
+
+	fmt.Fprintf(view, "  %-*s  %-14s  %-10s  %-*s  %s\n", nameWidth, "NAME", "AGE", "SIZE", copiesWidth, "COPIES", "DESCRIPTION")
+	for i := first; i < first+visible && i < len(m.snapshots); i++ {
+		snapshot := m.snapshots[i]
+		marker := " "
+		if i == m.cursor {
+			marker = ">"
+		}
+		fmt.Fprintf(view, "%s %-*s  %-14s  %-10s  %-*s  %s\n", marker, nameWidth, snapshot.Name, FormatAge(snapshot.Age), disk.FormatBytes(snapshot.Size), copiesWidth, snapshot.Copies, snapshot.Description)
+	}
+	if hidden := len(m.snapshots) - visible; hidden > 0 {
+		fmt.Fprintf(view, "  (%d of %d snapshots shown)\n", visible, len(m.snapshots))
+	}
+}
+
+func (m *dashboardModel) help() string {
+	keys := []string{"↑/↓ select"}
+	for _, action := range m.dashboard.Actions {
+		keys = append(keys, action.Key+" "+action.Name)
+	}
+	return strings.Join(append(keys, "q quit"), "  ")
+}
+
+func capitalize(text string) string {
+	if text == "" {
+		return text
+	}
+	return strings.ToUpper(text[:1]) + text[1:]
+}
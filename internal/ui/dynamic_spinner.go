@@ -2,30 +2,44 @@ package ui
 
 import (
 	"fmt"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/leonvogt/lunar/internal/disk"
 )
 
+const progressBarWidth = 20
+
+// How often the progress is logged when there is no terminal to redraw a spinner on
+const progressLogInterval = 10 * time.Second
+
 type dynamicSpinnerModel struct {
 	spinner   spinner.Model
 	quitting  bool
 	message   string
-	info      string
 	startTime time.Time
+	// Bytes the operation copies, 0 if unknown
+	total int64
+	// Bytes copied so far, updated by the operation while the spinner renders
+	copied atomic.Int64
+	// How long the operation is expected to take, 0 if unknown
+	expected time.Duration
 }
 
-type infoUpdateMsg string
 type elapsedTickMsg time.Time
 
-func newDynamicSpinnerModel(message string) *dynamicSpinnerModel {
+func newDynamicSpinnerModel(message string, total int64, expected time.Duration) *dynamicSpinnerModel {
 	s := spinner.New()
 	s.Spinner = spinner.Moon
 	return &dynamicSpinnerModel{
 		spinner:   s,
 		message:   message,
 		startTime: time.Now(),
+		total:     total,
+		expected:  expected,
 	}
 }
 
@@ -42,6 +56,9 @@ func (m *dynamicSpinnerModel) Init() tea.Cmd {
 func (m *dynamicSpinnerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			interrupt()
+		}
 		return m, nil
 
 	case spinner.TickMsg:
@@ -49,10 +66,6 @@ func (m *dynamicSpinnerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.spinner, cmd = m.spinner.Update(msg)
 		return m, cmd
 
-	case infoUpdateMsg:
-		m.info = string(msg)
-		return m, nil
-
 	case elapsedTickMsg:
 		return m, elapsedTickCmd()
 
@@ -69,12 +82,55 @@ func (m *dynamicSpinnerModel) View() string {
 	elapsed := time.Since(m.startTime).Round(time.Second)
 	elapsedStr := formatDuration(elapsed)
 
-	if m.info != "" {
-		return fmt.Sprintf("\n\n   %s %s (%s) %s\n\n", m.spinner.View(), m.message, m.info, elapsedStr)
+	if progress := m.progress(true); progress != "" {
+		return fmt.Sprintf("\n\n   %s %s %s %s\n\n", m.spinner.View(), m.message, progress, elapsedStr)
 	}
 	return fmt.Sprintf("\n\n   %s %s %s\n\n", m.spinner.View(), m.message, elapsedStr)
 }
 
+// Renders the progress (with a bar if withBar is set), throughput and ETA. Until the operation
+// reports progress (some copies can't), the progress and the ETA follow the expected duration.
+func (m *dynamicSpinnerModel) progress(withBar bool) string {
+	if m.total <= 0 {
+		return ""
+	}
+
+	elapsed := time.Since(m.startTime)
+	copied := min(m.copied.Load(), m.total)
+
+	var fraction float64
+	var details []string
+	switch {
+	case copied > 0:
+		fraction = float64(copied) / float64(m.total)
+		details = append(details, fmt.Sprintf("%s / %s", disk.FormatBytes(copied), disk.FormatBytes(m.total)))
+		if seconds := elapsed.Seconds(); seconds >= 1 {
+			throughput := float64(copied) / seconds
+			details = append(details, disk.FormatBytes(int64(throughput))+"/s")
+			if copied < m.total {
+				remaining := time.Duration(float64(m.total-copied) / throughput * float64(time.Second))
+				details = append(details, "ETA "+FormatDuration(remaining))
+			}
+		}
+	case m.expected > 0:
+		fraction = min(elapsed.Seconds()/m.expected.Seconds(), 0.99)
+		details = append(details, disk.FormatBytes(m.total))
+		if remaining := m.expected - elapsed; remaining > 0 {
+			details = append(details, "ETA ~"+FormatDuration(remaining)+" based on previous snapshots")
+		}
+	default:
+		return disk.FormatBytes(m.total)
+	}
+
+	percent := fmt.Sprintf("%3.0f%%  %s", fraction*100, strings.Join(details, ", "))
+	if !withBar {
+		return percent
+	}
+	filled := int(fraction * progressBarWidth)
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", progressBarWidth-filled)
+	return bar + " " + percent
+}
+
 func formatDuration(d time.Duration) string {
 	if d < time.Minute {
 		return fmt.Sprintf("%ds elapsed", int(d.Seconds()))
@@ -84,10 +140,16 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%dm%ds elapsed", minutes, seconds)
 }
 
-// Returns an update function to set the info text, and a stop function that returns the elapsed duration.
-func StartDynamicSpinner(message string) (setInfo func(info string), stop func() time.Duration) {
-	m := newDynamicSpinnerModel(message)
-	p := tea.NewProgram(m)
+// Shows a spinner with a progress bar for an operation that copies `total` bytes (0 if unknown).
+// `expected` is how long the operation is expected to take (0 if unknown) and estimates the progress
+// until the operation reports any. Returns a function to add the bytes copied, and a stop function
+// that returns the elapsed duration.
+func StartProgressSpinner(message string, total int64, expected time.Duration) (addProgress func(bytes int64), stop func() time.Duration) {
+	m := newDynamicSpinnerModel(message, total, expected)
+	if quiet || !isInteractive() {
+		return m.logProgress()
+	}
+	p := tea.NewProgram(m, tea.WithoutSignalHandler())
 
 	done := make(chan bool)
 	go func() {
@@ -97,8 +159,9 @@ func StartDynamicSpinner(message string) (setInfo func(info string), stop func()
 		p.Run()
 	}()
 
-	setInfo = func(info string) {
-		p.Send(infoUpdateMsg(info))
+	// The spinner re-renders on its own, so progress is only counted here
+	addProgress = func(bytes int64) {
+		m.copied.Add(bytes)
 	}
 
 	stop = func() time.Duration {
@@ -110,5 +173,50 @@ func StartDynamicSpinner(message string) (setInfo func(info string), stop func()
 		return elapsed
 	}
 
-	return setInfo, stop
+	return addProgress, stop
+}
+
+// Prints the message and then the progress every progressLogInterval, one line at a time,
+// for logs that can't handle a redrawn spinner. With --quiet nothing is printed.
+func (m *dynamicSpinnerModel) logProgress() (addProgress func(bytes int64), stop func() time.Duration) {
+	addProgress = func(bytes int64) {
+		m.copied.Add(bytes)
+	}
+	if quiet {
+		return addProgress, func() time.Duration {
+			return time.Since(m.startTime)
+		}
+	}
+
+	fmt.Println(m.message)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(progressLogInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				elapsed := formatDuration(time.Since(m.startTime).Round(time.Second))
+				if progress := m.progress(false); progress != "" {
+					fmt.Printf("   %s (%s)\n", progress, elapsed)
+				} else {
+					fmt.Printf("   %s\n", elapsed)
+				}
+			}
+		}
+	}()
+
+	stop = func() time.Duration {
+		elapsed := time.Since(m.startTime)
+		close(done)
+		<-stopped
+		return elapsed
+	}
+	return addProgress, stop
 }
@@ -5,23 +5,6 @@ import (
 	"time"
 )
 
-func FormatBytes(bytes int64) string {
-	if bytes < 1024 {
-		return fmt.Sprintf("%d B", bytes)
-	}
-
-	units := []string{"KB", "MB", "GB", "TB", "PB"}
-	value := float64(bytes)
-	for _, unit := range units {
-		value = value / 1024
-		if value < 1024 {
-			return fmt.Sprintf("%.1f %s", value, unit)
-		}
-	}
-
-	return fmt.Sprintf("%.1f PB", value)
-}
-
 func FormatDuration(d time.Duration) string {
 	d = d.Round(time.Millisecond * 100)
 
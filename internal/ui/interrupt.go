@@ -0,0 +1,26 @@
+package ui
+
+import "sync"
+
+var (
+	interruptMutex   sync.Mutex
+	interruptHandler func()
+)
+
+// Registers the function that is called when Ctrl-C is pressed while a spinner is shown.
+// Spinners put the terminal into raw mode, so Ctrl-C doesn't send a signal in that case.
+func SetInterruptHandler(handler func()) {
+	interruptMutex.Lock()
+	defer interruptMutex.Unlock()
+	interruptHandler = handler
+}
+
+func interrupt() {
+	interruptMutex.Lock()
+	handler := interruptHandler
+	interruptMutex.Unlock()
+
+	if handler != nil {
+		handler()
+	}
+}
@@ -31,6 +31,9 @@ func (m *spinnerModel) Init() tea.Cmd {
 func (m *spinnerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			interrupt()
+		}
 		return m, nil
 
 	case spinner.TickMsg:
@@ -51,9 +54,19 @@ func (m *spinnerModel) View() string {
 	return fmt.Sprintf("\n\n   %s %s\n\n", m.spinner.View(), m.message)
 }
 
+// Shows a spinner until the returned function is called. Without a terminal the message is
+// printed once instead, with --quiet nothing is shown.
 func StartSpinner(message string) func() {
+	if quiet {
+		return func() {}
+	}
+	if !isInteractive() {
+		fmt.Println(message)
+		return func() {}
+	}
+
 	m := newSpinnerModel(message)
-	p := tea.NewProgram(m)
+	p := tea.NewProgram(m, tea.WithoutSignalHandler())
 
 	// Channel to wait for the program to finish
 	done := make(chan bool)
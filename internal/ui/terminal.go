@@ -0,0 +1,49 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
+)
+
+var (
+	quiet   bool
+	noInput bool
+)
+
+// Applies the --quiet and --no-input flags. With quiet, spinners and progress output are left out.
+// With noInput, prompts fail instead of waiting for an answer.
+func Configure(quietFlag, noInputFlag bool) {
+	quiet = quietFlag
+	noInput = noInputFlag
+}
+
+// Spinners redraw their line with control sequences, which only makes sense on a terminal.
+// Elsewhere (CI logs, background jobs, pipes) progress is logged line by line.
+func isInteractive() bool {
+	return isTerminal(os.Stdout) && os.Getenv("TERM") != "dumb"
+}
+
+func isTerminal(file *os.File) bool {
+	return term.IsTerminal(int(file.Fd()))
+}
+
+// Returns why the user can't be prompted, or nil if prompting is possible.
+// Callers add how to pass the value without a prompt.
+func CheckPromptable() error {
+	if noInput {
+		return fmt.Errorf("--no-input is set")
+	}
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return fmt.Errorf("not running in a terminal")
+	}
+	return nil
+}
+
+// The color profile for prompts. promptkit renders with true color unless told otherwise;
+// this respects NO_COLOR and terminals without color support.
+func PromptColorProfile() termenv.Profile {
+	return termenv.EnvColorProfile()
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// ============================================================================
+// PostgreSQL Describe Tests
+// ============================================================================
+
+func TestPostgres_Describe(t *testing.T) {
+	const snapshotName = "pg-describe-test"
+	const description = "before the billing migration"
+
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		out, err := RunLunarCommand("snapshot " + snapshotName + " --description 'seed data'")
+		if err != nil {
+			t.Fatalf("Error creating snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("list")
+		if err != nil || !strings.Contains(string(out), "DESCRIPTION") || !strings.Contains(string(out), "seed data") {
+			t.Errorf("Expected the description of --description to be listed: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("describe " + snapshotName + " '" + description + "'")
+		if err != nil || !strings.Contains(string(out), "described") {
+			t.Fatalf("Error describing snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		// The description is kept by replace and rename
+		out, err = RunLunarCommand("replace " + snapshotName)
+		if err != nil {
+			t.Fatalf("Error replacing snapshot: %v\nOutput: %s", err, string(out))
+		}
+		out, err = RunLunarCommand("rename " + snapshotName + " pg-described-test")
+		if err != nil {
+			t.Fatalf("Error renaming snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("info pg-described-test")
+		if err != nil || !strings.Contains(string(out), description) {
+			t.Errorf("Expected the description to be kept: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("describe pg-described-test ''")
+		if err != nil || !strings.Contains(string(out), "removed") {
+			t.Errorf("Error removing the description: %v\nOutput: %s", err, string(out))
+		}
+		out, err = RunLunarCommand("list")
+		if err != nil || strings.Contains(string(out), description) {
+			t.Errorf("Expected the description to be removed: %v\nOutput: %s", err, string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSnapshot("pg-described-test")
+	})
+}
+
+// ============================================================================
+// SQLite Describe Tests
+// ============================================================================
+
+func TestSQLite_Describe(t *testing.T) {
+	const snapshotName = "sqlite-describe-test"
+	const description = "before the billing migration"
+
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		out, err := RunLunarCommand("snapshot " + snapshotName + " --description 'seed data'")
+		if err != nil {
+			t.Fatalf("Error creating snapshot: %v\nOutput: %s", err, string(out))
+		}
+		WaitForSQLiteSnapshotCopies(t, snapshotName, 1)
+
+		out, err = RunLunarCommand("list")
+		if err != nil || !strings.Contains(string(out), "DESCRIPTION") || !strings.Contains(string(out), "seed data") {
+			t.Errorf("Expected the description of --description to be listed: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("describe " + snapshotName + " '" + description + "'")
+		if err != nil || !strings.Contains(string(out), "described") {
+			t.Fatalf("Error describing snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		// The description is kept by replace and rename
+		out, err = RunLunarCommand("replace " + snapshotName)
+		if err != nil {
+			t.Fatalf("Error replacing snapshot: %v\nOutput: %s", err, string(out))
+		}
+		out, err = RunLunarCommand("rename " + snapshotName + " sqlite-described-test")
+		if err != nil {
+			t.Fatalf("Error renaming snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("info sqlite-described-test")
+		if err != nil || !strings.Contains(string(out), description) {
+			t.Errorf("Expected the description to be kept: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("describe sqlite-described-test ''")
+		if err != nil || !strings.Contains(string(out), "removed") {
+			t.Errorf("Error removing the description: %v\nOutput: %s", err, string(out))
+		}
+		out, err = RunLunarCommand("list")
+		if err != nil || strings.Contains(string(out), description) {
+			t.Errorf("Expected the description to be removed: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("describe missing-snapshot 'nothing'")
+		if err == nil || !strings.Contains(string(out), "does not exist") {
+			t.Errorf("Expected describing a missing snapshot to fail\nOutput: %s", string(out))
+		}
+
+		CleanupSQLiteSnapshot("sqlite-described-test")
+	})
+}
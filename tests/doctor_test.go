@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/leonvogt/lunar/internal"
+)
+
+// ============================================================================
+// PostgreSQL Doctor Tests
+// ============================================================================
+
+func TestPostgres_Doctor(t *testing.T) {
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		out, err := RunLunarCommand("doctor")
+		if err != nil {
+			t.Errorf("Expected doctor to pass: %v\nOutput: %s", err, string(out))
+		}
+		for _, expected := range []string{"[ok]       Connection to postgres", "[ok]       Privileges", "[ok]       Database: lunar_test exists", "[ok]       pg_stat_file"} {
+			if !strings.Contains(string(out), expected) {
+				t.Errorf("Expected doctor to report '%s' but got '%s'", expected, string(out))
+			}
+		}
+	})
+}
+
+// ============================================================================
+// SQLite Doctor Tests
+// ============================================================================
+
+func TestSQLite_Doctor(t *testing.T) {
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		out, err := RunLunarCommand("doctor")
+		if err != nil || !strings.Contains(string(out), "No problems found") {
+			t.Errorf("Expected doctor to pass: %v\nOutput: %s", err, string(out))
+		}
+		for _, expected := range []string{"Snapshot directory", "File locking", "Disk space", "State directory"} {
+			if !strings.Contains(string(out), expected) {
+				t.Errorf("Expected doctor to check '%s' but got '%s'", expected, string(out))
+			}
+		}
+
+		hookConfig := *config
+		hookConfig.AfterRestoreCommand = "./missing-hook.sh"
+		if err := internal.CreateConfigFile(&hookConfig, "lunar.yml"); err != nil {
+			t.Fatalf("Failed to create config file with hook: %v", err)
+		}
+
+		out, err = RunLunarCommand("doctor")
+		if err == nil {
+			t.Errorf("Expected doctor to fail for a missing hook command\nOutput: %s", string(out))
+		}
+		if !strings.Contains(string(out), "[failed]   after_restore_command: ./missing-hook.sh was not found") || !strings.Contains(string(out), "Fix:") {
+			t.Errorf("Expected doctor to report the missing hook command but got '%s'", string(out))
+		}
+	})
+}
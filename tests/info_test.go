@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/leonvogt/lunar/internal"
+)
+
+// ============================================================================
+// PostgreSQL Info Tests
+// ============================================================================
+
+func TestPostgres_Info(t *testing.T) {
+	const snapshotName = "pg-info-test"
+
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		CreateTestSnapshot(t, snapshotName)
+
+		out, err := RunLunarCommand("info")
+		if err != nil {
+			t.Errorf("Error running info command: %v\nOutput: %s", err, string(out))
+		}
+		if !strings.Contains(string(out), "Server version:") {
+			t.Errorf("Expected output to contain the server version but got '%s'", string(out))
+		}
+
+		out, err = RunLunarCommand("info " + snapshotName)
+		if err != nil {
+			t.Errorf("Error running info command: %v\nOutput: %s", err, string(out))
+		}
+		if !strings.Contains(string(out), "Snapshot database:  "+SnapshotDatabaseName(snapshotName)) {
+			t.Errorf("Expected output to contain the snapshot database but got '%s'", string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSnapshot(snapshotName)
+	})
+}
+
+func TestPostgres_InfoShowsCreateStrategy(t *testing.T) {
+	const snapshotName = "pg-strategy-test"
+
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		strategyConfig := *testConfig
+		strategyConfig.CreateStrategy = "file_copy"
+		strategyConfig.SnapshotTablespace = "pg_default"
+		if err := internal.CreateConfigFile(&strategyConfig, "lunar.yml"); err != nil {
+			t.Fatalf("Failed to create config file with create strategy: %v", err)
+		}
+
+		CreateTestSnapshot(t, snapshotName)
+
+		out, err := RunLunarCommand("info " + snapshotName)
+		if err != nil {
+			t.Errorf("Error running info command: %v\nOutput: %s", err, string(out))
+		}
+		if !strings.Contains(string(out), "(FILE_COPY)") {
+			t.Errorf("Expected output to contain the create strategy but got '%s'", string(out))
+		}
+		if !strings.Contains(string(out), "pg_default") {
+			t.Errorf("Expected output to contain the tablespace but got '%s'", string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSnapshot(snapshotName)
+	})
+}
+
+// ============================================================================
+// SQLite Info Tests
+// ============================================================================
+
+func TestSQLite_Info(t *testing.T) {
+	const snapshotName = "sqlite-info-test"
+
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		CreateTestSnapshot(t, snapshotName)
+
+		out, err := RunLunarCommand("info")
+		if err != nil {
+			t.Errorf("Error running info command: %v\nOutput: %s", err, string(out))
+		}
+		if !strings.Contains(string(out), "Snapshots:           1") {
+			t.Errorf("Expected output to contain the snapshot count but got '%s'", string(out))
+		}
+
+		out, err = RunLunarCommand("info " + snapshotName)
+		if err != nil {
+			t.Errorf("Error running info command: %v\nOutput: %s", err, string(out))
+		}
+		if !strings.Contains(string(out), "Copy strategy:") || strings.Contains(string(out), "Copy strategy:      unknown") {
+			t.Errorf("Expected output to contain the copy strategy but got '%s'", string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSQLiteSnapshot(snapshotName)
+	})
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leonvogt/lunar/internal"
+)
+
+// Polls `lunar jobs` until the output contains the expected text
+func WaitForJobsOutput(t *testing.T, expected string) string {
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		out, err := RunLunarCommand("jobs")
+		if err != nil {
+			t.Fatalf("Error running jobs command: %v", err)
+		}
+		if strings.Contains(string(out), expected) {
+			return string(out)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected jobs output to contain '%s' but got '%s'", expected, string(out))
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func TestSQLite_Jobs(t *testing.T) {
+	const snapshotName = "sqlite-jobs-test"
+
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		CreateTestSnapshot(t, snapshotName)
+
+		out := WaitForJobsOutput(t, "succeeded")
+		if !strings.Contains(out, "create-copy") || !strings.Contains(out, snapshotName) {
+			t.Errorf("Expected the create-copy job for `%s` to be listed but got '%s'", snapshotName, out)
+		}
+		jobID := strings.Fields(strings.Split(out, "\n")[1])[0]
+
+		// Retrying the job for a removed snapshot makes it fail
+		if out, err := RunLunarCommand("remove " + snapshotName); err != nil {
+			t.Fatalf("Error removing snapshot: %v\nOutput: %s", err, string(out))
+		}
+		if out, err := RunLunarCommand("jobs retry " + jobID); err != nil || !strings.Contains(string(out), "Started job") {
+			t.Fatalf("Error retrying job: %v\nOutput: %s", err, string(out))
+		}
+		WaitForJobsOutput(t, "failed")
+
+		out2, err := RunLunarCommand("list")
+		if err != nil {
+			t.Errorf("Error running list command: %v", err)
+		}
+		if !strings.Contains(string(out2), "Warning: Background job") {
+			t.Errorf("Expected a warning about the failed job but got '%s'", string(out2))
+		}
+
+		// The failure is only reported once
+		out2, _ = RunLunarCommand("list")
+		if strings.Contains(string(out2), "Warning: Background job") {
+			t.Errorf("Expected the failed job to be reported only once but got '%s'", string(out2))
+		}
+	})
+}
+
+func TestSQLite_JobWithoutProcess(t *testing.T) {
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		// Left behind by a Lunar process that died between recording the job and starting its process
+		jobsDirectory := filepath.Join(os.Getenv(internal.STATE_DIR_ENV), "jobs")
+		if err := os.MkdirAll(jobsDirectory, 0755); err != nil {
+			t.Fatalf("Failed to create jobs directory: %v", err)
+		}
+		job, _ := json.Marshal(map[string]interface{}{
+			"id":         "deadbeef",
+			"kind":       "create-copy",
+			"snapshot":   "sqlite-jobs-test",
+			"started_at": time.Now().Add(-time.Hour),
+			"status":     "running",
+		})
+		if err := os.WriteFile(filepath.Join(jobsDirectory, "deadbeef.json"), job, 0644); err != nil {
+			t.Fatalf("Failed to write job: %v", err)
+		}
+
+		out, err := RunLunarCommand("jobs")
+		if err != nil || !strings.Contains(string(out), "failed") {
+			t.Errorf("Expected the job without process to be failed: %v\nOutput: %s", err, string(out))
+		}
+	})
+}
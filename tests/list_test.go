@@ -2,7 +2,11 @@ package tests
 
 import (
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/leonvogt/lunar/internal"
+	"github.com/leonvogt/lunar/internal/provider/postgres"
 )
 
 func TestSnapshotList(t *testing.T) {
@@ -17,9 +21,10 @@ func TestSnapshotList(t *testing.T) {
 			t.Errorf("Error running list command: %v", err)
 		}
 
-		// Test if the output starts with "production"
-		if string(out[:10]) != "production" {
-			t.Errorf("Expected output to be 'production' but got '%s'", string(out))
+		// Test if the first row after the header starts with "production"
+		lines := strings.Split(string(out), "\n")
+		if len(lines) < 2 || !strings.HasPrefix(lines[1], "production") {
+			t.Errorf("Expected output to list 'production' but got '%s'", string(out))
 		}
 
 		// Go back to tests directory for cleanup
@@ -27,3 +32,207 @@ func TestSnapshotList(t *testing.T) {
 		CleanupSnapshot("production")
 	})
 }
+
+func TestPostgres_ListOnlyShowsOwnNamespace(t *testing.T) {
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		CreateTestSnapshot(t, "production")
+
+		otherConfig := *testConfig
+		otherConfig.Namespace = "other"
+		if err := internal.CreateConfigFile(&otherConfig, "lunar.yml"); err != nil {
+			t.Fatalf("Failed to create config file with namespace: %v", err)
+		}
+
+		out, err := RunLunarCommand("list")
+		if err != nil {
+			t.Errorf("Error running list command: %v", err)
+		}
+		if strings.Contains(string(out), "production") {
+			t.Errorf("Expected the snapshot of another namespace to be hidden but got '%s'", string(out))
+		}
+
+		// The same snapshot name can be used in another namespace
+		CreateTestSnapshot(t, "production")
+
+		os.Chdir("tests")
+		exists, err := DoesDatabaseExist("lunar_snapshot____other____lunar_test____production")
+		if err != nil {
+			t.Fatalf("Error checking database existence: %v", err)
+		}
+		if !exists {
+			t.Errorf("Expected the snapshot database of namespace `other` to exist - but it does not")
+		}
+
+		if db, err := postgres.ConnectToMaintenanceDatabaseWithURL(testConfig.DatabaseUrl); err == nil {
+			db.Exec("ALTER DATABASE lunar_snapshot____other____lunar_test____production IS_TEMPLATE false")
+			db.Exec("DROP DATABASE IF EXISTS lunar_snapshot____other____lunar_test____production")
+			db.Exec("DROP DATABASE IF EXISTS lunar_snapshot____other____lunar_test____production_copy")
+			db.Close()
+		}
+		CleanupSnapshot("production")
+	})
+}
+
+func TestPostgres_MigrateLegacySnapshots(t *testing.T) {
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		// Snapshot and copy as created by Lunar versions without namespaces
+		db, err := postgres.ConnectToMaintenanceDatabaseWithURL(testConfig.DatabaseUrl)
+		if err != nil {
+			t.Fatalf("Failed to connect to maintenance database: %v", err)
+		}
+		defer db.Close()
+		legacyNames := []string{"lunar_snapshot____lunar_test____legacy", "lunar_snapshot____lunar_test____legacy_copy"}
+		for _, name := range legacyNames {
+			if _, err := db.Exec("CREATE DATABASE " + name + " TEMPLATE lunar_test"); err != nil {
+				t.Fatalf("Failed to create legacy snapshot database: %v", err)
+			}
+		}
+
+		// Listing doesn't move the snapshots of other users of the server
+		out, err := RunLunarCommand("list")
+		if err != nil || !strings.Contains(string(out), "earlier version of Lunar: legacy\n") {
+			t.Errorf("Expected the legacy snapshot to be listed: %v\nOutput: %s", err, string(out))
+		}
+		os.Chdir("tests")
+		for _, name := range legacyNames {
+			if exists, err := DoesDatabaseExist(name); err != nil || !exists {
+				t.Errorf("Expected %s to be left alone by list: %v", name, err)
+			}
+		}
+		os.Chdir("..")
+
+		out, err = RunLunarCommand("migrate")
+		if err != nil || !strings.Contains(string(out), "Moved snapshot legacy") {
+			t.Errorf("Error migrating the legacy snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		os.Chdir("tests")
+		for _, name := range []string{SnapshotDatabaseName("legacy"), SnapshotDatabaseName("legacy") + "_copy"} {
+			if exists, err := DoesDatabaseExist(name); err != nil || !exists {
+				t.Errorf("Expected %s to exist after the migration: %v", name, err)
+			}
+		}
+		os.Chdir("..")
+
+		out, err = RunLunarCommand("restore legacy")
+		if err != nil || !strings.Contains(string(out), "restored successfully") {
+			t.Errorf("Error restoring the legacy snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSnapshot("legacy")
+	})
+}
+
+func TestPostgres_ListAllDatabases(t *testing.T) {
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		CreateTestSnapshot(t, "production")
+
+		out, err := RunLunarCommand("list --all-databases")
+		if err != nil {
+			t.Errorf("Error running list command: %v", err)
+		}
+		lines := strings.Split(string(out), "\n")
+		if len(lines) < 2 || !strings.HasPrefix(lines[0], "DATABASE") || !strings.HasPrefix(lines[1], "lunar_test") || !strings.Contains(lines[1], "production") {
+			t.Errorf("Expected the snapshot to be listed with its database but got '%s'", string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSnapshot("production")
+	})
+}
+
+func TestPostgres_ListProtection(t *testing.T) {
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		CreateTestSnapshot(t, "protected")
+		CreateTestSnapshot(t, "unprotected")
+
+		out, err := RunLunarCommand("unprotect unprotected")
+		if err != nil {
+			t.Fatalf("Error unprotecting snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("list")
+		if err != nil || !strings.Contains(strings.Split(string(out), "\n")[0], "PROTECTED") {
+			t.Errorf("Expected a PROTECTED column: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("list --protected")
+		if err != nil || !strings.Contains(string(out), "protected") || strings.Contains(string(out), "unprotected") {
+			t.Errorf("Expected only the protected snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("list --protected=false")
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		if err != nil || len(lines) != 2 || !strings.HasPrefix(lines[1], "unprotected") {
+			t.Errorf("Expected only the unprotected snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSnapshot("protected")
+		CleanupSnapshot("unprotected")
+	})
+}
+
+// ============================================================================
+// SQLite List Tests
+// ============================================================================
+
+func TestSQLite_ListSortFilterAndLimit(t *testing.T) {
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		for _, snapshotName := range []string{"beta", "alpha", "feature-1"} {
+			CreateTestSnapshot(t, snapshotName)
+		}
+
+		listed := func(arguments string) string {
+			out, err := RunLunarCommand("list " + arguments)
+			if err != nil {
+				t.Fatalf("Error running list %s: %v\nOutput: %s", arguments, err, string(out))
+			}
+
+			var names []string
+			for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n")[1:] {
+				names = append(names, strings.Fields(line)[0])
+			}
+			return strings.Join(names, ",")
+		}
+
+		for arguments, expected := range map[string]string{
+			"":                            "alpha,beta,feature-1",
+			"--reverse":                   "feature-1,beta,alpha",
+			"--sort age --reverse":        "beta,alpha,feature-1",
+			"--filter 'feature-*'":        "feature-1",
+			"--filter '/^(alpha|beta)$/'": "alpha,beta",
+			"--limit 2":                   "alpha,beta",
+		} {
+			if names := listed(arguments); names != expected {
+				t.Errorf("Expected list %s to show %s but got %s", arguments, expected, names)
+			}
+		}
+
+		out, _ := RunLunarCommand("list --protected")
+		if !strings.Contains(string(out), "only supported for PostgreSQL") {
+			t.Errorf("Expected --protected to be refused for SQLite but got '%s'", string(out))
+		}
+
+		os.Chdir("tests")
+		for _, snapshotName := range []string{"beta", "alpha", "feature-1"} {
+			CleanupSQLiteSnapshot(snapshotName)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// ============================================================================
+// PostgreSQL Rename Tests
+// ============================================================================
+
+func TestPostgres_Rename(t *testing.T) {
+	const snapshotName = "pg-rename-test"
+	const newName = "pg-renamed-test"
+
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		CreateTestSnapshot(t, snapshotName)
+		CreateTestSnapshot(t, "pg-rename-other")
+
+		out, err := RunLunarCommand("rename " + snapshotName + " pg-rename-other")
+		if err == nil || !strings.Contains(string(out), "already exists") {
+			t.Errorf("Expected rename to refuse a name that is taken\nOutput: %s", string(out))
+		}
+
+		out, err = RunLunarCommand("rename " + snapshotName + " " + newName)
+		if err != nil || !strings.Contains(string(out), "renamed to "+newName) {
+			t.Fatalf("Error renaming snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("restore " + newName)
+		if err != nil || !strings.Contains(string(out), "restored successfully") {
+			t.Errorf("Error restoring the renamed snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		os.Chdir("tests")
+		if exists, err := DoesDatabaseExist(SnapshotDatabaseName(snapshotName)); err != nil || exists {
+			t.Errorf("Expected %s to be gone after the rename: %v", SnapshotDatabaseName(snapshotName), err)
+		}
+		CleanupSnapshot(newName)
+		CleanupSnapshot("pg-rename-other")
+	})
+}
+
+// ============================================================================
+// SQLite Rename Tests
+// ============================================================================
+
+func TestSQLite_Rename(t *testing.T) {
+	const snapshotName = "sqlite-rename-test"
+	const newName = "sqlite-renamed-test"
+
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		CreateTestSnapshot(t, snapshotName)
+		WaitForSQLiteSnapshotCopies(t, snapshotName, 1)
+
+		out, err := RunLunarCommand("rename " + snapshotName + " " + newName)
+		if err != nil || !strings.Contains(string(out), "renamed to "+newName) {
+			t.Fatalf("Error renaming snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		if exists, err := SQLiteSnapshotExists(snapshotName); err != nil || exists {
+			t.Errorf("Expected snapshot `%s` to be gone after the rename: %v", snapshotName, err)
+		}
+		if exists, err := SQLiteSnapshotExists(newName); err != nil || !exists {
+			t.Errorf("Expected snapshot `%s` to exist after the rename: %v", newName, err)
+		}
+		if _, err := os.Stat(strings.TrimSuffix(SQLiteSnapshotPath(newName), ".db") + "_copy.db"); err != nil {
+			t.Errorf("Expected the copy to be renamed with the snapshot: %v", err)
+		}
+
+		out, err = RunLunarCommand("list")
+		if err != nil || !strings.Contains(string(out), newName) || strings.Contains(string(out), snapshotName+" ") {
+			t.Errorf("Expected only the new name to be listed: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("verify " + newName)
+		if err != nil {
+			t.Errorf("Expected the renamed snapshot to verify: %v\nOutput: %s", err, string(out))
+		}
+
+		CleanupSQLiteSnapshot(newName)
+	})
+}
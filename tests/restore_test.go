@@ -1,10 +1,14 @@
 package tests
 
 import (
+	"database/sql"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/leonvogt/lunar/internal"
+	"github.com/leonvogt/lunar/internal/provider/postgres"
 )
 
 // ============================================================================
@@ -49,6 +53,241 @@ func TestPostgres_Restore(t *testing.T) {
 	})
 }
 
+func TestPostgres_RestoreWhileClientsReconnect(t *testing.T) {
+	const snapshotName = "pg-fencing-test"
+
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		CreateTestSnapshot(t, snapshotName)
+
+		// Behaves like an app server that reconnects as soon as its connection is terminated
+		client, err := sql.Open("postgres", testConfig.DatabaseUrl+"lunar_test?sslmode=disable")
+		if err != nil {
+			t.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer client.Close()
+
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(10 * time.Millisecond):
+					client.Exec("SELECT 1")
+				}
+			}
+		}()
+
+		out, err := RunLunarCommand("restore " + snapshotName)
+		close(stop)
+		<-stopped
+		if err != nil || !strings.Contains(string(out), "restored successfully") {
+			t.Errorf("Error restoring snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		// Connections are allowed again after the restore
+		if _, err := client.Exec("SELECT 1"); err != nil {
+			t.Errorf("Expected connections to the restored database to be allowed: %v", err)
+		}
+
+		os.Chdir("tests")
+		CleanupSnapshot(snapshotName)
+	})
+}
+
+func TestPostgres_RestoreWithFailConnectionStrategy(t *testing.T) {
+	const snapshotName = "pg-connection-strategy-test"
+
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		CreateTestSnapshot(t, snapshotName)
+
+		strategyConfig := *testConfig
+		strategyConfig.ConnectionStrategy = "fail"
+		if err := internal.CreateConfigFile(&strategyConfig, "lunar.yml"); err != nil {
+			t.Fatalf("Failed to create config file with connection strategy: %v", err)
+		}
+
+		client, err := sql.Open("postgres", testConfig.DatabaseUrl+"lunar_test?sslmode=disable&application_name=test-app-server")
+		if err != nil {
+			t.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer client.Close()
+		if err := client.Ping(); err != nil {
+			t.Fatalf("Failed to connect to database: %v", err)
+		}
+
+		out, err := RunLunarCommand("restore " + snapshotName)
+		if err == nil {
+			t.Errorf("Expected the restore to fail while a client is connected\nOutput: %s", string(out))
+		}
+		if !strings.Contains(string(out), "test-app-server") {
+			t.Errorf("Expected the connected client to be listed but got '%s'", string(out))
+		}
+
+		// The client was left alone and can still connect
+		if _, err := client.Exec("SELECT 1"); err != nil {
+			t.Errorf("Expected the client connection to be kept: %v", err)
+		}
+
+		os.Chdir("tests")
+		CleanupSnapshot(snapshotName)
+	})
+}
+
+func TestPostgres_RestorePreservesDatabaseSettings(t *testing.T) {
+	const snapshotName = "pg-settings-test"
+
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		admin, err := postgres.ConnectToMaintenanceDatabaseWithURL(testConfig.DatabaseUrl)
+		if err != nil {
+			t.Fatalf("Failed to connect to maintenance database: %v", err)
+		}
+		defer admin.Close()
+
+		for _, statement := range []string{
+			"CREATE ROLE app_owner",
+			"CREATE ROLE app_reader",
+			"CREATE ROLE app_other",
+			"REVOKE CONNECT ON DATABASE lunar_test FROM PUBLIC",
+			"ALTER DATABASE lunar_test OWNER TO app_owner",
+			"GRANT CONNECT ON DATABASE lunar_test TO app_reader",
+			"ALTER DATABASE lunar_test SET work_mem TO '64MB'",
+			"ALTER DATABASE lunar_test SET search_path TO '$user', public",
+			"COMMENT ON DATABASE lunar_test IS 'The app database'",
+		} {
+			if _, err := admin.Exec(statement); err != nil {
+				t.Fatalf("Failed to run `%s`: %v", statement, err)
+			}
+		}
+
+		CreateTestSnapshot(t, snapshotName)
+
+		out, err := RunLunarCommand("restore " + snapshotName)
+		if err != nil {
+			t.Fatalf("Error restoring snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		var owner, comment string
+		var canConnect, otherCanConnect bool
+		err = admin.QueryRow(`
+			SELECT pg_get_userbyid(datdba), shobj_description(oid, 'pg_database'), has_database_privilege('app_reader', oid, 'CONNECT'),
+				has_database_privilege('app_other', oid, 'CONNECT')
+			FROM pg_database WHERE datname = 'lunar_test'`).Scan(&owner, &comment, &canConnect, &otherCanConnect)
+		if err != nil {
+			t.Fatalf("Failed to query the restored database: %v", err)
+		}
+		if owner != "app_owner" {
+			t.Errorf("Expected the restored database to be owned by app_owner but got %s", owner)
+		}
+		if comment != "The app database" {
+			t.Errorf("Expected the comment to be preserved but got '%s'", comment)
+		}
+		if !canConnect || otherCanConnect {
+			t.Errorf("Expected only app_reader to have the CONNECT privilege")
+		}
+
+		var parameters string
+		err = admin.QueryRow(`
+			SELECT array_to_string(s.setconfig, ';')
+			FROM pg_db_role_setting s JOIN pg_database d ON d.oid = s.setdatabase
+			WHERE d.datname = 'lunar_test' AND s.setrole = 0`).Scan(&parameters)
+		if err != nil {
+			t.Fatalf("Failed to query the parameters of the restored database: %v", err)
+		}
+		if !strings.Contains(parameters, "work_mem=64MB") || !strings.Contains(parameters, `search_path="$user", public`) {
+			t.Errorf("Expected the parameters to be preserved but got '%s'", parameters)
+		}
+
+		os.Chdir("tests")
+		CleanupSnapshot(snapshotName)
+	})
+}
+
+func TestPostgres_RestoreCreatesMissingRoles(t *testing.T) {
+	const snapshotName = "pg-roles-test"
+
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		rolesConfig := *testConfig
+		rolesConfig.IncludeRoles = true
+		if err := internal.CreateConfigFile(&rolesConfig, "lunar.yml"); err != nil {
+			t.Fatalf("Failed to create config file with include_roles: %v", err)
+		}
+
+		admin, err := postgres.ConnectToMaintenanceDatabaseWithURL(testConfig.DatabaseUrl)
+		if err != nil {
+			t.Fatalf("Failed to connect to maintenance database: %v", err)
+		}
+		defer admin.Close()
+
+		for _, statement := range []string{
+			"CREATE ROLE app_workers",
+			"CREATE ROLE app_worker LOGIN BYPASSRLS PASSWORD 'secret' IN ROLE app_workers",
+			"ALTER ROLE app_worker IN DATABASE lunar_test SET work_mem TO '1MB'",
+		} {
+			if _, err := admin.Exec(statement); err != nil {
+				t.Fatalf("Failed to run `%s`: %v", statement, err)
+			}
+		}
+
+		CreateTestSnapshot(t, snapshotName)
+
+		// The role setting is dropped together with the role
+		if _, err := admin.Exec("DROP ROLE app_worker"); err != nil {
+			t.Fatalf("Failed to drop role: %v", err)
+		}
+
+		out, err := RunLunarCommand("restore " + snapshotName)
+		if err != nil || !strings.Contains(string(out), "restored successfully") {
+			t.Fatalf("Error restoring snapshot: %v\nOutput: %s", err, string(out))
+		}
+		if !strings.Contains(string(out), "role app_worker was created without LOGIN, BYPASSRLS") {
+			t.Errorf("Expected a warning about the attributes left out\nOutput: %s", string(out))
+		}
+
+		var canLogin, bypassRLS, isMember, hasPassword bool
+		err = admin.QueryRow(`
+			SELECT rolcanlogin, rolbypassrls, pg_has_role('app_worker', 'app_workers', 'MEMBER'), rolpassword IS NOT NULL
+			FROM pg_authid WHERE rolname = 'app_worker'`).Scan(&canLogin, &bypassRLS, &isMember, &hasPassword)
+		if err != nil {
+			t.Fatalf("Expected role app_worker to be created: %v", err)
+		}
+		if canLogin || bypassRLS || !isMember {
+			t.Errorf("Expected app_worker to be created with NOLOGIN NOBYPASSRLS as a member of app_workers")
+		}
+		if hasPassword {
+			t.Errorf("Expected app_worker to be created without a password")
+		}
+
+		var settings string
+		err = admin.QueryRow(`
+			SELECT array_to_string(s.setconfig, ';')
+			FROM pg_db_role_setting s
+			JOIN pg_database d ON d.oid = s.setdatabase
+			JOIN pg_roles r ON r.oid = s.setrole
+			WHERE d.datname = 'lunar_test' AND r.rolname = 'app_worker'`).Scan(&settings)
+		if err != nil || settings != "work_mem=1MB" {
+			t.Errorf("Expected the role setting to be reapplied but got '%s' (%v)", settings, err)
+		}
+
+		os.Chdir("tests")
+		CleanupSnapshot(snapshotName)
+	})
+}
+
 func TestPostgres_AfterRestoreCommand(t *testing.T) {
 	const snapshotName = "pg-after-hook-test"
 	const markerFile = "after_restore_ran.txt"
@@ -145,3 +384,110 @@ func TestSQLite_Restore(t *testing.T) {
 		CleanupSQLiteSnapshot(snapshotName)
 	})
 }
+
+func TestSQLite_RestoreWithWarmCopies(t *testing.T) {
+	const snapshotName = "sqlite-warm-copies-test"
+
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	warmConfig := *config
+	warmConfig.WarmCopies = 2
+
+	WithSQLiteTestDirectory(t, &warmConfig, func() {
+		CreateTestSnapshot(t, snapshotName)
+		WaitForSQLiteSnapshotCopies(t, snapshotName, 2)
+
+		out, err := RunLunarCommand("info " + snapshotName)
+		if err != nil {
+			t.Errorf("Error running info command: %v", err)
+		}
+		if !strings.Contains(string(out), "2 of 2 ready") {
+			t.Errorf("Expected both warm copies to be ready but got '%s'", string(out))
+		}
+
+		// Restoring twice in a row must not wait for a copy to be recreated
+		for i := 0; i < 2; i++ {
+			out, err := RunLunarCommand("restore " + snapshotName)
+			if err != nil {
+				t.Errorf("Error restoring snapshot: %v", err)
+			}
+			if !strings.Contains(string(out), "Snapshot restored successfully") {
+				t.Errorf("Expected restore to succeed but got '%s'", string(out))
+			}
+		}
+
+		WaitForSQLiteSnapshotCopies(t, snapshotName, 2)
+
+		CleanupSQLiteSnapshot(snapshotName)
+	})
+}
+
+func TestSQLite_RestoreWithoutPreparedCopy(t *testing.T) {
+	const snapshotName = "sqlite-missing-copy-test"
+
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		CreateTestSnapshot(t, snapshotName)
+		WaitForSQLiteSnapshotCopies(t, snapshotName, 1)
+
+		// Simulate a background process that crashed before preparing the copy
+		copyPath := strings.TrimSuffix(SQLiteSnapshotPath(snapshotName), ".db") + "_copy.db"
+		if err := os.Remove(copyPath); err != nil {
+			t.Fatalf("Failed to remove snapshot copy: %v", err)
+		}
+
+		out, err := RunLunarCommand("restore " + snapshotName)
+		if err != nil {
+			t.Errorf("Error restoring snapshot: %v", err)
+		}
+		if !strings.Contains(string(out), "Snapshot restored successfully") {
+			t.Errorf("Expected restore to succeed without a prepared copy but got '%s'", string(out))
+		}
+
+		WaitForSQLiteSnapshotCopies(t, snapshotName, 1)
+
+		CleanupSQLiteSnapshot(snapshotName)
+	})
+}
+
+func TestSQLite_RestoreWithoutTerminal(t *testing.T) {
+	const snapshotName = "sqlite-no-terminal-test"
+
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		out, err := RunLunarCommand("snapshot " + snapshotName)
+		if err != nil {
+			t.Fatalf("Error creating snapshot: %v", err)
+		}
+		if strings.Contains(string(out), "\033[") {
+			t.Errorf("Expected plain output without a terminal but got %q", string(out))
+		}
+
+		// Without a terminal the snapshot can't be selected, so restore has to fail instead of waiting
+		for _, command := range []string{"restore", "restore --no-input"} {
+			out, err = RunLunarCommand(command)
+			if err == nil {
+				t.Errorf("Expected %q to exit with an error\nOutput: %s", command, string(out))
+			}
+			if !strings.Contains(string(out), "Pass the snapshot name") || !strings.Contains(string(out), snapshotName) {
+				t.Errorf("Expected %q to ask for the snapshot name but got '%s'", command, string(out))
+			}
+		}
+
+		out, err = RunLunarCommand("restore --quiet " + snapshotName)
+		if err != nil {
+			t.Errorf("Error restoring snapshot: %v", err)
+		}
+		if strings.Contains(string(out), "Restoring snapshot") || !strings.Contains(string(out), "Snapshot restored successfully") {
+			t.Errorf("Expected --quiet to only print the result but got '%s'", string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSQLiteSnapshot(snapshotName)
+	})
+}
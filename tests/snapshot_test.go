@@ -1,7 +1,10 @@
 package tests
 
 import (
+	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -9,7 +12,20 @@ import (
 )
 
 func TestMain(m *testing.M) {
+	// Commands run a built binary, `go run` would add its own "exit status" line to the output of failed commands
+	binaryDirectory, err := os.MkdirTemp("", "lunar-tests")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create directory for the lunar binary: %v\n", err)
+		os.Exit(1)
+	}
+	lunarBinary = filepath.Join(binaryDirectory, "lunar")
+	if out, err := exec.Command("go", "build", "-o", lunarBinary, "..").CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to build lunar: %v\n%s", err, out)
+		os.Exit(1)
+	}
+
 	code := m.Run()
+	os.RemoveAll(binaryDirectory)
 	os.Exit(code)
 }
 
@@ -55,8 +71,8 @@ func TestPostgres_SnapshotAlreadyExists(t *testing.T) {
 
 		// Try to create a snapshot with the same name
 		out, err := RunLunarCommand("snapshot " + snapshotName)
-		if err != nil {
-			t.Errorf("Error: %v", err)
+		if err == nil {
+			t.Errorf("Expected snapshot to fail for an existing name")
 		}
 
 		expectedOutput := "snapshot with name " + snapshotName + " already exists\n"
@@ -138,6 +154,29 @@ func TestPostgres_BeforeSnapshotCommandFailureAbortsSnapshot(t *testing.T) {
 	})
 }
 
+func TestPostgres_SnapshotWithLongName(t *testing.T) {
+	snapshotName := "before-migration-" + strings.Repeat("x", 60)
+
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		CreateTestSnapshot(t, "'"+snapshotName+"'")
+
+		out, err := RunLunarCommand("list")
+		if err != nil {
+			t.Errorf("Error running list command: %v", err)
+		}
+		if !strings.Contains(string(out), snapshotName) {
+			t.Errorf("Expected the full snapshot name to be listed but got '%s'", string(out))
+		}
+
+		if out, err := RunLunarCommand("remove '" + snapshotName + "'"); err != nil {
+			t.Errorf("Error removing snapshot: %v\nOutput: %s", err, string(out))
+		}
+	})
+}
+
 // ============================================================================
 // SQLite Snapshot Tests
 // ============================================================================
@@ -180,8 +219,8 @@ func TestSQLite_SnapshotAlreadyExists(t *testing.T) {
 
 		// Try to create a snapshot with the same name
 		out, err := RunLunarCommand("snapshot " + snapshotName)
-		if err != nil {
-			t.Errorf("Error: %v", err)
+		if err == nil {
+			t.Errorf("Expected snapshot to fail for an existing name")
 		}
 
 		expectedOutput := "snapshot with name " + snapshotName + " already exists\n"
@@ -193,3 +232,224 @@ func TestSQLite_SnapshotAlreadyExists(t *testing.T) {
 		CleanupSQLiteSnapshot(snapshotName)
 	})
 }
+
+func TestSQLite_CompressedSnapshot(t *testing.T) {
+	const snapshotName = "sqlite-compressed-test"
+
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	compressedConfig := *config
+	compressedConfig.Compression = "zstd"
+
+	WithSQLiteTestDirectory(t, &compressedConfig, func() {
+		CreateTestSnapshot(t, snapshotName)
+
+		exists, err := SQLiteSnapshotExists(snapshotName)
+		if err != nil {
+			t.Fatalf("Error checking snapshot existence: %v", err)
+		}
+		if exists {
+			t.Errorf("Expected snapshot `%s` to not be stored uncompressed", snapshotName)
+		}
+
+		if _, err := os.Stat(SQLiteSnapshotPath(snapshotName) + ".zst"); os.IsNotExist(err) {
+			t.Errorf("Expected compressed snapshot `%s` to exist - but it does not", snapshotName)
+		}
+
+		out, err := RunLunarCommand("list")
+		if err != nil {
+			t.Errorf("Error running list command: %v", err)
+		}
+		if !strings.Contains(string(out), "on disk") {
+			t.Errorf("Expected output to contain the on-disk size but got '%s'", string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSQLiteSnapshot(snapshotName)
+	})
+}
+
+func TestSQLite_SnapshotRefusedWithoutDiskSpace(t *testing.T) {
+	const snapshotName = "sqlite-disk-space-test"
+
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		CreateTestSnapshot(t, snapshotName)
+
+		limitedConfig := *config
+		limitedConfig.MinFreeDiskSpace = "1000PB"
+		if err := internal.CreateConfigFile(&limitedConfig, "lunar.yml"); err != nil {
+			t.Fatalf("Failed to create config file with disk space limit: %v", err)
+		}
+
+		out, _ := RunLunarCommand("snapshot sqlite-disk-space-refused")
+		if !strings.Contains(string(out), "not enough disk space") || !strings.Contains(string(out), "min_free_disk_space") {
+			t.Errorf("Expected the snapshot to be refused but got '%s'", string(out))
+		}
+		if exists, _ := SQLiteSnapshotExists("sqlite-disk-space-refused"); exists {
+			t.Errorf("Expected no snapshot to be created without disk space")
+		}
+
+		// The existing snapshot is kept when there is no room for its replacement
+		out, _ = RunLunarCommand("replace " + snapshotName)
+		if !strings.Contains(string(out), "not enough disk space") {
+			t.Errorf("Expected the replacement to be refused but got '%s'", string(out))
+		}
+		if exists, _ := SQLiteSnapshotExists(snapshotName); !exists {
+			t.Errorf("Expected snapshot `%s` to be kept after the refused replacement", snapshotName)
+		}
+
+		os.Chdir("tests")
+		CleanupSQLiteSnapshot(snapshotName)
+	})
+}
+
+func TestSQLite_SnapshotQuota(t *testing.T) {
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	quotaConfig := *config
+	quotaConfig.MaxTotalSnapshotSize = "1B"
+
+	WithSQLiteTestDirectory(t, &quotaConfig, func() {
+		out, _ := RunLunarCommand("snapshot sqlite-quota-test")
+		if !strings.Contains(string(out), "more than max_total_snapshot_size") {
+			t.Errorf("Expected the snapshot to exceed the quota but got '%s'", string(out))
+		}
+		if exists, _ := SQLiteSnapshotExists("sqlite-quota-test"); exists {
+			t.Errorf("Expected no snapshot to be created beyond the quota")
+		}
+	})
+}
+
+func TestSQLite_SnapshotRecordsDurationForETA(t *testing.T) {
+	const snapshotName = "sqlite-eta-test"
+
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		CreateTestSnapshot(t, snapshotName)
+
+		config, err := internal.ReadConfig()
+		if err != nil {
+			t.Fatalf("Failed to read config: %v", err)
+		}
+		if estimate := config.EstimateSnapshotDuration(config.GetResolvedDatabasePath(), 1<<20); estimate <= 0 {
+			t.Errorf("Expected the snapshot duration to be recorded for the ETA of the next snapshot")
+		}
+
+		os.Chdir("tests")
+		CleanupSQLiteSnapshot(snapshotName)
+	})
+}
+
+func TestSQLite_DeduplicatedSnapshot(t *testing.T) {
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	dedupConfig := *config
+	dedupConfig.SnapshotStorage = "dedup"
+	dedupConfig.Compression = "zstd"
+
+	WithSQLiteTestDirectory(t, &dedupConfig, func() {
+		CreateTestSnapshot(t, "sqlite-dedup-first")
+		CreateTestSnapshot(t, "sqlite-dedup-second")
+
+		for _, snapshotName := range []string{"sqlite-dedup-first", "sqlite-dedup-second"} {
+			if _, err := os.Stat(SQLiteSnapshotPath(snapshotName) + ".manifest"); os.IsNotExist(err) {
+				t.Errorf("Expected manifest for snapshot `%s` to exist - but it does not", snapshotName)
+			}
+		}
+
+		chunkDirectory := filepath.Join(config.SnapshotDirectory, ".lunar_chunks")
+		if CountFiles(chunkDirectory) == 0 {
+			t.Errorf("Expected chunks to be stored in `%s`", chunkDirectory)
+		}
+
+		// Chunks shared with earlier snapshots may be stored uncompressed, so no compression is recorded
+		out, err := RunLunarCommand("info sqlite-dedup-second")
+		if err != nil || !strings.Contains(string(out), "per chunk") {
+			t.Errorf("Expected the compression to be reported per chunk: %v\nOutput: %s", err, string(out))
+		}
+
+		for _, snapshotName := range []string{"sqlite-dedup-first", "sqlite-dedup-second"} {
+			if out, err := RunLunarCommand("remove " + snapshotName); err != nil {
+				t.Errorf("Error removing snapshot: %v\nOutput: %s", err, string(out))
+			}
+		}
+
+		if count := CountFiles(chunkDirectory); count != 0 {
+			t.Errorf("Expected unreferenced chunks to be removed, but %d are left", count)
+		}
+	})
+}
+
+func TestSQLite_SnapshotTimeout(t *testing.T) {
+	const snapshotName = "sqlite-timeout-test"
+
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		out, _ := RunLunarCommand("snapshot --timeout 1ns " + snapshotName)
+		if !strings.Contains(string(out), "operation timed out") {
+			t.Errorf("Expected the snapshot to time out but got '%s'", string(out))
+		}
+
+		exists, err := SQLiteSnapshotExists(snapshotName)
+		if err != nil {
+			t.Fatalf("Error checking snapshot existence: %v", err)
+		}
+		if exists {
+			t.Errorf("Expected no partial snapshot `%s` to be left behind", snapshotName)
+			CleanupSQLiteSnapshot(snapshotName)
+		}
+	})
+}
+
+func TestSQLite_SnapshotNaming(t *testing.T) {
+	const snapshotName = "vor der Migration ☕"
+
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		for _, invalidName := range []string{"a/b", "a____b", "production_copy", "production_copy2"} {
+			out, _ := RunLunarCommand("snapshot '" + invalidName + "'")
+			if !strings.Contains(string(out), "snapshot name must not") {
+				t.Errorf("Expected snapshot name `%s` to be rejected but got '%s'", invalidName, string(out))
+			}
+		}
+
+		CreateTestSnapshot(t, "'"+snapshotName+"'")
+
+		out, err := RunLunarCommand("list")
+		if err != nil {
+			t.Errorf("Error running list command: %v", err)
+		}
+		if !strings.Contains(string(out), snapshotName) {
+			t.Errorf("Expected snapshot `%s` to be listed but got '%s'", snapshotName, string(out))
+		}
+
+		// The name is hashed for the file name
+		matches, _ := filepath.Glob(filepath.Join(config.SnapshotDirectory, "*_@*.db"))
+		if len(matches) == 0 {
+			t.Errorf("Expected the snapshot to be stored under a hashed file name")
+		}
+
+		if out, err := RunLunarCommand("restore '" + snapshotName + "'"); err != nil || !strings.Contains(string(out), "restored successfully") {
+			t.Errorf("Error restoring snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		if out, err := RunLunarCommand("remove '" + snapshotName + "'"); err != nil {
+			t.Errorf("Error removing snapshot: %v\nOutput: %s", err, string(out))
+		}
+		if matches, _ := filepath.Glob(filepath.Join(config.SnapshotDirectory, "*_@*")); len(matches) != 0 {
+			t.Errorf("Expected all snapshot files to be removed, but %v are left", matches)
+		}
+	})
+}
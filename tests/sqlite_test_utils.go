@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/leonvogt/lunar/internal"
 	"github.com/leonvogt/lunar/internal/provider"
@@ -98,20 +99,23 @@ func SetupSQLiteTestDirectory(t *testing.T, config *internal.Config) *TestDirect
 	return &TestDirectoryManager{
 		originalDir:   originalDir,
 		hasConfigFile: true,
+		stateDir:      SetupTestStateDirectory(t),
 	}
 }
 
+// Snapshot naming follows the pattern: dbNameWithoutExt_snapshotName.db
+func SQLiteSnapshotPath(snapshotName string) string {
+	dbBaseName := filepath.Base(sqliteTestConfig.DatabasePath)
+	dbNameWithoutExt := dbBaseName[:len(dbBaseName)-len(filepath.Ext(dbBaseName))]
+	return filepath.Join(sqliteTestConfig.SnapshotDirectory, dbNameWithoutExt+"_"+snapshotName+".db")
+}
+
 func SQLiteSnapshotExists(snapshotName string) (bool, error) {
 	if sqliteTestConfig == nil {
 		return false, fmt.Errorf("SQLite test config not initialized")
 	}
 
-	// Snapshot naming follows the pattern: dbNameWithoutExt_snapshotName.db
-	dbBaseName := filepath.Base(sqliteTestConfig.DatabasePath)
-	dbNameWithoutExt := dbBaseName[:len(dbBaseName)-len(filepath.Ext(dbBaseName))]
-	snapshotPath := filepath.Join(sqliteTestConfig.SnapshotDirectory, dbNameWithoutExt+"_"+snapshotName+".db")
-
-	_, err := os.Stat(snapshotPath)
+	_, err := os.Stat(SQLiteSnapshotPath(snapshotName))
 	if os.IsNotExist(err) {
 		return false, nil
 	}
@@ -133,12 +137,51 @@ func CleanupSQLiteSnapshot(snapshotName string) {
 	snapshotCopyPath := filepath.Join(sqliteTestConfig.SnapshotDirectory, dbNameWithoutExt+"_"+snapshotName+"_copy.db")
 
 	os.Remove(snapshotPath)
+	os.Remove(snapshotPath + ".zst")
+	os.Remove(snapshotPath + ".manifest")
 	os.Remove(snapshotCopyPath)
 	// Also remove WAL files if they exist
 	os.Remove(snapshotPath + "-wal")
 	os.Remove(snapshotPath + "-shm")
 	os.Remove(snapshotCopyPath + "-wal")
 	os.Remove(snapshotCopyPath + "-shm")
+
+	// Further copies of the warm copies pool: _copy2.db, _copy3.db, ...
+	warmCopies, _ := filepath.Glob(filepath.Join(sqliteTestConfig.SnapshotDirectory, dbNameWithoutExt+"_"+snapshotName+"_copy[0-9]*.db"))
+	for _, copyPath := range warmCopies {
+		os.Remove(copyPath)
+	}
+}
+
+// Waits until the background process prepared the given number of warm copies
+func WaitForSQLiteSnapshotCopies(t *testing.T, snapshotName string, count int) {
+	dbBaseName := filepath.Base(sqliteTestConfig.DatabasePath)
+	dbNameWithoutExt := dbBaseName[:len(dbBaseName)-len(filepath.Ext(dbBaseName))]
+	lastCopyPath := filepath.Join(sqliteTestConfig.SnapshotDirectory, dbNameWithoutExt+"_"+snapshotName+"_copy.db")
+	if count > 1 {
+		lastCopyPath = filepath.Join(sqliteTestConfig.SnapshotDirectory, fmt.Sprintf("%s_%s_copy%d.db", dbNameWithoutExt, snapshotName, count))
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(lastCopyPath); err == nil {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d copies of snapshot `%s`", count, snapshotName)
+}
+
+// Counts the files in a directory tree, ignoring directories
+func CountFiles(directory string) int {
+	count := 0
+	filepath.WalkDir(directory, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			count++
+		}
+		return nil
+	})
+	return count
 }
 
 func ConnectToSQLiteTestDatabase() (*sql.DB, error) {
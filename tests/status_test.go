@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// PostgreSQL Status Tests
+// ============================================================================
+
+func TestPostgres_StatusDetectsModifiedDatabase(t *testing.T) {
+	const snapshotName = "pg-status-test"
+
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		out, err := RunLunarCommand("status")
+		if err != nil || !strings.Contains(string(out), "no snapshot was taken or restored yet") {
+			t.Errorf("Expected an unknown state before the first snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		CreateTestSnapshot(t, snapshotName)
+
+		out, err = RunLunarCommand("restore " + snapshotName)
+		if err != nil || !strings.Contains(string(out), "restored successfully") {
+			t.Fatalf("Error restoring snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("status")
+		if err != nil || !strings.Contains(string(out), "clean since restore of "+snapshotName) {
+			t.Errorf("Expected the restored database to be clean: %v\nOutput: %s", err, string(out))
+		}
+
+		os.Chdir("tests")
+		db, err := ConnectToTestDatabase("lunar_test")
+		if err != nil {
+			t.Fatalf("Failed to connect to test database: %v", err)
+		}
+		InsertUser("lunar_test", "Mallory", "Writer", "mallory@example.com", db)
+		db.Close()
+
+		// Statistics are reported asynchronously
+		time.Sleep(2 * time.Second)
+
+		os.Chdir("..")
+		out, err = RunLunarCommand("status")
+		if err != nil || !strings.Contains(string(out), "modified since restore of "+snapshotName) {
+			t.Errorf("Expected the database to be modified: %v\nOutput: %s", err, string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSnapshot(snapshotName)
+	})
+}
+
+// ============================================================================
+// SQLite Status Tests
+// ============================================================================
+
+func TestSQLite_StatusDetectsModifiedDatabase(t *testing.T) {
+	const snapshotName = "sqlite-status-test"
+
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		CreateTestSnapshot(t, snapshotName)
+
+		out, err := RunLunarCommand("status")
+		if err != nil || !strings.Contains(string(out), "clean since snapshot "+snapshotName+" was taken") {
+			t.Errorf("Expected the database to be clean after the snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("restore " + snapshotName)
+		if err != nil || !strings.Contains(string(out), "restored successfully") {
+			t.Fatalf("Error restoring snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("status")
+		if err != nil || !strings.Contains(string(out), "clean since restore of "+snapshotName) {
+			t.Errorf("Expected the restored database to be clean: %v\nOutput: %s", err, string(out))
+		}
+
+		db, err := ConnectToSQLiteTestDatabase()
+		if err != nil {
+			t.Fatalf("Failed to open test database: %v", err)
+		}
+		InsertSQLiteUsers(db)
+		db.Close()
+
+		out, err = RunLunarCommand("status")
+		if err != nil || !strings.Contains(string(out), "modified since restore of "+snapshotName) {
+			t.Errorf("Expected the database to be modified: %v\nOutput: %s", err, string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSQLiteSnapshot(snapshotName)
+	})
+}
+
+func TestSQLite_StatusOverview(t *testing.T) {
+	const snapshotName = "sqlite-status-overview"
+
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		out, err := RunLunarCommand("status")
+		if err != nil {
+			t.Fatalf("Error running status: %v\nOutput: %s", err, string(out))
+		}
+		for _, expected := range []string{"lunar.yml", "Provider:", "sqlite", "Connection:", "ok", "Snapshots:", "none", "Jobs:", "none running", "Locks:", "none held"} {
+			if !strings.Contains(string(out), expected) {
+				t.Errorf("Expected status to contain '%s' but got '%s'", expected, string(out))
+			}
+		}
+
+		CreateTestSnapshot(t, snapshotName)
+		WaitForSQLiteSnapshotCopies(t, snapshotName, 1)
+
+		out, err = RunLunarCommand("status")
+		if err != nil {
+			t.Fatalf("Error running status: %v\nOutput: %s", err, string(out))
+		}
+		if !strings.Contains(string(out), "Snapshots:") || !strings.Contains(string(out), "1 (") {
+			t.Errorf("Expected status to count the snapshot but got '%s'", string(out))
+		}
+		if !strings.Contains(string(out), snapshotName) || !strings.Contains(string(out), "1 of 1 copies ready") {
+			t.Errorf("Expected status to show the ready copy but got '%s'", string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSQLiteSnapshot(snapshotName)
+	})
+}
@@ -61,6 +61,7 @@ func SetupTestContainer(t *testing.T) *internal.Config {
 	testConfig = &internal.Config{
 		DatabaseUrl:  databaseURL,
 		DatabaseName: "lunar_test",
+		Namespace:    "test",
 	}
 
 	err = internal.CreateConfigFile(testConfig, "lunar.yml")
@@ -140,6 +141,7 @@ func InsertUsers(databaseName string, db *sql.DB) {
 type TestDirectoryManager struct {
 	originalDir   string
 	hasConfigFile bool
+	stateDir      string
 }
 
 func SetupTestDirectory(t *testing.T) *TestDirectoryManager {
@@ -152,19 +154,37 @@ func SetupTestDirectory(t *testing.T) *TestDirectoryManager {
 	return &TestDirectoryManager{
 		originalDir:   originalDir,
 		hasConfigFile: true,
+		stateDir:      SetupTestStateDirectory(t),
 	}
 }
 
+// Gives every test its own state directory, so background jobs of
+// one test don't show up in another one (or in the user's state directory)
+func SetupTestStateDirectory(t *testing.T) string {
+	stateDir, err := os.MkdirTemp("", "lunar_state_test")
+	if err != nil {
+		t.Fatalf("Failed to create state directory: %v", err)
+	}
+	t.Setenv(internal.STATE_DIR_ENV, stateDir)
+	return stateDir
+}
+
 func (dm *TestDirectoryManager) Cleanup() {
 	if dm.hasConfigFile {
 		os.Remove("lunar.yml")
 	}
+	if dm.stateDir != "" {
+		os.RemoveAll(dm.stateDir)
+	}
 	os.Chdir(dm.originalDir)
 }
 
 // Execute a lunar command and returns output and error
+// Built by TestMain
+var lunarBinary string
+
 func RunLunarCommand(command string) ([]byte, error) {
-	cmd := exec.Command("sh", "-c", "go run main.go "+command)
+	cmd := exec.Command("sh", "-c", "'"+lunarBinary+"' "+command)
 	return cmd.CombinedOutput()
 }
 
@@ -176,7 +196,7 @@ func CreateTestSnapshot(t *testing.T, snapshotName string) {
 }
 
 func SnapshotDatabaseName(snapshotName string) string {
-	return "lunar_snapshot____lunar_test____" + snapshotName
+	return "lunar_snapshot____test____lunar_test____" + snapshotName
 }
 
 func CleanupSnapshot(snapshotName string) {
@@ -191,7 +211,8 @@ func CleanupSnapshot(snapshotName string) {
 	}
 	defer db.Close()
 
-	// Drop the snapshot and its copy
+	// Drop the snapshot and its copy. Snapshots are templates, which can't be dropped.
+	db.Exec("ALTER DATABASE " + SnapshotDatabaseName(snapshotName) + " IS_TEMPLATE false")
 	db.Exec("DROP DATABASE IF EXISTS " + SnapshotDatabaseName(snapshotName))
 	db.Exec("DROP DATABASE IF EXISTS " + SnapshotDatabaseName(snapshotName) + "_copy")
 }
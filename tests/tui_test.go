@@ -0,0 +1,26 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+)
+
+// ============================================================================
+// SQLite TUI Tests
+// ============================================================================
+
+// The dashboard can't be driven without a terminal, but it must not hang in scripts either
+func TestSQLite_TUIRequiresTerminal(t *testing.T) {
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		out, err := RunLunarCommand("tui")
+		if err == nil {
+			t.Errorf("Expected tui to exit with an error without a terminal")
+		}
+		if !strings.Contains(string(out), "lunar tui needs a terminal") {
+			t.Errorf("Expected tui to refuse to start without a terminal but got '%s'", string(out))
+		}
+	})
+}
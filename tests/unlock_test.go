@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/flock"
+)
+
+// Holds the operation lock like another Lunar process would, recording the given PID as holder
+func HoldSQLiteOperationLock(t *testing.T, snapshotDirectory string, pid int) *flock.Flock {
+	lockPath := filepath.Join(snapshotDirectory, ".lunar.lock")
+	lock := flock.New(lockPath)
+	if err := lock.Lock(); err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+
+	host, _ := os.Hostname()
+	owner, _ := json.Marshal(map[string]interface{}{"pid": pid, "host": host, "command": "lunar restore test"})
+	if err := os.WriteFile(lockPath+".owner", owner, 0644); err != nil {
+		t.Fatalf("Failed to write lock owner: %v", err)
+	}
+	return lock
+}
+
+func TestSQLite_Unlock(t *testing.T) {
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		out, err := RunLunarCommand("unlock")
+		if err != nil || !strings.Contains(string(out), "No locks are held") {
+			t.Errorf("Expected no locks to be held but got '%s' (%v)", string(out), err)
+		}
+
+		// The holder is still running
+		lock := HoldSQLiteOperationLock(t, config.SnapshotDirectory, os.Getpid())
+		out, _ = RunLunarCommand("unlock")
+		if !strings.Contains(string(out), "lunar restore test") || !strings.Contains(string(out), "still running") {
+			t.Errorf("Expected the running holder to be listed but got '%s'", string(out))
+		}
+		lock.Unlock()
+
+		// The recorded holder is gone, but another process still holds the lock (e.g. one that reused the PID)
+		deadProcess := exec.Command("true")
+		if err := deadProcess.Run(); err != nil {
+			t.Fatalf("Failed to run process: %v", err)
+		}
+		lock = HoldSQLiteOperationLock(t, config.SnapshotDirectory, deadProcess.Process.Pid)
+
+		out, err = RunLunarCommand("unlock")
+		if err == nil || !strings.Contains(string(out), "still held by a running process") {
+			t.Errorf("Expected the held lock not to be released but got '%s' (%v)", string(out), err)
+		}
+		if _, err := os.Stat(filepath.Join(config.SnapshotDirectory, ".lunar.lock")); err != nil {
+			t.Errorf("Expected the lock file to be kept: %v", err)
+		}
+
+		// Once the lock is free, the stale holder is cleaned up
+		lock.Unlock()
+		out, err = RunLunarCommand("unlock")
+		if err != nil || !strings.Contains(string(out), "No locks are held") {
+			t.Errorf("Expected no locks to be held but got '%s' (%v)", string(out), err)
+		}
+		if _, err := os.Stat(filepath.Join(config.SnapshotDirectory, ".lunar.lock.owner")); !os.IsNotExist(err) {
+			t.Errorf("Expected the stale holder to be removed")
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// PostgreSQL Verify Tests
+// ============================================================================
+
+func TestPostgres_VerifyDetectsModifiedSnapshot(t *testing.T) {
+	const snapshotName = "pg-verify-test"
+
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		CreateTestSnapshot(t, snapshotName)
+
+		out, err := RunLunarCommand("verify " + snapshotName)
+		if err != nil || !strings.Contains(string(out), "is intact") {
+			t.Errorf("Expected the new snapshot to be intact: %v\nOutput: %s", err, string(out))
+		}
+
+		os.Chdir("tests")
+		snapshotDB := SnapshotDatabaseName(snapshotName)
+
+		// Snapshots don't accept connections
+		if db, err := ConnectToTestDatabase(snapshotDB); err == nil {
+			if err := db.Ping(); err == nil {
+				t.Errorf("Expected connections to the snapshot database to be refused")
+			}
+			db.Close()
+		}
+
+		admin, err := ConnectToTestDatabase("postgres")
+		if err != nil {
+			t.Fatalf("Failed to connect to maintenance database: %v", err)
+		}
+		defer admin.Close()
+		if _, err := admin.Exec("ALTER DATABASE " + snapshotDB + " ALLOW_CONNECTIONS true"); err != nil {
+			t.Fatalf("Failed to allow connections to the snapshot: %v", err)
+		}
+
+		db, err := ConnectToTestDatabase(snapshotDB)
+		if err != nil {
+			t.Fatalf("Failed to connect to snapshot database: %v", err)
+		}
+		InsertUser(snapshotDB, "Mallory", "Writer", "mallory@example.com", db)
+		db.Close()
+
+		// Statistics are reported asynchronously
+		time.Sleep(2 * time.Second)
+
+		os.Chdir("..")
+		out, err = RunLunarCommand("verify " + snapshotName)
+		if err == nil {
+			t.Errorf("Expected verify to fail for a modified snapshot\nOutput: %s", string(out))
+		}
+		if !strings.Contains(string(out), "accepts connections") || !strings.Contains(string(out), "inserted, updated or deleted") || !strings.Contains(string(out), "don't match the checksum") {
+			t.Errorf("Expected verify to report the modification but got '%s'", string(out))
+		}
+
+		// Protected snapshots can still be removed
+		out, err = RunLunarCommand("remove " + snapshotName)
+		if err != nil || !strings.Contains(string(out), "removed successfully") {
+			t.Errorf("Error removing snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSnapshot(snapshotName)
+	})
+}
+
+func TestPostgres_UnprotectAndProtectSnapshot(t *testing.T) {
+	const snapshotName = "pg-protect-test"
+
+	SetupTestDatabase(t)
+	defer TeardownTestContainer(t)
+
+	WithTestDirectory(t, func() {
+		CreateTestSnapshot(t, snapshotName)
+
+		out, err := RunLunarCommand("unprotect " + snapshotName)
+		if err != nil || !strings.Contains(string(out), "unprotected") {
+			t.Fatalf("Error unprotecting snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		os.Chdir("tests")
+		db, err := ConnectToTestDatabase(SnapshotDatabaseName(snapshotName))
+		if err != nil {
+			t.Fatalf("Failed to connect to snapshot database: %v", err)
+		}
+		if err := db.Ping(); err != nil {
+			t.Errorf("Expected connections to the unprotected snapshot to be accepted: %v", err)
+		}
+		db.Close()
+		os.Chdir("..")
+
+		out, err = RunLunarCommand("verify " + snapshotName)
+		if err == nil || !strings.Contains(string(out), "accepts connections") {
+			t.Errorf("Expected verify to report the unprotected snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("protect " + snapshotName)
+		if err != nil || !strings.Contains(string(out), "protected") {
+			t.Fatalf("Error protecting snapshot: %v\nOutput: %s", err, string(out))
+		}
+
+		out, err = RunLunarCommand("verify " + snapshotName)
+		if err != nil || !strings.Contains(string(out), "is intact") {
+			t.Errorf("Expected the protected snapshot to be intact: %v\nOutput: %s", err, string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSnapshot(snapshotName)
+	})
+}
+
+// ============================================================================
+// SQLite Verify Tests
+// ============================================================================
+
+func TestSQLite_VerifyDetectsModifiedSnapshot(t *testing.T) {
+	const snapshotName = "sqlite-verify-test"
+
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		CreateTestSnapshot(t, snapshotName)
+
+		out, err := RunLunarCommand("verify " + snapshotName)
+		if err != nil || !strings.Contains(string(out), "is intact") {
+			t.Errorf("Expected the new snapshot to be intact: %v\nOutput: %s", err, string(out))
+		}
+
+		modifiedAt := time.Now().Add(time.Minute)
+		if err := os.Chtimes(SQLiteSnapshotPath(snapshotName), modifiedAt, modifiedAt); err != nil {
+			t.Fatalf("Failed to modify snapshot file: %v", err)
+		}
+
+		out, err = RunLunarCommand("verify " + snapshotName)
+		if err == nil || !strings.Contains(string(out), "was modified") {
+			t.Errorf("Expected verify to report the modification: %v\nOutput: %s", err, string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSQLiteSnapshot(snapshotName)
+	})
+}
+
+func TestSQLite_VerifyDetectsTruncatedSnapshot(t *testing.T) {
+	config := SetupSQLiteTestDatabase(t)
+	defer TeardownSQLiteTestDatabase(t)
+
+	WithSQLiteTestDirectory(t, config, func() {
+		CreateTestSnapshot(t, "sqlite-verify-intact")
+		CreateTestSnapshot(t, "sqlite-verify-truncated")
+
+		// Cut the snapshot down to its first page, like a full disk would
+		if err := os.Truncate(SQLiteSnapshotPath("sqlite-verify-truncated"), 4096); err != nil {
+			t.Fatalf("Failed to truncate snapshot file: %v", err)
+		}
+
+		out, err := RunLunarCommand("verify --all")
+		if err == nil {
+			t.Errorf("Expected verify to fail for a truncated snapshot\nOutput: %s", string(out))
+		}
+		if !strings.Contains(string(out), "Snapshot sqlite-verify-intact is intact") {
+			t.Errorf("Expected the other snapshot to be intact but got '%s'", string(out))
+		}
+		if !strings.Contains(string(out), "doesn't match") || !strings.Contains(string(out), "truncated") {
+			t.Errorf("Expected verify to report the truncated snapshot but got '%s'", string(out))
+		}
+		if !strings.Contains(string(out), "1 of 2 snapshots failed verification") {
+			t.Errorf("Expected a summary of the failed snapshots but got '%s'", string(out))
+		}
+
+		os.Chdir("tests")
+		CleanupSQLiteSnapshot("sqlite-verify-intact")
+		CleanupSQLiteSnapshot("sqlite-verify-truncated")
+	})
+}